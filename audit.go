@@ -0,0 +1,453 @@
+package mysqlkill
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Audit outcomes.
+const (
+	auditOK      = "ok"
+	auditDryRun  = "dry-run"
+	auditError   = "error"
+	auditRefused = "refused"
+)
+
+// auditRecord is one kill attempt, a line of the audit log.
+type auditRecord struct {
+	Time       time.Time `json:"time"`
+	OSUser     string    `json:"os_user"`
+	Caller     string    `json:"caller,omitempty"`  // serve: API token name
+	Request    string    `json:"request,omitempty"` // serve: HTTP method and path
+	Profile    string    `json:"profile,omitempty"`
+	Command    string    `json:"command"`
+	Rule       string    `json:"rule,omitempty"`
+	Target     string    `json:"target"`
+	Flavor     string    `json:"flavor,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	RoleReason string    `json:"role_reason,omitempty"`
+	ProcessID  int64     `json:"process_id,omitempty"`
+	SQL        string    `json:"sql,omitempty"`
+	// Process is the victim's processlist row, redacted, when it was found.
+	Process *auditProcess `json:"process,omitempty"`
+	DryRun  bool          `json:"dry_run"`
+	Outcome string        `json:"outcome"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// auditProcess is the processlist row of a victim.
+type auditProcess struct {
+	User    string `json:"user"`
+	Host    string `json:"host"`
+	DB      string `json:"db,omitempty"`
+	Command string `json:"command"`
+	Time    int64  `json:"time"`
+	State   string `json:"state,omitempty"`
+	Info    string `json:"info,omitempty"`
+	// FingerprintID identifies the statement; it is computed before
+	// redaction.
+	FingerprintID string `json:"fingerprint_id,omitempty"`
+}
+
+// auditSink receives encoded audit records.
+type auditSink interface {
+	write(line []byte) error
+	Close() error
+}
+
+// auditor appends kill attempts to the configured sinks and posts them to
+// the notifiers. A nil auditor records nothing.
+type auditor struct {
+	sinks     []auditSink
+	notifiers []*notifier
+	// listeners are called with every record, e.g. to count kills.
+	listeners []func(auditRecord)
+	// base holds the fields shared by every record of this invocation.
+	base auditRecord
+	red  redactor
+	now  func() time.Time
+
+	// pending tracks asynchronous notifications; Close waits for them.
+	pending sync.WaitGroup
+	mu      sync.Mutex
+	// warn receives sink and delivery errors; they never fail the kill.
+	warn io.Writer
+	// holdWarnings buffers warnings in held until Close, for full-screen
+	// views that stderr would garble.
+	holdWarnings bool
+	held         []string
+}
+
+// newAuditor opens the audit sinks and notifiers of cfg for command. Sinks
+// are opened up front so a misconfigured log fails the command before
+// anything is killed.
+func newAuditor(cfg AppConfig, command string) (*auditor, error) {
+	// Victim rows are always redacted, with the configured rules.
+	red := cfg.Redaction
+	red.Enabled = true
+	a := &auditor{
+		base: auditRecord{
+			OSUser:  currentOSUser(),
+			Profile: cfg.Profile,
+			Command: command,
+			Target:  targetAddr(cfg.MySQL),
+		},
+		red:  red,
+		now:  time.Now,
+		warn: os.Stderr,
+	}
+	for _, nc := range cfg.Notify {
+		n, err := newNotifier(nc)
+		if err != nil {
+			return nil, err
+		}
+		a.notifiers = append(a.notifiers, n)
+	}
+	if !cfg.Audit.Enabled {
+		return a, nil
+	}
+	if cfg.Audit.File != "" {
+		s, err := openAuditFile(cfg.Audit.File)
+		if err != nil {
+			return nil, err
+		}
+		a.sinks = append(a.sinks, s)
+	}
+	if cfg.Audit.Syslog {
+		s, err := openAuditSyslog()
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("open audit syslog: %w", err)
+		}
+		a.sinks = append(a.sinks, s)
+	}
+	return a, nil
+}
+
+// setTarget sets the address of the server kills are sent to.
+func (a *auditor) setTarget(target string) {
+	if a != nil {
+		a.base.Target = target
+	}
+}
+
+// setRule sets the rule that selected the victims of the next kills.
+func (a *auditor) setRule(rule string) {
+	if a != nil {
+		a.base.Rule = rule
+	}
+}
+
+// setCaller sets the API caller and request the next records are made for.
+func (a *auditor) setCaller(caller, request string) {
+	if a != nil {
+		a.base.Caller = caller
+		a.base.Request = request
+	}
+}
+
+// listen calls fn with every record.
+func (a *auditor) listen(fn func(auditRecord)) {
+	if a != nil {
+		a.listeners = append(a.listeners, fn)
+	}
+}
+
+// setServer sets the flavor and role of the server kills are sent to.
+func (a *auditor) setServer(flavor string, verdict roleVerdict) {
+	if a == nil {
+		return
+	}
+	a.base.Flavor = flavor
+	a.base.Role = ""
+	a.base.RoleReason = verdict.Reason
+	if verdict.Reason != "" {
+		a.base.Role = verdict.Role()
+	}
+}
+
+// Record appends rec to every sink and notifies it, with the invocation
+// fields filled in and victim, unless its ID is zero, as the redacted process.
+func (a *auditor) Record(rec auditRecord, victim Process) {
+	if a == nil {
+		return
+	}
+	out := a.fill(rec, victim)
+	a.write(out)
+	for _, fn := range a.listeners {
+		fn(out)
+	}
+
+	for _, n := range a.notifiers {
+		if !n.wants(out.Outcome) {
+			continue
+		}
+		if !n.cfg.Async {
+			a.notify(n, out)
+			continue
+		}
+		a.pending.Add(1)
+		go func() {
+			defer a.pending.Done()
+			a.notify(n, out)
+		}()
+	}
+}
+
+// RecordRequest appends an API request that kills nothing, such as a
+// processlist read, to the sinks only.
+func (a *auditor) RecordRequest(rec auditRecord) {
+	if a != nil {
+		a.write(a.fill(rec, Process{}))
+	}
+}
+
+// fill returns rec with the invocation fields and the redacted victim.
+func (a *auditor) fill(rec auditRecord, victim Process) auditRecord {
+	out := a.base
+	out.Time = a.now().UTC()
+	out.ProcessID = rec.ProcessID
+	out.SQL = rec.SQL
+	out.DryRun = rec.DryRun
+	out.Outcome = rec.Outcome
+	out.Error = rec.Error
+	if victim.ID != 0 {
+		v := a.red.Row(victim)
+		out.Process = &auditProcess{
+			User:    nullString(v.User),
+			Host:    nullString(v.Host),
+			DB:      nullString(v.DB),
+			Command: nullString(v.Command),
+			Time:    v.Time.Int64,
+			State:   nullString(v.State),
+			Info:    nullString(v.Info),
+
+			FingerprintID: victim.FingerprintID(),
+		}
+	}
+
+	return out
+}
+
+// write appends rec to every sink.
+func (a *auditor) write(rec auditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		a.warnf("audit: %v", err)
+		return
+	}
+	for _, s := range a.sinks {
+		if err := s.write(line); err != nil {
+			a.warnf("audit: %v", err)
+		}
+	}
+}
+
+// notify delivers rec to n, reporting a failure as a warning.
+func (a *auditor) notify(n *notifier, rec auditRecord) {
+	if err := n.send(context.Background(), rec); err != nil {
+		a.warnf("notify %s: %v", n, err)
+	}
+}
+
+// holdWarns buffers warnings until Close.
+func (a *auditor) holdWarns() {
+	if a != nil {
+		a.holdWarnings = true
+	}
+}
+
+// warnf reports a non-fatal error.
+func (a *auditor) warnf(format string, args ...any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	msg := fmt.Sprintf(format, args...)
+	if a.holdWarnings {
+		a.held = append(a.held, msg)
+		return
+	}
+	fmt.Fprintln(a.warn, msg)
+}
+
+// Close waits for pending notifications, closes the sinks and prints held
+// warnings.
+func (a *auditor) Close() {
+	if a == nil {
+		return
+	}
+	a.pending.Wait()
+	for _, s := range a.sinks {
+		_ = s.Close()
+	}
+	for _, msg := range a.held {
+		fmt.Fprintln(a.warn, msg)
+	}
+}
+
+// auditFile appends records to a JSON-lines file.
+type auditFile struct {
+	f *os.File
+}
+
+// openAuditFile opens path for appending, creating it and its directory
+// readable by the owner only.
+func openAuditFile(path string) (*auditFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &auditFile{f: f}, nil
+}
+
+// write appends line with a single write, so concurrent invocations do not
+// interleave records.
+func (s *auditFile) write(line []byte) error {
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+func (s *auditFile) Close() error {
+	return s.f.Close()
+}
+
+// currentOSUser returns the name of the OS user running mysql-kill.
+func currentOSUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return firstNonEmpty(os.Getenv("USER"), os.Getenv("USERNAME"))
+}
+
+// targetAddr returns the server address of cfg: host:port or socket path.
+func targetAddr(cfg MySQLConfig) string {
+	if parsed, err := parseDSN(cfg.DSN); err == nil && parsed != nil && parsed.Addr != "" {
+		return parsed.Addr
+	}
+	if cfg.Socket != "" {
+		return cfg.Socket
+	}
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// runAuditShow executes the audit show command.
+func runAuditShow(ctx context.Context, cli *CLI, cmd *AuditShowCmd) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	path := firstNonEmpty(expandTilde(cmd.File), cfg.Audit.File)
+	if path == "" {
+		return errors.New("no audit log: set file in [audit] or use --file")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	records, err := readAuditLog(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	records = cmd.filter(records, time.Now())
+
+	if cmd.Format == "json" {
+		return writeAuditJSON(os.Stdout, records)
+	}
+	return writeAuditTable(os.Stdout, records)
+}
+
+// readAuditLog parses a JSON-lines audit log.
+func readAuditLog(r io.Reader) ([]auditRecord, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var records []auditRecord
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var rec auditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
+
+// filter returns the records matching the flags, keeping the last --limit.
+func (c *AuditShowCmd) filter(records []auditRecord, now time.Time) []auditRecord {
+	var out []auditRecord
+	for _, rec := range records {
+		switch {
+		case c.Since > 0 && rec.Time.Before(now.Add(-c.Since)):
+		case c.OSUser != "" && rec.OSUser != c.OSUser:
+		case c.Caller != "" && rec.Caller != c.Caller:
+		case c.Profile != "" && rec.Profile != c.Profile:
+		case c.Target != "" && !strings.Contains(rec.Target, c.Target):
+		case c.Outcome != "" && rec.Outcome != c.Outcome:
+		case c.ProcessID != 0 && rec.ProcessID != c.ProcessID:
+		default:
+			out = append(out, rec)
+		}
+	}
+	if c.Limit > 0 && len(out) > c.Limit {
+		out = out[len(out)-c.Limit:]
+	}
+	return out
+}
+
+// writeAuditJSON prints records as JSON lines, in the format of the log.
+func writeAuditJSON(w io.Writer, records []auditRecord) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAuditTable prints records as a table, oldest first.
+func writeAuditTable(w io.Writer, records []auditRecord) error {
+	// Write errors are sticky in tabwriter and reported by Flush.
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tOS_USER\tCALLER\tPROFILE\tTARGET\tFLAVOR\tROLE\tSQL\tOUTCOME\tVICTIM\tINFO")
+	for _, rec := range records {
+		outcome := rec.Outcome
+		if rec.Error != "" {
+			outcome += ": " + rec.Error
+		}
+		sqlText := rec.SQL
+		if sqlText == "" {
+			sqlText = rec.Request
+		}
+		var victim, info string
+		if p := rec.Process; p != nil {
+			victim = p.User + "@" + p.Host
+			info = truncateText(flattenSpace(p.Info), infoMaxWidth)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			rec.Time.Local().Format(time.DateTime), rec.OSUser, rec.Caller, rec.Profile, rec.Target,
+			rec.Flavor, rec.Role, sqlText, outcome, victim, info)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !plan9
+
+package mysqlkill
+
+import "log/syslog"
+
+// auditSyslog sends records to the local syslog daemon.
+type auditSyslog struct {
+	w *syslog.Writer
+}
+
+// openAuditSyslog connects to syslog with the auth facility, where access
+// records usually go.
+func openAuditSyslog() (*auditSyslog, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "mysql-kill")
+	if err != nil {
+		return nil, err
+	}
+	return &auditSyslog{w: w}, nil
+}
+
+func (s *auditSyslog) write(line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *auditSyslog) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package mysqlkill
+
+import "errors"
+
+// openAuditSyslog fails: log/syslog is not available on this platform.
+func openAuditSyslog() (auditSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,178 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditorRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	cfg := AppConfig{
+		MySQL:   MySQLConfig{Host: "db1", Port: 3306},
+		Profile: "prod",
+		Audit:   AuditConfig{Enabled: true, File: path},
+	}
+	au, err := newAuditor(cfg, "kill")
+	if err != nil {
+		t.Fatalf("newAuditor: %v", err)
+	}
+	now := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	au.now = func() time.Time { return now }
+	au.setServer("mysql", roleVerdict{Reader: true, Reason: "read_only=ON"})
+
+	victim := Process{
+		ID:      42,
+		User:    sql.NullString{String: "app", Valid: true},
+		Host:    sql.NullString{String: "10.0.0.5:51234", Valid: true},
+		Command: sql.NullString{String: "Query", Valid: true},
+		Time:    sql.NullInt64{Int64: 310, Valid: true},
+		Info:    sql.NullString{String: "SELECT * FROM users WHERE email = 'alice@example.com'", Valid: true},
+	}
+	au.Record(auditRecord{ProcessID: 42, SQL: "KILL 42", Outcome: auditOK}, victim)
+	au.Record(auditRecord{ProcessID: 43, SQL: "KILL 43", DryRun: true, Outcome: auditRefused, Error: "process 43 not found"}, Process{})
+	au.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("mode: got %o", perm)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	records, err := readAuditLog(f)
+	if err != nil {
+		t.Fatalf("readAuditLog: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records", len(records))
+	}
+
+	got := records[0]
+	if !got.Time.Equal(now) || got.Profile != "prod" || got.Command != "kill" || got.Target != "db1:3306" ||
+		got.Flavor != "mysql" || got.Role != "reader" || got.RoleReason != "read_only=ON" ||
+		got.ProcessID != 42 || got.SQL != "KILL 42" || got.DryRun || got.Outcome != auditOK {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if got.Process == nil || got.Process.User != "app" || got.Process.Time != 310 {
+		t.Fatalf("unexpected process: %+v", got.Process)
+	}
+	if want := "SELECT * FROM users WHERE email = ?"; got.Process.Info != want {
+		t.Fatalf("info not redacted: got %q want %q", got.Process.Info, want)
+	}
+
+	if got := records[1]; got.Process != nil || !got.DryRun || got.Error != "process 43 not found" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+
+	// Records append to an existing log.
+	au, err = newAuditor(cfg, "mdl")
+	if err != nil {
+		t.Fatalf("newAuditor: %v", err)
+	}
+	au.Record(auditRecord{ProcessID: 44, Outcome: auditDryRun}, Process{})
+	au.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Fatalf("got %d lines", n)
+	}
+}
+
+func TestAuditorDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	au, err := newAuditor(AppConfig{Audit: AuditConfig{File: path}}, "kill")
+	if err != nil {
+		t.Fatalf("newAuditor: %v", err)
+	}
+	var got []auditRecord
+	au.listen(func(rec auditRecord) { got = append(got, rec) })
+	au.Record(auditRecord{Outcome: auditOK}, Process{ID: 1, Info: sql.NullString{String: "SELECT 1", Valid: true}})
+	au.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("disabled audit log was created: %v", err)
+	}
+	if len(got) != 1 || got[0].Process.FingerprintID != fingerprintID("SELECT 2") {
+		t.Fatalf("listener got %+v", got)
+	}
+
+	// A nil auditor is a no-op.
+	var nilAuditor *auditor
+	nilAuditor.setServer("mysql", roleVerdict{})
+	nilAuditor.Record(auditRecord{Outcome: auditOK}, Process{ID: 1})
+	nilAuditor.Close()
+}
+
+func TestAuditShowFilter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	records := []auditRecord{
+		{Time: now.Add(-48 * time.Hour), OSUser: "alice", Profile: "prod", Target: "db1:3306", ProcessID: 1, Outcome: auditOK},
+		{Time: now.Add(-2 * time.Hour), OSUser: "bob", Profile: "prod", Target: "db2:3306", ProcessID: 2, Outcome: auditRefused},
+		{Time: now.Add(-1 * time.Hour), OSUser: "alice", Profile: "staging", Target: "db2:3306", ProcessID: 3, Outcome: auditDryRun},
+		{Time: now.Add(-time.Minute), OSUser: "alice", Profile: "prod", Target: "db1:3306", ProcessID: 4, Outcome: auditOK},
+	}
+
+	cases := []struct {
+		name string
+		cmd  AuditShowCmd
+		want []int64
+	}{
+		{name: "all", want: []int64{1, 2, 3, 4}},
+		{name: "since", cmd: AuditShowCmd{Since: 24 * time.Hour}, want: []int64{2, 3, 4}},
+		{name: "os user", cmd: AuditShowCmd{OSUser: "alice"}, want: []int64{1, 3, 4}},
+		{name: "profile", cmd: AuditShowCmd{Profile: "prod"}, want: []int64{1, 2, 4}},
+		{name: "target", cmd: AuditShowCmd{Target: "db2"}, want: []int64{2, 3}},
+		{name: "outcome", cmd: AuditShowCmd{Outcome: auditOK}, want: []int64{1, 4}},
+		{name: "id", cmd: AuditShowCmd{ProcessID: 3}, want: []int64{3}},
+		{name: "limit keeps the latest", cmd: AuditShowCmd{OSUser: "alice", Limit: 2}, want: []int64{3, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []int64
+			for _, rec := range tc.cmd.filter(records, now) {
+				got = append(got, rec.ProcessID)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadAuditLogInvalid(t *testing.T) {
+	_, err := readAuditLog(strings.NewReader("{\"outcome\":\"ok\"}\n\nnot json\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWriteAuditTable(t *testing.T) {
+	records := []auditRecord{{
+		Time: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC), OSUser: "alice", Target: "db1:3306",
+		SQL: "KILL 42", Outcome: auditError, Error: "Unknown thread id: 42",
+		Process: &auditProcess{User: "app", Host: "10.0.0.5", Info: "SELECT\n  1"},
+	}}
+	var buf bytes.Buffer
+	if err := writeAuditTable(&buf, records); err != nil {
+		t.Fatalf("writeAuditTable: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"OUTCOME", "error: Unknown thread id: 42", "app@10.0.0.5", "SELECT 1"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 )
@@ -13,24 +14,173 @@ type CLI struct {
 	DSN         string `help:"MySQL DSN (overrides config file)."`
 	AllowWriter bool   `help:"Allow connecting to writer/primary (default: reader only)."`
 	Config      string `short:"c" help:"Path to config file (default: auto-detect)."`
+	Verbose     bool   `short:"v" help:"Explain detection decisions (e.g. reader/writer role) on stderr."`
+	Redact      *bool  `negatable:"" help:"Mask literals in displayed SQL (default: redact in config file, else off)."`
 
 	Version kong.VersionFlag `name:"version" help:"Print version information and quit."`
 
-	Kill *KillCmd `cmd:"" help:"Kill a query or connection by process ID."`
-	List *ListCmd `cmd:"" help:"List running queries (from processlist)."`
+	Kill    *KillCmd    `cmd:"" help:"Kill a query or connection by process ID."`
+	List    *ListCmd    `cmd:"" help:"List running queries (from processlist)."`
+	Status  *StatusCmd  `cmd:"" aliases:"whoami" help:"Show the resolved target, its flavor and role, and the current user."`
+	Locks   *LocksCmd   `cmd:"" help:"Show the InnoDB lock-wait tree (who blocks whom)."`
+	MDL     *MDLCmd     `cmd:"" name:"mdl" help:"Show sessions waiting for metadata locks and who holds them."`
+	Top     *TopCmd     `cmd:"" help:"Browse, inspect and kill sessions in an interactive full-screen view."`
+	Explain *ExplainCmd `cmd:"" help:"Show the plan of the statement a process is running."`
+	Watch   *WatchCmd   `cmd:"" help:"Poll the processlist and kill matching sessions (daemon mode)."`
+	Audit   *AuditCmd   `cmd:"" help:"Query the audit log of kill attempts."`
+	Serve   *ServeCmd   `cmd:"" help:"Serve an HTTP/JSON API to list and kill sessions."`
+	Rules   *RulesCmd   `cmd:"" help:"Check the [[rule]] kill rules of the config."`
 }
 
 // KillCmd represents the kill subcommand.
 type KillCmd struct {
-	QueryID   int64 `arg:"" name:"id" help:"MySQL process (query) ID to target."`
-	Kill      bool  `help:"Kill the connection (pt-kill-inspired --kill)."`
-	KillQuery bool  `help:"Kill only the running query (pt-kill-inspired --kill-query)."`
-	DryRun    bool  `help:"Print the SQL/CALL without executing."`
+	QueryID     int64  `arg:"" optional:"" name:"id" help:"MySQL process (query) ID to target."`
+	Kill        bool   `help:"Kill the connection (pt-kill-inspired --kill)."`
+	KillQuery   bool   `help:"Kill only the running query (pt-kill-inspired --kill-query)."`
+	DryRun      bool   `help:"Print the SQL/CALL without executing."`
+	Backend     bool   `help:"ProxySQL: kill the backend thread on the MySQL server instead of the client session."`
+	Blocker     bool   `help:"Treat id as a waiting process and kill the root blocker(s) of its lock wait instead."`
+	Fingerprint string `help:"Kill every session running a query with this fingerprint ID (see list --group-by fingerprint) instead of id."`
+	Victims     string `default:"all" help:"With --fingerprint, sessions to kill among the matches: all, oldest, newest, all-but-oldest, top-N or per-user."`
+	AbortOver   int    `name:"abort-over" placeholder:"N" help:"Kill nothing when more than N sessions would be killed; can only lower abort_over of the config."`
+
+	Wait          bool          `help:"After the kill, poll until each thread is gone or idle, reporting rollback progress."`
+	WaitTimeout   time.Duration `name:"wait-timeout" default:"1m" help:"Fail --wait when a thread is still running after this long."`
+	EscalateAfter time.Duration `name:"escalate-after" placeholder:"DURATION" help:"With --kill-query --wait, kill the connection of a query still running after this long."`
 }
 
 // ListCmd represents the list subcommand.
 type ListCmd struct {
-	Match string `help:"Filter by SQL regex (INFO)."`
+	Match      string        `help:"Filter by SQL regex (INFO)."`
+	User       []string      `sep:"none" help:"Only sessions of this user (repeatable)."`
+	Host       []string      `sep:"none" help:"Only sessions from this client host: name, wildcard (10.0.*) or IPv4 CIDR (10.0.0.0/8) (repeatable)."`
+	DB         []string      `name:"db" sep:"none" help:"Only sessions using this database (repeatable)."`
+	Command    []string      `sep:"none" help:"Only sessions in this command, e.g. Query or Sleep (repeatable)."`
+	State      []string      `sep:"none" help:"Only sessions in this state (repeatable)."`
+	MinTime    time.Duration `name:"min-time" help:"Only sessions in their current state for at least this long, e.g. 30s."`
+	MaxTime    time.Duration `name:"max-time" help:"Only sessions in their current state for at most this long."`
+	IgnoreUser []string      `name:"ignore-user" sep:"none" placeholder:"REGEX" help:"Skip sessions whose user matches this regex (repeatable)."`
+	IgnoreInfo []string      `name:"ignore-info" sep:"none" placeholder:"REGEX" help:"Skip sessions whose SQL (INFO) matches this regex (repeatable)."`
+	Where      string        `placeholder:"EXPR" help:"Filter expression, e.g. 'time>30 && user=~\"^redash\"' (fields: id, user, host, db, command, time, state, info)."`
+	Trx        bool          `help:"Show InnoDB transaction columns (from information_schema.innodb_trx)."`
+	InTrx      bool          `name:"in-trx" help:"Only sessions with an open InnoDB transaction (implies --trx)."`
+	TrxAge     time.Duration `name:"trx-age" help:"Only sessions whose transaction is at least this old, e.g. 30s (implies --in-trx)."`
+	GroupBy    string        `name:"group-by" placeholder:"KEY" help:"Aggregate sessions by fingerprint, user, host, db or state."`
+	Sort       string        `placeholder:"COLUMN" help:"Sort by this column, descending with a leading - (default: -time)."`
+	Columns    []string      `placeholder:"COLUMN,..." help:"Columns to show, in order, e.g. id,user,time,trx_age,fingerprint,info."`
+	Limit      int           `help:"Show at most this many rows (or groups with --group-by)."`
+	Full       bool          `help:"Show the full SQL instead of flattening it to one line and truncating it."`
+	Format     string        `enum:"table,json" default:"table" help:"Output format (table or json)."`
+}
+
+// showTrx reports whether transaction columns are queried.
+func (c *ListCmd) showTrx() bool {
+	if c.Trx || c.InTrx || c.TrxAge > 0 {
+		return true
+	}
+	if col, _, ok := c.sortColumn(); ok && col.Trx {
+		return true
+	}
+	defs := listColumnDefs(killPrivileges{}, false)
+	for _, name := range c.Columns {
+		if col, err := lookupListColumn(defs, strings.TrimSpace(name)); err == nil && col.Trx {
+			return true
+		}
+	}
+	return false
+}
+
+// sortColumn returns the --sort column and direction; ok is false when
+// --sort is unset or names an unknown column.
+func (c *ListCmd) sortColumn() (col listColumn, desc bool, ok bool) {
+	if c.Sort == "" {
+		return listColumn{}, false, false
+	}
+	name, desc := strings.CutPrefix(c.Sort, "-")
+	col, err := lookupListColumn(listColumnDefs(killPrivileges{}, false), name)
+	return col, desc, err == nil
+}
+
+// StatusCmd represents the status subcommand.
+type StatusCmd struct{}
+
+// LocksCmd represents the locks subcommand.
+type LocksCmd struct{}
+
+// MDLCmd represents the mdl subcommand.
+type MDLCmd struct {
+	Waiting   int64 `help:"Only show the holders blocking this waiting process ID."`
+	Kill      bool  `help:"Kill the connections holding the conflicting metadata locks."`
+	KillQuery bool  `help:"Kill only the holders' running queries (does not release transaction-scoped locks)."`
+	DryRun    bool  `help:"Print the SQL/CALL without executing."`
+}
+
+// ExplainCmd represents the explain subcommand.
+type ExplainCmd struct {
+	QueryID int64  `arg:"" name:"id" help:"MySQL process (query) ID to explain."`
+	Format  string `enum:"json,tree" default:"json" help:"Plan format requested from the server (json or tree)."`
+	Raw     bool   `help:"Also print the raw plan document."`
+}
+
+// TopCmd represents the top subcommand. The list filters set the initial
+// filter, which can be changed interactively.
+type TopCmd struct {
+	Interval time.Duration `default:"2s" help:"Refresh interval."`
+
+	ListCmd `embed:""`
+}
+
+// WatchCmd represents the watch subcommand. The list filters select the
+// sessions to kill.
+type WatchCmd struct {
+	Interval    time.Duration `default:"10s" help:"Poll interval."`
+	Kill        bool          `help:"Kill the connections of matching sessions."`
+	KillQuery   bool          `help:"Kill only the running queries of matching sessions."`
+	DryRun      bool          `help:"Print and audit the SQL/CALL without executing."`
+	Rule        string        `default:"watch" help:"Rule name recorded in the audit log and metrics."`
+	Rules       bool          `help:"Apply the [[rule]] entries of the config instead of the flags."`
+	Victims     string        `default:"all" help:"Sessions to kill among the matches: all, oldest, newest, all-but-oldest, top-N, per-user or per-fingerprint."`
+	AbortOver   int           `name:"abort-over" placeholder:"N" help:"Kill nothing and fail the cycle when more than N sessions are picked; abort_over of the config still caps the kills."`
+	Once        bool          `help:"Run a single cycle and exit (batch mode)."`
+	LongTime    time.Duration `name:"long-time" default:"10s" help:"Threshold of the long-running sessions metric."`
+	MetricsAddr string        `name:"metrics-addr" placeholder:"ADDR" help:"Serve Prometheus metrics on /metrics at this address, e.g. :9104."`
+
+	ListCmd `embed:""`
+}
+
+// ServeCmd represents the serve subcommand.
+type ServeCmd struct {
+	Listen string `placeholder:"ADDR" help:"Address to listen on (default: listen in [serve], else 127.0.0.1:8080)."`
+}
+
+// RulesCmd represents the rules subcommand.
+type RulesCmd struct {
+	Test *RulesTestCmd `cmd:"" help:"Show which current sessions each rule would hit, without killing."`
+}
+
+// RulesTestCmd represents the rules test subcommand.
+type RulesTestCmd struct {
+	Rule   []string `placeholder:"NAME" help:"Only test these rules (repeatable)."`
+	Format string   `enum:"table,json" default:"table" help:"Output format (table or json)."`
+}
+
+// AuditCmd represents the audit subcommand.
+type AuditCmd struct {
+	Show *AuditShowCmd `cmd:"" help:"Show recorded kill attempts, oldest first."`
+}
+
+// AuditShowCmd represents the audit show subcommand.
+type AuditShowCmd struct {
+	File      string        `placeholder:"PATH" help:"Audit log to read (default: file in [audit])."`
+	Since     time.Duration `help:"Only attempts made within this long, e.g. 24h."`
+	OSUser    string        `name:"os-user" help:"Only attempts by this OS user."`
+	Caller    string        `help:"Only requests made with this serve API token name."`
+	Profile   string        `help:"Only attempts made with this config profile."`
+	Target    string        `help:"Only attempts against a target address containing this text."`
+	Outcome   string        `enum:"ok,dry-run,error,refused," default:"" help:"Only attempts with this outcome (ok, dry-run, error or refused)."`
+	ProcessID int64         `name:"id" help:"Only attempts on this process ID."`
+	Limit     int           `help:"Show only the last N attempts."`
+	Format    string        `enum:"table,json" default:"table" help:"Output format (table or json lines)."`
 }
 
 // Run executes the selected subcommand.
@@ -40,6 +190,24 @@ func Run(ctx context.Context, cli *CLI, command string) error {
 		return runKill(ctx, cli, cli.Kill)
 	case command == "list":
 		return runList(ctx, cli, cli.List)
+	case command == "status":
+		return runStatus(ctx, cli)
+	case command == "locks":
+		return runLocks(ctx, cli)
+	case command == "mdl":
+		return runMDL(ctx, cli, cli.MDL)
+	case command == "top":
+		return runTop(ctx, cli, cli.Top)
+	case strings.HasPrefix(command, "explain"):
+		return runExplain(ctx, cli, cli.Explain)
+	case command == "watch":
+		return runWatch(ctx, cli, cli.Watch)
+	case command == "rules test":
+		return runRulesTest(ctx, cli, cli.Rules.Test)
+	case command == "serve":
+		return runServe(ctx, cli, cli.Serve)
+	case command == "audit show":
+		return runAuditShow(ctx, cli, cli.Audit.Show)
 	default:
 		return fmt.Errorf("unknown command: %s", command)
 	}
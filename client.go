@@ -0,0 +1,241 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Client lists and kills the sessions of a MySQL server with the same
+// flavor detection, reader guard, privilege check, self-service policy and
+// audit log as the command line. A Client is not safe for concurrent use.
+type Client struct {
+	cfg    AppConfig
+	db     *sql.DB
+	tunnel *sshTunnel
+	f      flavor
+	src    processListSource
+
+	// command names the kills in the audit log.
+	command string
+	au      *auditor
+	allow   func(Process) error
+}
+
+// Filter selects sessions like the list flags do. The zero Filter matches
+// every session.
+type Filter struct {
+	// Match is a regular expression on the SQL text.
+	Match string
+	Users []string
+	// Hosts are client host names, wildcards (10.0.*) or IPv4 CIDRs.
+	Hosts    []string
+	DBs      []string
+	Commands []string
+	States   []string
+	MinTime  time.Duration
+	MaxTime  time.Duration
+	// IgnoreUsers and IgnoreInfos are regular expressions on the user and
+	// the SQL text of sessions to skip.
+	IgnoreUsers []string
+	IgnoreInfos []string
+	// Where is a filter expression, e.g. `time>30 && user=~"^redash"`.
+	Where string
+	// Trx fills in Process.Trx. InTrx and TrxAge imply it.
+	Trx    bool
+	InTrx  bool
+	TrxAge time.Duration
+}
+
+// Result is a kill made, or only planned in a dry run.
+type Result struct {
+	ID     int64
+	SQL    string
+	DryRun bool
+	// Process is the victim as it was before the kill.
+	Process Process
+}
+
+// LoadConfig resolves the config as the command line does without flags:
+// the defaults, overridden by the file at path, or by the default config
+// file when path is empty.
+func LoadConfig(ctx context.Context, path string) (AppConfig, error) {
+	return resolveConfig(ctx, &CLI{Config: path})
+}
+
+// NewClient connects to the server of cfg, through its SSH tunnel if any.
+// ctx bounds the connection setup only. Kills are audited as command "api".
+func NewClient(ctx context.Context, cfg AppConfig) (*Client, error) {
+	if cfg.Target == targetProxySQL {
+		return nil, errors.New("a Client does not support target proxysql")
+	}
+	return newClient(ctx, cfg, "api")
+}
+
+// newClient connects to the target of cfg. With target proxysql the client
+// only holds the admin connection.
+func newClient(ctx context.Context, cfg AppConfig, command string) (*Client, error) {
+	db, tunnel, err := connectTarget(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return openClient(ctx, cfg, db, tunnel, command)
+}
+
+// openClient wraps an open connection, detecting the flavor and processlist
+// source of a MySQL target. It closes the connection on failure.
+func openClient(ctx context.Context, cfg AppConfig, db *sql.DB, tunnel *sshTunnel, command string) (*Client, error) {
+	c := &Client{
+		cfg:     cfg,
+		db:      db,
+		tunnel:  tunnel,
+		command: command,
+		allow:   selfServicePolicy(cfg.SelfService, caller{osUser: currentOSUser()}),
+	}
+	if cfg.Target == targetProxySQL {
+		return c, nil
+	}
+
+	f, err := detectFlavor(ctx, db, cfg.Flavor)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	src, err := resolveProcessListSource(ctx, db, f, cfg)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	c.f, c.src = f, src
+	return c, nil
+}
+
+// Close closes the connection, its SSH tunnel and the audit log.
+func (c *Client) Close() error {
+	c.au.Close()
+	if c.tunnel != nil {
+		c.tunnel.Close()
+	}
+	return c.db.Close()
+}
+
+// Flavor returns the detected server flavor, e.g. "mysql" or "rds".
+func (c *Client) Flavor() string {
+	return c.f.Name()
+}
+
+// ListProcesses returns the sessions matching filter, with their SQL text
+// unredacted. Like the list command, it refuses a writer unless
+// AllowWriter is set.
+func (c *Client) ListProcesses(ctx context.Context, filter Filter) ([]Process, error) {
+	cmd := filter.listCmd()
+	if err := cmd.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := c.checkReader(ctx); err != nil {
+		return nil, err
+	}
+	return fetchProcessList(ctx, c.db, c.f, c.src, cmd)
+}
+
+// Kill kills the connection or the running query of process id after the
+// reader guard, the privilege check and the self-service policy of the
+// config, recording the attempt to its audit log and notifications.
+func (c *Client) Kill(ctx context.Context, id int64, mode Mode) (Result, error) {
+	au, err := c.auditor()
+	if err != nil {
+		return Result{}, err
+	}
+	cmd := &KillCmd{Kill: mode == ModeConnection, KillQuery: mode == ModeQuery}
+	results, err := c.kill(ctx, io.Discard, cmd, id, au)
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+// kill kills process id, every session matching --fingerprint, or with
+// --blocker the root blockers of id, reporting to w and recording the
+// attempts to au.
+func (c *Client) kill(ctx context.Context, w io.Writer, cmd *KillCmd, id int64, au *auditor) ([]Result, error) {
+	verdict, err := c.checkReader(ctx)
+	au.setServer(c.f.Name(), verdict)
+	if err != nil {
+		au.Record(auditRecord{ProcessID: id, DryRun: cmd.DryRun, Outcome: auditRefused, Error: err.Error()}, Process{})
+		return nil, err
+	}
+
+	ids := []int64{id}
+	switch {
+	case cmd.Fingerprint != "":
+		rows, err := fetchProcessList(ctx, c.db, c.f, c.src, &ListCmd{})
+		if err != nil {
+			return nil, err
+		}
+		matches := matchFingerprint(rows, cmd.Fingerprint)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no sessions match fingerprint %s", cmd.Fingerprint)
+		}
+		fmt.Fprintf(w, "fingerprint %s matches %s\n", cmd.Fingerprint, formatIDs(processIDs(matches)))
+		picked := selectVictims(matches, cmd.Victims)
+		ids = processIDs(picked)
+		if len(picked) < len(matches) {
+			fmt.Fprintf(w, "victims %s picks %s\n", cmd.Victims, formatIDs(ids))
+		}
+	case cmd.Blocker:
+		ids, err = rootBlockersOf(ctx, c.db, id)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(w, "process %d is blocked by %s\n", id, formatIDs(ids))
+	}
+
+	return killProcesses(ctx, w, c, cmd, ids, au, c.allow)
+}
+
+// checkReader runs the reader guard of the config on the server.
+func (c *Client) checkReader(ctx context.Context) (roleVerdict, error) {
+	return enforceReader(ctx, c.db, c.f, c.cfg)
+}
+
+// singleConn limits the client to one connection, so CONNECTION_ID() is
+// that of the session running its queries.
+func (c *Client) singleConn() {
+	c.db.SetMaxOpenConns(1)
+}
+
+// auditor returns the auditor of the client, opening the audit log on
+// first use so listing never depends on it.
+func (c *Client) auditor() (*auditor, error) {
+	if c.au == nil {
+		au, err := newAuditor(c.cfg, c.command)
+		if err != nil {
+			return nil, err
+		}
+		c.au = au
+	}
+	return c.au, nil
+}
+
+// listCmd returns the list flags equivalent to f.
+func (f Filter) listCmd() *ListCmd {
+	return &ListCmd{
+		Match:      f.Match,
+		User:       f.Users,
+		Host:       f.Hosts,
+		DB:         f.DBs,
+		Command:    f.Commands,
+		State:      f.States,
+		MinTime:    f.MinTime,
+		MaxTime:    f.MaxTime,
+		IgnoreUser: f.IgnoreUsers,
+		IgnoreInfo: f.IgnoreInfos,
+		Where:      f.Where,
+		Trx:        f.Trx,
+		InTrx:      f.InTrx,
+		TrxAge:     f.TrxAge,
+	}
+}
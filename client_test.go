@@ -0,0 +1,39 @@
+package mysqlkill
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFilterListCmd(t *testing.T) {
+	f := Filter{
+		Match:       "^SELECT",
+		Users:       []string{"app"},
+		Hosts:       []string{"10.0.0.0/8"},
+		MinTime:     30 * time.Second,
+		IgnoreInfos: []string{"PROCESSLIST"},
+		TrxAge:      time.Minute,
+	}
+	cmd := f.listCmd()
+	if cmd.Match != "^SELECT" || !slices.Equal(cmd.User, []string{"app"}) || !slices.Equal(cmd.Host, []string{"10.0.0.0/8"}) ||
+		cmd.MinTime != 30*time.Second || !slices.Equal(cmd.IgnoreInfo, []string{"PROCESSLIST"}) || !cmd.showTrx() {
+		t.Fatalf("unexpected cmd: %+v", cmd)
+	}
+	if err := cmd.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestNewClientProxySQL(t *testing.T) {
+	if _, err := NewClient(context.Background(), AppConfig{Target: targetProxySQL}); err == nil {
+		t.Fatal("expected error for target proxysql")
+	}
+}
+
+func TestModeString(t *testing.T) {
+	if ModeQuery.String() != "query" || ModeConnection.String() != "connection" {
+		t.Fatalf("got %s, %s", ModeQuery, ModeConnection)
+	}
+}
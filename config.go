@@ -36,13 +36,121 @@ type SSHConfig struct {
 	Timeout         time.Duration
 }
 
+// ProxySQLConfig holds settings used when the target is a ProxySQL admin
+// interface. The backend credentials are used to reach the MySQL servers
+// behind ProxySQL when killing a backend thread.
+type ProxySQLConfig struct {
+	BackendUser     string
+	BackendPassword string
+	BackendTLS      string
+}
+
+// AuditConfig holds audit log settings.
+type AuditConfig struct {
+	Enabled bool
+	// File is the JSON-lines audit log; empty disables the file sink.
+	File   string
+	Syslog bool
+}
+
+// NotifyConfig is a webhook notified of kill attempts.
+type NotifyConfig struct {
+	// Type is notifyWebhook or notifySlack.
+	Type string
+	URL  string
+	// Body is the JSON body template of a webhook (default: the audit record).
+	Body string
+	// Text is the message template of a Slack notification.
+	Text    string
+	Headers map[string]string
+	// On lists the audit outcomes notified.
+	On      []string
+	Timeout time.Duration
+	Retries int
+	// Async delivers in the background instead of delaying the command.
+	Async bool
+}
+
+// SelfServiceConfig holds the self-service policy, which limits kills to
+// the caller's own sessions.
+type SelfServiceConfig struct {
+	Enabled bool
+	// MatchOSUser grants each OS user the MySQL user of the same name.
+	MatchOSUser bool
+	// Admins are OS users and serve token names exempt from the policy.
+	Admins     []string
+	Identities []SelfServiceIdentity
+}
+
+// SelfServiceIdentity maps a caller, an OS user or a serve token name, to
+// the sessions it owns: those of its MySQL users or tagged with its tags.
+type SelfServiceIdentity struct {
+	OSUser string
+	Token  string
+	Users  []string
+	// Tags are matched against the comments of the running SQL, e.g.
+	// "redash user_id=42".
+	Tags []string
+}
+
+// ServeConfig holds the settings of the serve API.
+type ServeConfig struct {
+	Listen string
+	// Profiles maps profile names to config files served besides this one.
+	Profiles map[string]string
+	Tokens   []ServeToken
+}
+
+// ServeToken is an API token and what it may access.
+type ServeToken struct {
+	Name  string
+	Token string
+	// Users restricts the MySQL users whose sessions the token may list and
+	// kill; empty allows all.
+	Users []string
+	// Profiles restricts the profiles the token may use; empty allows all.
+	Profiles []string
+}
+
 // AppConfig holds the resolved settings for the application.
 type AppConfig struct {
 	MySQL       MySQLConfig
 	SSH         SSHConfig
+	ProxySQL    ProxySQLConfig
 	AllowWriter bool
+	Target      string
+	Flavor      string
+	Verbose     bool
+	// ProcessListSource selects where processlist rows are read from.
+	ProcessListSource string
+	// Redaction masks SQL text in list, top, explain, locks and mdl output.
+	Redaction redactor
+	// Profile names the config in use: the profile setting, else the config
+	// file name ("default" for an auto-detected one).
+	Profile string
+	Audit   AuditConfig
+	Notify  []NotifyConfig
+	Serve   ServeConfig
+	// SelfService limits kill, top, mdl, watch and serve to the caller's
+	// sessions.
+	SelfService SelfServiceConfig
+	// Rules are the [[rule]] entries of the config and its rules_file.
+	Rules []Rule
+	// AbortOver is the hard cap on the sessions one kill may hit; 0 means
+	// no cap. Flags and rules can only lower it.
+	AbortOver int
 }
 
+// defaultAbortOver is the default hard cap on the sessions one kill may hit.
+const defaultAbortOver = 50
+
+const (
+	// targetMySQL connects directly to a MySQL server (default).
+	targetMySQL = "mysql"
+	// targetProxySQL connects to a ProxySQL admin interface.
+	targetProxySQL = "proxysql"
+)
+
 // resolveConfig builds the application config from TOML file and CLI flags.
 // Precedence: CLI flags > config file > defaults.
 func resolveConfig(ctx context.Context, cli *CLI) (AppConfig, error) {
@@ -56,6 +164,15 @@ func resolveConfig(ctx context.Context, cli *CLI) (AppConfig, error) {
 			Port:    22,
 			Timeout: 10 * time.Second,
 		},
+		Target:            targetMySQL,
+		Flavor:            flavorAuto,
+		ProcessListSource: sourceAuto,
+		Audit: AuditConfig{
+			Enabled: true,
+			File:    defaultAuditFile(),
+		},
+		SelfService: SelfServiceConfig{MatchOSUser: true},
+		AbortOver:   defaultAbortOver,
 	}
 
 	// Set default SSH user from OS.
@@ -72,7 +189,33 @@ func resolveConfig(ctx context.Context, cli *CLI) (AppConfig, error) {
 		return cfg, err
 	}
 	if fileCfg != nil {
+		cfg.Profile = "default"
+		if cli.Config != "" {
+			cfg.Profile = strings.TrimSuffix(filepath.Base(cli.Config), filepath.Ext(cli.Config))
+		}
 		applyFileConfig(&cfg, fileCfg)
+		for _, n := range fileCfg.Notify {
+			nc, err := notifyConfigFromFile(n)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Notify = append(cfg.Notify, nc)
+		}
+		if err := applyFileSelfServiceConfig(&cfg.SelfService, fileCfg.SelfService); err != nil {
+			return cfg, err
+		}
+		for _, r := range fileCfg.MySQLKill.RedactRules {
+			rule, err := newRedactRule(r.Pattern, r.Replacement)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Redaction.Rules = append(cfg.Redaction.Rules, rule)
+		}
+		rules, err := loadRules(fileCfg)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Rules = rules
 	}
 
 	// CLI flags override config file.
@@ -82,9 +225,30 @@ func resolveConfig(ctx context.Context, cli *CLI) (AppConfig, error) {
 	if cli.AllowWriter {
 		cfg.AllowWriter = true
 	}
+	if cli.Redact != nil {
+		cfg.Redaction.Enabled = *cli.Redact
+	}
+	cfg.Verbose = cli.Verbose
+
+	switch cfg.Target {
+	case targetMySQL, targetProxySQL:
+	default:
+		return cfg, fmt.Errorf("unknown target %q: use %q or %q", cfg.Target, targetMySQL, targetProxySQL)
+	}
+
+	if err := validateFlavorName(cfg.Flavor); err != nil {
+		return cfg, err
+	}
+	if err := validateProcessListSource(cfg.ProcessListSource); err != nil {
+		return cfg, err
+	}
+	if cfg.AbortOver < 0 {
+		return cfg, fmt.Errorf("abort_over must not be negative, got %d", cfg.AbortOver)
+	}
 
 	cfg.SSH.KeyPath = expandTilde(cfg.SSH.KeyPath)
 	cfg.SSH.KnownHostsPath = expandTilde(cfg.SSH.KnownHostsPath)
+	cfg.Audit.File = expandTilde(cfg.Audit.File)
 
 	resolved, err := resolvePassword(ctx, cfg.MySQL.Password)
 	if err != nil {
@@ -92,6 +256,28 @@ func resolveConfig(ctx context.Context, cli *CLI) (AppConfig, error) {
 	}
 	cfg.MySQL.Password = resolved
 
+	resolved, err = resolvePassword(ctx, cfg.ProxySQL.BackendPassword)
+	if err != nil {
+		return cfg, fmt.Errorf("resolve proxysql backend password: %w", err)
+	}
+	cfg.ProxySQL.BackendPassword = resolved
+
+	for i := range cfg.Serve.Tokens {
+		resolved, err = resolvePassword(ctx, cfg.Serve.Tokens[i].Token)
+		if err != nil {
+			return cfg, fmt.Errorf("resolve serve token %s: %w", cfg.Serve.Tokens[i].Name, err)
+		}
+		cfg.Serve.Tokens[i].Token = resolved
+	}
+
+	for i := range cfg.Notify {
+		resolved, err = resolvePassword(ctx, cfg.Notify[i].URL)
+		if err != nil {
+			return cfg, fmt.Errorf("resolve notify url: %w", err)
+		}
+		cfg.Notify[i].URL = resolved
+	}
+
 	return cfg, nil
 }
 
@@ -105,6 +291,13 @@ type fileConfig struct {
 	MySQL     fileMySQLConfig     `toml:"mysql"`
 	SSH       fileSSHConfig       `toml:"ssh"`
 	MySQLKill fileMySQLKillConfig `toml:"mysql-kill"`
+	ProxySQL  fileProxySQLConfig  `toml:"proxysql"`
+	Audit     fileAuditConfig     `toml:"audit"`
+	Notify    []fileNotifyConfig  `toml:"notify"`
+	Serve     fileServeConfig     `toml:"serve"`
+
+	SelfService fileSelfServiceConfig `toml:"self_service"`
+	Rules       []fileRule            `toml:"rule"`
 }
 
 type fileMySQLConfig struct {
@@ -128,7 +321,119 @@ type fileSSHConfig struct {
 }
 
 type fileMySQLKillConfig struct {
-	AllowWriter *bool `toml:"allow_writer"`
+	AllowWriter *bool   `toml:"allow_writer"`
+	Target      *string `toml:"target"`
+	Flavor      *string `toml:"flavor"`
+	Profile     *string `toml:"profile"`
+
+	ProcessListSource *string          `toml:"processlist_source"`
+	Redact            *bool            `toml:"redact"`
+	RedactRules       []fileRedactRule `toml:"redact_rules"`
+	RulesFile         *string          `toml:"rules_file"`
+	AbortOver         *int             `toml:"abort_over"`
+}
+
+type fileRedactRule struct {
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+}
+
+type fileAuditConfig struct {
+	Enabled *bool   `toml:"enabled"`
+	File    *string `toml:"file"`
+	Syslog  *bool   `toml:"syslog"`
+}
+
+type fileNotifyConfig struct {
+	Type    string            `toml:"type"`
+	URL     string            `toml:"url"`
+	Body    string            `toml:"body"`
+	Text    string            `toml:"text"`
+	Headers map[string]string `toml:"headers"`
+	On      []string          `toml:"on"`
+	Timeout string            `toml:"timeout"`
+	Retries *int              `toml:"retries"`
+	Async   bool              `toml:"async"`
+}
+
+type fileServeConfig struct {
+	Listen   *string           `toml:"listen"`
+	Profiles map[string]string `toml:"profiles"`
+	Tokens   []fileServeToken  `toml:"tokens"`
+}
+
+type fileServeToken struct {
+	Name     string   `toml:"name"`
+	Token    string   `toml:"token"`
+	Users    []string `toml:"users"`
+	Profiles []string `toml:"profiles"`
+}
+
+type fileSelfServiceConfig struct {
+	Enabled     *bool                     `toml:"enabled"`
+	MatchOSUser *bool                     `toml:"match_os_user"`
+	Admins      []string                  `toml:"admins"`
+	Identities  []fileSelfServiceIdentity `toml:"identities"`
+}
+
+type fileSelfServiceIdentity struct {
+	OSUser string   `toml:"os_user"`
+	Token  string   `toml:"token"`
+	Users  []string `toml:"users"`
+	Tags   []string `toml:"tags"`
+}
+
+type fileRule struct {
+	Name           string     `toml:"name"`
+	Priority       int        `toml:"priority"`
+	Action         string     `toml:"action"`
+	User           stringList `toml:"user"`
+	Host           stringList `toml:"host"`
+	DB             stringList `toml:"db"`
+	Command        stringList `toml:"command"`
+	State          stringList `toml:"state"`
+	MinTime        string     `toml:"min_time"`
+	MaxTime        string     `toml:"max_time"`
+	Match          string     `toml:"match"`
+	IgnoreUser     stringList `toml:"ignore_user"`
+	IgnoreInfo     stringList `toml:"ignore_info"`
+	Where          string     `toml:"where"`
+	InTrx          bool       `toml:"in_trx"`
+	TrxAge         string     `toml:"trx_age"`
+	Victims        string     `toml:"victims"`
+	AbortOver      int        `toml:"abort_over"`
+	MaxVictims     int        `toml:"max_victims"`
+	DryRun         bool       `toml:"dry_run"`
+	AllowWriter    *bool      `toml:"allow_writer"`
+	ProtectedUsers []string   `toml:"protected_users"`
+}
+
+// stringList is a TOML value given as a string or an array of strings.
+type stringList []string
+
+// UnmarshalTOML implements toml.Unmarshaler.
+func (l *stringList) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		*l = stringList{val}
+	case []any:
+		for _, e := range val {
+			s, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("expected strings, got %T", e)
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return fmt.Errorf("expected a string or an array of strings, got %T", v)
+	}
+	return nil
+}
+
+type fileProxySQLConfig struct {
+	BackendUser     *string `toml:"backend_user"`
+	BackendPassword *string `toml:"backend_password"`
+	BackendTLS      *string `toml:"backend_tls"`
 }
 
 // loadConfigFile loads config.toml from the specified path, or from the
@@ -139,7 +444,11 @@ type fileMySQLKillConfig struct {
 func loadConfigFile(configPath string) (*fileConfig, error) {
 	if configPath != "" {
 		var cfg fileConfig
-		if _, err := toml.DecodeFile(configPath, &cfg); err != nil {
+		md, err := toml.DecodeFile(configPath, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("load config file %s: %w", configPath, err)
+		}
+		if err := checkRuleKeys(md); err != nil {
 			return nil, fmt.Errorf("load config file %s: %w", configPath, err)
 		}
 		return &cfg, nil
@@ -169,9 +478,13 @@ func loadConfigFile(configPath string) (*fileConfig, error) {
 	}
 
 	var cfg fileConfig
-	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
 		return nil, err
 	}
+	if err := checkRuleKeys(md); err != nil {
+		return nil, fmt.Errorf("load config file %s: %w", path, err)
+	}
 	return &cfg, nil
 }
 
@@ -180,9 +493,30 @@ func applyFileConfig(cfg *AppConfig, fileCfg *fileConfig) {
 	if fileCfg.MySQLKill.AllowWriter != nil {
 		cfg.AllowWriter = *fileCfg.MySQLKill.AllowWriter
 	}
+	if fileCfg.MySQLKill.Target != nil {
+		cfg.Target = strings.ToLower(*fileCfg.MySQLKill.Target)
+	}
+	if fileCfg.MySQLKill.Flavor != nil {
+		cfg.Flavor = strings.ToLower(*fileCfg.MySQLKill.Flavor)
+	}
+	if fileCfg.MySQLKill.ProcessListSource != nil {
+		cfg.ProcessListSource = strings.ToLower(*fileCfg.MySQLKill.ProcessListSource)
+	}
+	if fileCfg.MySQLKill.Redact != nil {
+		cfg.Redaction.Enabled = *fileCfg.MySQLKill.Redact
+	}
+	if fileCfg.MySQLKill.AbortOver != nil {
+		cfg.AbortOver = *fileCfg.MySQLKill.AbortOver
+	}
+	if fileCfg.MySQLKill.Profile != nil {
+		cfg.Profile = *fileCfg.MySQLKill.Profile
+	}
 
 	applyFileMySQLConfig(&cfg.MySQL, fileCfg.MySQL)
 	applyFileSSHConfig(&cfg.SSH, fileCfg.SSH)
+	applyFileProxySQLConfig(&cfg.ProxySQL, fileCfg.ProxySQL)
+	applyFileAuditConfig(&cfg.Audit, fileCfg.Audit)
+	applyFileServeConfig(&cfg.Serve, fileCfg.Serve)
 }
 
 func applyFileMySQLConfig(cfg *MySQLConfig, fileCfg fileMySQLConfig) {
@@ -233,6 +567,135 @@ func applyFileSSHConfig(cfg *SSHConfig, fileCfg fileSSHConfig) {
 	}
 }
 
+func applyFileProxySQLConfig(cfg *ProxySQLConfig, fileCfg fileProxySQLConfig) {
+	if fileCfg.BackendUser != nil {
+		cfg.BackendUser = *fileCfg.BackendUser
+	}
+	if fileCfg.BackendPassword != nil {
+		cfg.BackendPassword = *fileCfg.BackendPassword
+	}
+	if fileCfg.BackendTLS != nil {
+		cfg.BackendTLS = *fileCfg.BackendTLS
+	}
+}
+
+func applyFileAuditConfig(cfg *AuditConfig, fileCfg fileAuditConfig) {
+	if fileCfg.Enabled != nil {
+		cfg.Enabled = *fileCfg.Enabled
+	}
+	if fileCfg.File != nil {
+		cfg.File = *fileCfg.File
+	}
+	if fileCfg.Syslog != nil {
+		cfg.Syslog = *fileCfg.Syslog
+	}
+}
+
+func applyFileServeConfig(cfg *ServeConfig, fileCfg fileServeConfig) {
+	if fileCfg.Listen != nil {
+		cfg.Listen = *fileCfg.Listen
+	}
+	if fileCfg.Profiles != nil {
+		cfg.Profiles = make(map[string]string, len(fileCfg.Profiles))
+		for name, path := range fileCfg.Profiles {
+			cfg.Profiles[name] = expandTilde(path)
+		}
+	}
+	for _, t := range fileCfg.Tokens {
+		cfg.Tokens = append(cfg.Tokens, ServeToken(t))
+	}
+}
+
+// applyFileSelfServiceConfig validates the [self_service] identities: each
+// names an OS user or a token, not both, and grants users or tags.
+func applyFileSelfServiceConfig(cfg *SelfServiceConfig, fileCfg fileSelfServiceConfig) error {
+	if fileCfg.Enabled != nil {
+		cfg.Enabled = *fileCfg.Enabled
+	}
+	if fileCfg.MatchOSUser != nil {
+		cfg.MatchOSUser = *fileCfg.MatchOSUser
+	}
+	if fileCfg.Admins != nil {
+		cfg.Admins = fileCfg.Admins
+	}
+	for i, id := range fileCfg.Identities {
+		if (id.OSUser == "") == (id.Token == "") {
+			return fmt.Errorf("self_service identity %d: set either os_user or token", i+1)
+		}
+		if len(id.Users) == 0 && len(id.Tags) == 0 {
+			return fmt.Errorf("self_service identity %d: users or tags is required", i+1)
+		}
+		for _, tag := range id.Tags {
+			if strings.TrimSpace(tag) == "" {
+				return fmt.Errorf("self_service identity %d: empty tag", i+1)
+			}
+		}
+		cfg.Identities = append(cfg.Identities, SelfServiceIdentity(id))
+	}
+	return nil
+}
+
+// notifyConfigFromFile validates a [[notify]] entry and fills in defaults:
+// outcomes ok and error, a 5s timeout and 2 retries.
+func notifyConfigFromFile(f fileNotifyConfig) (NotifyConfig, error) {
+	cfg := NotifyConfig{
+		Type:    strings.ToLower(f.Type),
+		URL:     f.URL,
+		Body:    f.Body,
+		Text:    f.Text,
+		Headers: f.Headers,
+		On:      f.On,
+		Timeout: 5 * time.Second,
+		Retries: 2,
+		Async:   f.Async,
+	}
+	switch cfg.Type {
+	case notifyWebhook, notifySlack:
+	default:
+		return cfg, fmt.Errorf("unknown notify type %q: use %q or %q", f.Type, notifyWebhook, notifySlack)
+	}
+	if cfg.URL == "" {
+		return cfg, fmt.Errorf("notify %s: url is required", cfg.Type)
+	}
+	if len(cfg.On) == 0 {
+		cfg.On = []string{auditOK, auditError}
+	}
+	for _, o := range cfg.On {
+		switch o {
+		case auditOK, auditDryRun, auditError, auditRefused:
+		default:
+			return cfg, fmt.Errorf("notify %s: unknown outcome %q in on", cfg.Type, o)
+		}
+	}
+	if f.Timeout != "" {
+		d, err := time.ParseDuration(f.Timeout)
+		if err != nil {
+			return cfg, fmt.Errorf("notify %s: invalid timeout: %w", cfg.Type, err)
+		}
+		cfg.Timeout = d
+	}
+	if f.Retries != nil {
+		if *f.Retries < 0 {
+			return cfg, fmt.Errorf("notify %s: retries must not be negative", cfg.Type)
+		}
+		cfg.Retries = *f.Retries
+	}
+	return cfg, nil
+}
+
+// defaultAuditFile returns the default audit log path:
+// $XDG_STATE_HOME/mysql-kill/audit.jsonl, else
+// ~/.local/state/mysql-kill/audit.jsonl.
+func defaultAuditFile() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "mysql-kill", "audit.jsonl")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "mysql-kill", "audit.jsonl")
+	}
+	return ""
+}
+
 // toInt converts an any (int64 or string) to int.
 func toInt(v any) (int, bool) {
 	if v == nil {
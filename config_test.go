@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildDSN(t *testing.T) {
@@ -194,6 +195,9 @@ func TestResolveConfigDefaults(t *testing.T) {
 	if appCfg.AllowWriter {
 		t.Fatalf("default allow_writer should be false")
 	}
+	if appCfg.AbortOver != defaultAbortOver {
+		t.Fatalf("default abort_over: got %d, want %d", appCfg.AbortOver, defaultAbortOver)
+	}
 }
 
 func TestLoadConfigFileNotFound(t *testing.T) {
@@ -202,3 +206,323 @@ func TestLoadConfigFileNotFound(t *testing.T) {
 		t.Fatalf("expected error for nonexistent config file")
 	}
 }
+
+func TestResolveConfigProxySQLTarget(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "proxysql.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[mysql-kill]
+target = "ProxySQL"
+
+[mysql]
+host = "proxysql-admin"
+port = 6032
+
+[proxysql]
+backend_user = "backend-user"
+backend_password = "backend-pass"
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+
+	if appCfg.Target != targetProxySQL {
+		t.Fatalf("target: got %q, want %q", appCfg.Target, targetProxySQL)
+	}
+	if appCfg.ProxySQL.BackendUser != "backend-user" {
+		t.Fatalf("backend user: got %q, want %q", appCfg.ProxySQL.BackendUser, "backend-user")
+	}
+	if appCfg.ProxySQL.BackendPassword != "backend-pass" {
+		t.Fatalf("backend password: got %q, want %q", appCfg.ProxySQL.BackendPassword, "backend-pass")
+	}
+}
+
+func TestResolveConfigUnknownTarget(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "bad.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[mysql-kill]
+target = "pgbouncer"
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if _, err := resolveConfig(context.Background(), &CLI{Config: configPath}); err == nil {
+		t.Fatalf("expected error for unknown target")
+	}
+}
+
+func TestResolveConfigRedaction(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "redact.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[mysql-kill]
+redact = true
+
+[[mysql-kill.redact_rules]]
+pattern = '[\w.+-]+@[\w-]+\.[\w.]+'
+replacement = "<email>"
+
+[[mysql-kill.redact_rules]]
+pattern = 'token=\w+'
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if !appCfg.Redaction.Enabled || len(appCfg.Redaction.Rules) != 2 {
+		t.Fatalf("unexpected redaction: %+v", appCfg.Redaction)
+	}
+	if got := appCfg.Redaction.Rules[1].Replacement; got != "?" {
+		t.Fatalf("default replacement: got %q", got)
+	}
+
+	off := false
+	appCfg, err = resolveConfig(context.Background(), &CLI{Config: configPath, Redact: &off})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if appCfg.Redaction.Enabled {
+		t.Fatalf("--no-redact should override the config file")
+	}
+
+	if err := os.WriteFile(configPath, []byte(`
+[[mysql-kill.redact_rules]]
+pattern = '('
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := resolveConfig(context.Background(), &CLI{Config: configPath}); err == nil {
+		t.Fatalf("expected invalid rule error")
+	}
+}
+
+func TestResolveConfigAudit(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	configPath := filepath.Join(dir, "prod-replica.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[audit]
+syslog = true
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if appCfg.Profile != "prod-replica" {
+		t.Fatalf("profile: got %q", appCfg.Profile)
+	}
+	want := AuditConfig{Enabled: true, File: filepath.Join(dir, "state", "mysql-kill", "audit.jsonl"), Syslog: true}
+	if appCfg.Audit != want {
+		t.Fatalf("audit: got %+v want %+v", appCfg.Audit, want)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`
+[mysql-kill]
+profile = "replica"
+
+[audit]
+enabled = false
+file = "/var/log/mysql-kill.jsonl"
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	appCfg, err = resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if appCfg.Profile != "replica" || appCfg.Audit.Enabled || appCfg.Audit.File != "/var/log/mysql-kill.jsonl" {
+		t.Fatalf("unexpected config: profile %q audit %+v", appCfg.Profile, appCfg.Audit)
+	}
+}
+
+func TestResolveConfigNotify(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[[notify]]
+type = "slack"
+url = "https://hooks.slack.com/services/T000/B000/XXX"
+
+[[notify]]
+type = "Webhook"
+url = "https://example.com/hook"
+body = '{"text": {{json .SQL}}}'
+headers = { Authorization = "Bearer t0ken" }
+on = ["ok", "error", "refused"]
+timeout = "2s"
+retries = 0
+async = true
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if len(appCfg.Notify) != 2 {
+		t.Fatalf("got %d notify entries", len(appCfg.Notify))
+	}
+	slack := appCfg.Notify[0]
+	if slack.Type != notifySlack || slack.Timeout != 5*time.Second || slack.Retries != 2 || slack.Async ||
+		len(slack.On) != 2 || slack.On[0] != auditOK || slack.On[1] != auditError {
+		t.Fatalf("unexpected slack defaults: %+v", slack)
+	}
+	hook := appCfg.Notify[1]
+	if hook.Type != notifyWebhook || hook.Timeout != 2*time.Second || hook.Retries != 0 || !hook.Async ||
+		len(hook.On) != 3 || hook.Headers["Authorization"] != "Bearer t0ken" {
+		t.Fatalf("unexpected webhook: %+v", hook)
+	}
+
+	for _, bad := range []string{
+		"[[notify]]\ntype = \"email\"\nurl = \"x\"\n",
+		"[[notify]]\ntype = \"slack\"\n",
+		"[[notify]]\ntype = \"slack\"\nurl = \"x\"\non = [\"killed\"]\n",
+		"[[notify]]\ntype = \"slack\"\nurl = \"x\"\ntimeout = \"soon\"\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(bad), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		if _, err := resolveConfig(context.Background(), &CLI{Config: configPath}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestResolveConfigSelfService(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[self_service]
+enabled = true
+admins = ["dba"]
+
+[[self_service.identities]]
+os_user = "alice"
+users = ["alice_ro"]
+
+[[self_service.identities]]
+token = "redash-portal"
+tags = ["redash user_id=42"]
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	ss := appCfg.SelfService
+	if !ss.Enabled || !ss.MatchOSUser || len(ss.Admins) != 1 || len(ss.Identities) != 2 ||
+		ss.Identities[0].OSUser != "alice" || ss.Identities[1].Token != "redash-portal" ||
+		ss.Identities[1].Tags[0] != "redash user_id=42" {
+		t.Fatalf("unexpected self_service: %+v", ss)
+	}
+
+	for _, bad := range []string{
+		"[[self_service.identities]]\nusers = [\"a\"]\n",
+		"[[self_service.identities]]\nos_user = \"a\"\ntoken = \"b\"\nusers = [\"a\"]\n",
+		"[[self_service.identities]]\nos_user = \"a\"\n",
+		"[[self_service.identities]]\nos_user = \"a\"\ntags = [\" \"]\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(bad), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		if _, err := resolveConfig(context.Background(), &CLI{Config: configPath}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestResolveConfigRules(t *testing.T) {
+	dir := t.TempDir()
+	rulesPath := filepath.Join(dir, "rules.toml")
+	if err := os.WriteFile(rulesPath, []byte(`
+[[rule]]
+name = "batch"
+user = ["etl", "report"]
+trx_age = "10m"
+action = "kill"
+max_victims = 3
+victims = "per-user"
+abort_over = 20
+dry_run = true
+`), 0o644); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	configPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configPath, []byte(`
+[mysql-kill]
+rules_file = "`+rulesPath+`"
+abort_over = 0
+
+[[rule]]
+name = "redash-long"
+user = "redash"
+min_time = "5m"
+match = "^SELECT"
+action = "kill-query"
+priority = 10
+allow_writer = true
+protected_users = ["redash_admin"]
+`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	appCfg, err := resolveConfig(context.Background(), &CLI{Config: configPath})
+	if err != nil {
+		t.Fatalf("resolveConfig: %v", err)
+	}
+	if len(appCfg.Rules) != 2 {
+		t.Fatalf("rules = %+v, want 2", appCfg.Rules)
+	}
+	if appCfg.AbortOver != 0 {
+		t.Fatalf("abort_over = %d, want 0", appCfg.AbortOver)
+	}
+	r := appCfg.Rules[0]
+	if r.Name != "redash-long" || r.Action != ruleKillQuery || r.Priority != 10 ||
+		r.Filter.MinTime != 5*time.Minute || r.Filter.Match != "^SELECT" ||
+		len(r.Filter.Users) != 1 || r.Filter.Users[0] != "redash" ||
+		r.AllowWriter == nil || !*r.AllowWriter || r.ProtectedUsers[0] != "redash_admin" {
+		t.Fatalf("unexpected rule: %+v", r)
+	}
+	r = appCfg.Rules[1]
+	if r.Name != "batch" || len(r.Filter.Users) != 2 || r.Filter.TrxAge != 10*time.Minute ||
+		r.MaxVictims != 3 || r.Victims != "per-user" || r.AbortOver != 20 || !r.DryRun || r.AllowWriter != nil {
+		t.Fatalf("unexpected rule: %+v", r)
+	}
+
+	for _, bad := range []string{
+		"[[rule]]\naction = \"kill\"\nmin_time = \"1m\"\n",
+		"[[rule]]\nname = \"a\"\nmin_time = \"1m\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"drop\"\nmin_time = \"1m\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nmin_time = \"soon\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nmin-time = \"1m\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nwhere = \"time >\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nmin_time = \"1m\"\nmax_victims = -1\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nmin_time = \"1m\"\nabort_over = -1\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nmin_time = \"1m\"\nvictims = \"youngest\"\n",
+		"[[rule]]\nname = \"a\"\naction = \"kill\"\nuser = 1\n",
+		"[[rule]]\nname = \"a\"\naction = \"print\"\n[[rule]]\nname = \"a\"\naction = \"print\"\n",
+		"[mysql-kill]\nabort_over = -1\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(bad), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		if _, err := resolveConfig(context.Background(), &CLI{Config: configPath}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package mysqlkill
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 
@@ -16,6 +18,26 @@ type Execer interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
+// connectTarget opens the connection described by cfg, building the DSN from
+// the individual settings if needed. Close it with closeTarget.
+func connectTarget(ctx context.Context, cfg *AppConfig) (*sql.DB, *sshTunnel, error) {
+	if cfg.MySQL.DSN == "" {
+		cfg.MySQL.DSN = buildDSN(cfg.MySQL)
+	}
+	if cfg.MySQL.DSN == "" {
+		return nil, nil, errors.New("connection info missing: provide --dsn flag or config file")
+	}
+	return openDBWithTunnel(ctx, cfg.MySQL, cfg.SSH)
+}
+
+// closeTarget closes a connection opened by connectTarget or openDBWithTunnel.
+func closeTarget(db *sql.DB, tunnel *sshTunnel) {
+	if tunnel != nil {
+		tunnel.Close()
+	}
+	_ = db.Close()
+}
+
 // openDBWithTunnel opens a DB connection, optionally via SSH tunnel.
 func openDBWithTunnel(ctx context.Context, mysqlCfg MySQLConfig, sshCfg SSHConfig) (*sql.DB, *sshTunnel, error) {
 	db, err := sql.Open("mysql", mysqlCfg.DSN)
@@ -112,62 +134,19 @@ func ping(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
-// detectRDS detects Amazon RDS/Aurora based on server metadata.
-func detectRDS(ctx context.Context, db *sql.DB) (bool, error) {
-	var versionComment string
-	if err := db.QueryRowContext(ctx, "SELECT @@version_comment").Scan(&versionComment); err != nil {
-		return false, fmt.Errorf("detect rds (version_comment): %w", err)
-	}
-
-	lower := strings.ToLower(versionComment)
-	if strings.Contains(lower, "amazon rds") || strings.Contains(lower, "aurora") {
-		return true, nil
-	}
-
-	var count int
-	const routinesQuery = `
-SELECT COUNT(*)
-FROM information_schema.routines
-WHERE routine_schema = 'mysql'
-  AND routine_name IN ('rds_kill', 'rds_kill_query')`
-	if err := db.QueryRowContext(ctx, routinesQuery).Scan(&count); err != nil {
-		return false, fmt.Errorf("detect rds (routines): %w", err)
-	}
-
-	return count > 0, nil
-}
-
-// enforceReader rejects writer connections unless allowWriter is true.
-func enforceReader(ctx context.Context, db *sql.DB, allowWriter bool) error {
-	isReader, err := detectReader(ctx, db)
+// enforceReader rejects writer connections unless allowWriter is true and
+// returns the detected role. With verbose, the role and its reason are
+// printed to stderr.
+func enforceReader(ctx context.Context, db *sql.DB, f flavor, cfg AppConfig) (roleVerdict, error) {
+	verdict, err := f.DetectReader(ctx, db)
 	if err != nil {
-		return err
-	}
-	if !isReader && !allowWriter {
-		return fmt.Errorf("writer detected: use --allow-writer to proceed")
-	}
-	return nil
-}
-
-// detectReader determines whether the instance is read-only.
-func detectReader(ctx context.Context, db *sql.DB) (bool, error) {
-	var innodbReadOnly sql.NullInt64
-	var readOnly sql.NullInt64
-
-	if err := db.QueryRowContext(ctx, "SELECT @@innodb_read_only, @@read_only").Scan(&innodbReadOnly, &readOnly); err != nil {
-		return false, fmt.Errorf("detect reader: %w", err)
+		return verdict, err
 	}
-
-	return isReaderFromValues(innodbReadOnly, readOnly), nil
-}
-
-// isReaderFromValues interprets read-only variables as reader or writer.
-func isReaderFromValues(innodbReadOnly sql.NullInt64, readOnly sql.NullInt64) bool {
-	if innodbReadOnly.Valid && innodbReadOnly.Int64 == 1 {
-		return true
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "role: %s\n", verdict)
 	}
-	if readOnly.Valid && readOnly.Int64 == 1 {
-		return true
+	if !verdict.Reader && !cfg.AllowWriter {
+		return verdict, fmt.Errorf("writer detected (%s): use --allow-writer to proceed", verdict.Reason)
 	}
-	return false
+	return verdict, nil
 }
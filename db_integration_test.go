@@ -3,10 +3,13 @@
 package mysqlkill
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,24 +54,24 @@ func TestDetectRDS(t *testing.T) {
 		t.Fatalf("ping failed: %v", err)
 	}
 
-	isRDS, err := detectRDS(ctx, db)
+	f, err := detectFlavor(ctx, db, flavorAuto)
 	if err != nil {
-		t.Fatalf("detectRDS error: %v", err)
+		t.Fatalf("detectFlavor error: %v", err)
 	}
-	if isRDS {
-		t.Fatalf("expected non-RDS by default")
+	if f.Name() != "mysql" {
+		t.Fatalf("expected mysql flavor by default, got %q", f.Name())
 	}
 
 	cleanupRoutines(t, db)
 	createRoutines(t, db)
 	defer cleanupRoutines(t, db)
 
-	isRDS, err = detectRDS(ctx, db)
+	f, err = detectFlavor(ctx, db, flavorAuto)
 	if err != nil {
-		t.Fatalf("detectRDS error after routines: %v", err)
+		t.Fatalf("detectFlavor error after routines: %v", err)
 	}
-	if !isRDS {
-		t.Fatalf("expected RDS detection to be true after creating routines")
+	if f.Name() != "rds" {
+		t.Fatalf("expected rds flavor after creating routines, got %q", f.Name())
 	}
 }
 
@@ -134,3 +137,178 @@ func testEnvIntOr(t *testing.T, key string, fallback int) int {
 	}
 	return fallback
 }
+
+func TestClientListAndKill(t *testing.T) {
+	mysqlCfg := MySQLConfig{
+		Host:     testEnvOr(t, "MYSQL_TEST_HOST", "127.0.0.1"),
+		Port:     testEnvIntOr(t, "MYSQL_TEST_PORT", 3307),
+		User:     testEnvOr(t, "MYSQL_TEST_USER", "root"),
+		Password: testEnvOr(t, "MYSQL_TEST_PASSWORD", "testpass"),
+		DB:       testEnvOr(t, "MYSQL_TEST_DB", "testdb"),
+	}
+	mysqlCfg.DSN = buildDSN(mysqlCfg)
+
+	victim := openTestDB(t, mysqlCfg.DSN)
+	defer func() { _ = victim.Close() }()
+	ctx := context.Background()
+	if err := pingWithRetry(ctx, victim, 30, 1*time.Second); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := victim.ExecContext(ctx, "SELECT SLEEP(30) /* client-test */")
+		done <- err
+	}()
+
+	// The test server is a writer.
+	c, err := NewClient(ctx, AppConfig{MySQL: mysqlCfg, AllowWriter: true})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	var procs []Process
+	for range 50 {
+		procs, err = c.ListProcesses(ctx, Filter{Match: "client-test", Commands: []string{"Query"}, IgnoreInfos: []string{"PROCESSLIST"}})
+		if err != nil {
+			t.Fatalf("ListProcesses: %v", err)
+		}
+		if len(procs) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(procs) != 1 {
+		t.Fatalf("got %d processes", len(procs))
+	}
+
+	res, err := c.Kill(ctx, procs[0].ID, ModeQuery)
+	if err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	if res.ID != procs[0].ID || res.SQL != fmt.Sprintf("KILL QUERY %d", procs[0].ID) || res.DryRun {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("query still running after kill")
+	}
+}
+
+func TestKillWait(t *testing.T) {
+	mysqlCfg := MySQLConfig{
+		Host:     testEnvOr(t, "MYSQL_TEST_HOST", "127.0.0.1"),
+		Port:     testEnvIntOr(t, "MYSQL_TEST_PORT", 3307),
+		User:     testEnvOr(t, "MYSQL_TEST_USER", "root"),
+		Password: testEnvOr(t, "MYSQL_TEST_PASSWORD", "testpass"),
+		DB:       testEnvOr(t, "MYSQL_TEST_DB", "testdb"),
+	}
+	mysqlCfg.DSN = buildDSN(mysqlCfg)
+
+	victim := openTestDB(t, mysqlCfg.DSN)
+	defer func() { _ = victim.Close() }()
+	ctx := context.Background()
+	if err := pingWithRetry(ctx, victim, 30, 1*time.Second); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	conn, err := victim.Conn(ctx)
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	var id int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		t.Fatalf("connection id: %v", err)
+	}
+	go func() { _, _ = conn.ExecContext(ctx, "SELECT SLEEP(30) /* wait-test */") }()
+
+	c, err := NewClient(ctx, AppConfig{MySQL: mysqlCfg, AllowWriter: true})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	for range 50 {
+		s, err := probeThread(ctx, c.db, c.src, id)
+		if err != nil {
+			t.Fatalf("probeThread: %v", err)
+		}
+		if nullString(s.Command) == "Query" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	var out bytes.Buffer
+	cmd := &KillCmd{KillQuery: true, Wait: true, WaitTimeout: 10 * time.Second}
+	results, err := c.kill(ctx, &out, cmd, id, nil)
+	if err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	if err := c.waitResults(ctx, &out, cmd, results, nil); err != nil {
+		t.Fatalf("wait: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), fmt.Sprintf("process %d is idle", id)) {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestExplainInfoKeepsPoolDatabase(t *testing.T) {
+	dsn := buildDSN(MySQLConfig{
+		Host:     testEnvOr(t, "MYSQL_TEST_HOST", "127.0.0.1"),
+		Port:     testEnvIntOr(t, "MYSQL_TEST_PORT", 3307),
+		User:     testEnvOr(t, "MYSQL_TEST_USER", "root"),
+		Password: testEnvOr(t, "MYSQL_TEST_PASSWORD", "testpass"),
+		DB:       testEnvOr(t, "MYSQL_TEST_DB", "testdb"),
+	})
+	db := openTestDB(t, dsn)
+	defer func() { _ = db.Close() }()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	if err := pingWithRetry(ctx, db, 30, 1*time.Second); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if _, err := explainInfo(ctx, db, "mysql", "SELECT 1", explainFormatTree); err != nil {
+		t.Fatalf("explainInfo: %v", err)
+	}
+	var current sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&current); err != nil {
+		t.Fatalf("database: %v", err)
+	}
+	if want := testEnvOr(t, "MYSQL_TEST_DB", "testdb"); current.String != want {
+		t.Fatalf("pool connection left in %q, want %q", current.String, want)
+	}
+}
+
+func TestHostColumnStripsPort(t *testing.T) {
+	dsn := buildDSN(MySQLConfig{
+		Host:     testEnvOr(t, "MYSQL_TEST_HOST", "127.0.0.1"),
+		Port:     testEnvIntOr(t, "MYSQL_TEST_PORT", 3307),
+		User:     testEnvOr(t, "MYSQL_TEST_USER", "root"),
+		Password: testEnvOr(t, "MYSQL_TEST_PASSWORD", "testpass"),
+		DB:       testEnvOr(t, "MYSQL_TEST_DB", "testdb"),
+	})
+	db := openTestDB(t, dsn)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	if err := pingWithRetry(ctx, db, 30, 1*time.Second); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	cases := map[string]string{
+		"10.0.0.5:53412":    "10.0.0.5",
+		"::1:53412":         "::1",
+		"2001:db8::5:40000": "2001:db8::5",
+		"localhost":         "localhost",
+	}
+	for host, want := range cases {
+		var got string
+		if err := db.QueryRowContext(ctx, "SELECT "+hostColumn+" FROM (SELECT ? AS HOST) AS p", host).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	explainFormatJSON = "json"
+	explainFormatTree = "tree"
+)
+
+// Plan sources reported by explain.
+const (
+	planSourceConnection = "EXPLAIN FOR CONNECTION"
+	planSourceInfo       = "EXPLAIN on captured INFO"
+)
+
+// explainableVerbs are the statements EXPLAIN accepts.
+var explainableVerbs = []string{"select", "with", "table", "insert", "replace", "update", "delete", "("}
+
+var (
+	treeTableScan = regexp.MustCompile(`Table scan on ([^<\s]\S*)`)
+	treeTemporary = regexp.MustCompile(`(?i)temporary table|materialize`)
+	treeSort      = regexp.MustCompile(`-> Sort|Sort row IDs`)
+)
+
+// explainResult is the plan of a running statement.
+type explainResult struct {
+	Source string
+	// FallbackReason is why EXPLAIN FOR CONNECTION was not used.
+	FallbackReason string
+	Format         string
+	Raw            string
+	Summary        planSummary
+}
+
+// planSummary is the part of a plan that matters when deciding on a kill.
+type planSummary struct {
+	Cost      string
+	Tables    []planTable
+	TempTable bool
+	Filesort  bool
+}
+
+// planTable is one table access of a plan.
+type planTable struct {
+	Name       string
+	AccessType string
+	Key        string
+	Rows       string
+	Filtered   string
+}
+
+// FullScans returns the tables read with a full table scan.
+func (s planSummary) FullScans() []planTable {
+	var scans []planTable
+	for _, t := range s.Tables {
+		if strings.EqualFold(t.AccessType, "ALL") {
+			scans = append(scans, t)
+		}
+	}
+	return scans
+}
+
+// runExplain executes the explain command.
+func runExplain(ctx context.Context, cli *CLI, cmd *ExplainCmd) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return errors.New("explain is not supported with target proxysql")
+	}
+
+	c, err := newClient(ctx, cfg, "explain")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if _, err := c.checkReader(ctx); err != nil {
+		return err
+	}
+
+	r, err := lookupProcess(ctx, c.db, c.src, cmd.QueryID)
+	if err != nil {
+		return err
+	}
+	res, err := explainSession(ctx, c.db, r, cmd.Format)
+	if err != nil {
+		return err
+	}
+	return writeExplain(os.Stdout, cfg.Redaction.Row(r), cfg.Redaction.Explain(res), cmd.Raw)
+}
+
+// explainSession explains the statement r is running, with EXPLAIN FOR
+// CONNECTION or, where that is not permitted, by explaining its INFO text.
+func explainSession(ctx context.Context, db *sql.DB, r Process, format string) (explainResult, error) {
+	info := nullString(r.Info)
+	if info == "" {
+		return explainResult{}, fmt.Errorf("process %d is not running a statement", r.ID)
+	}
+
+	res := explainResult{Source: planSourceConnection, Format: format}
+	raw, err := explainForConnection(ctx, db, r.ID, format)
+	var myErr *mysql.MySQLError
+	switch {
+	case err == nil && raw != "":
+	case err == nil, errors.As(err, &myErr):
+		if !explainable(info) {
+			return res, fmt.Errorf("process %d is not running an explainable statement", r.ID)
+		}
+		res.Source = planSourceInfo
+		res.FallbackReason = "no plan returned"
+		if err != nil {
+			res.FallbackReason = err.Error()
+		}
+		raw, err = explainInfo(ctx, db, nullString(r.DB), info, format)
+		if err != nil {
+			return res, fmt.Errorf("explain process %d: %w", r.ID, err)
+		}
+	default:
+		return res, fmt.Errorf("explain process %d: %w", r.ID, err)
+	}
+
+	res.Raw = raw
+	if format == explainFormatTree {
+		res.Summary = summarizeTreePlan(raw)
+		return res, nil
+	}
+	res.Summary, err = summarizeJSONPlan(raw)
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// explainForConnection returns the plan of the statement process id is
+// running, or "" when it has none.
+func explainForConnection(ctx context.Context, db *sql.DB, id int64, format string) (string, error) {
+	query := fmt.Sprintf("EXPLAIN FORMAT=%s FOR CONNECTION %d", strings.ToUpper(format), id)
+	var raw string
+	err := db.QueryRowContext(ctx, query).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return raw, err
+}
+
+// explainInfo explains info as if run in schema. The plan may differ from
+// the running one since it is computed now and with this session's settings.
+func explainInfo(ctx context.Context, db *sql.DB, schema, info, format string) (string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", fmt.Errorf("conn: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if schema != "" {
+		// USE changes the default database of the connection, so it is
+		// discarded instead of going back to the pool.
+		defer func() { _ = conn.Raw(func(any) error { return driver.ErrBadConn }) }()
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdentifier(schema)); err != nil {
+			return "", fmt.Errorf("use %s: %w", schema, err)
+		}
+	}
+
+	query := fmt.Sprintf("EXPLAIN FORMAT=%s %s", strings.ToUpper(format), strings.TrimRight(strings.TrimSpace(info), ";"))
+	var raw string
+	if err := conn.QueryRowContext(ctx, query).Scan(&raw); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// explainable reports whether EXPLAIN accepts the statement.
+func explainable(info string) bool {
+	fp := fingerprint(info)
+	for _, verb := range explainableVerbs {
+		if strings.HasPrefix(fp, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteIdentifier quotes a schema or table name.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// summarizeJSONPlan extracts table accesses, temporary tables and filesorts
+// from an EXPLAIN FORMAT=JSON document (MySQL or MariaDB).
+func summarizeJSONPlan(raw string) (planSummary, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return planSummary{}, fmt.Errorf("parse plan: %w", err)
+	}
+
+	var s planSummary
+	if block, ok := jsonObject(doc)["query_block"]; ok {
+		if cost, ok := jsonObject(jsonObject(block)["cost_info"])["query_cost"]; ok {
+			s.Cost = jsonString(cost)
+		}
+	}
+	walkJSONPlan(doc, &s)
+	return s, nil
+}
+
+// walkJSONPlan collects plan nodes from v into s.
+func walkJSONPlan(v any, s *planSummary) {
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			walkJSONPlan(e, s)
+		}
+	case map[string]any:
+		if name, ok := v["table_name"]; ok {
+			t := planTable{
+				Name:       jsonString(name),
+				AccessType: jsonString(v["access_type"]),
+				Key:        jsonString(v["key"]),
+				Rows:       jsonString(v["rows_examined_per_scan"]),
+				Filtered:   jsonString(v["filtered"]),
+			}
+			if t.Rows == "" {
+				t.Rows = jsonString(v["rows"])
+			}
+			s.Tables = append(s.Tables, t)
+		}
+		if jsonBool(v["using_temporary_table"]) || v["temporary_table"] != nil {
+			s.TempTable = true
+		}
+		if jsonBool(v["using_filesort"]) || v["filesort"] != nil {
+			s.Filesort = true
+		}
+		// Sorted for a stable table order; siblings rarely share an object.
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			walkJSONPlan(v[k], s)
+		}
+	}
+}
+
+// summarizeTreePlan extracts full scans, temporary tables and sorts from an
+// EXPLAIN FORMAT=TREE plan.
+func summarizeTreePlan(raw string) planSummary {
+	var s planSummary
+	for _, m := range treeTableScan.FindAllStringSubmatch(raw, -1) {
+		s.Tables = append(s.Tables, planTable{Name: m[1], AccessType: "ALL"})
+	}
+	s.TempTable = treeTemporary.MatchString(raw)
+	s.Filesort = treeSort.MatchString(raw)
+	return s
+}
+
+// jsonObject returns v as an object, or nil.
+func jsonObject(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// jsonString formats a scalar plan value.
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// jsonBool reports whether v is JSON true.
+func jsonBool(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// writeExplain prints the session and its plan.
+func writeExplain(w io.Writer, r Process, res explainResult, raw bool) error {
+	if _, err := fmt.Fprintf(w, "process %d  %s@%s  db=%s  time=%ss\nINFO: %s\n",
+		r.ID, nullString(r.User), nullString(r.Host), nullString(r.DB), nullInt(r.Time),
+		flattenSpace(nullString(r.Info))); err != nil {
+		return err
+	}
+	return writePlan(w, res, raw)
+}
+
+// writePlan prints the plan summary and, with raw or the tree format, the
+// plan itself.
+func writePlan(w io.Writer, res explainResult, raw bool) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "plan: %s (%s)\n", res.Source, res.Format)
+	if res.FallbackReason != "" {
+		fmt.Fprintf(&b, "note: EXPLAIN FOR CONNECTION unavailable (%s); the plan may differ from the running one\n", res.FallbackReason)
+	}
+	if res.Summary.Cost != "" {
+		fmt.Fprintf(&b, "cost: %s\n", res.Summary.Cost)
+	}
+
+	if res.Format == explainFormatTree || raw {
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimRight(res.Raw, "\n"))
+	}
+
+	if res.Format == explainFormatJSON && len(res.Summary.Tables) > 0 {
+		b.WriteString("\n")
+		tw := tabwriter.NewWriter(&b, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TABLE\tACCESS\tKEY\tROWS\tFILTERED")
+		for _, t := range res.Summary.Tables {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.Name, t.AccessType, t.Key, t.Rows, t.Filtered)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	b.WriteString("\n")
+	warnings := planWarnings(res.Summary)
+	if len(warnings) == 0 {
+		b.WriteString("no full table scans, temporary tables or filesorts\n")
+	}
+	for _, warn := range warnings {
+		fmt.Fprintf(&b, "! %s\n", warn)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// planWarnings lists the costly operations of a plan.
+func planWarnings(s planSummary) []string {
+	var warnings []string
+	for _, t := range s.FullScans() {
+		warn := "full table scan on " + t.Name
+		if t.Rows != "" {
+			warn += fmt.Sprintf(" (~%s rows)", t.Rows)
+		}
+		warnings = append(warnings, warn)
+	}
+	if s.TempTable {
+		warnings = append(warnings, "uses a temporary table")
+	}
+	if s.Filesort {
+		warnings = append(warnings, "uses a filesort")
+	}
+	return warnings
+}
@@ -0,0 +1,139 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testJSONPlan = `{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "10245.30"},
+    "ordering_operation": {
+      "using_filesort": true,
+      "grouping_operation": {
+        "using_temporary_table": true,
+        "nested_loop": [
+          {"table": {"table_name": "o", "access_type": "ALL", "rows_examined_per_scan": 98213, "filtered": "10.00"}},
+          {"table": {"table_name": "u", "access_type": "eq_ref", "key": "PRIMARY", "rows_examined_per_scan": 1, "filtered": "100.00"}}
+        ]
+      }
+    }
+  }
+}`
+
+func TestSummarizeJSONPlan(t *testing.T) {
+	s, err := summarizeJSONPlan(testJSONPlan)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	want := planSummary{
+		Cost: "10245.30",
+		Tables: []planTable{
+			{Name: "o", AccessType: "ALL", Rows: "98213", Filtered: "10.00"},
+			{Name: "u", AccessType: "eq_ref", Key: "PRIMARY", Rows: "1", Filtered: "100.00"},
+		},
+		TempTable: true,
+		Filesort:  true,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("got %+v want %+v", s, want)
+	}
+
+	if _, err := summarizeJSONPlan("not json"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
+
+func TestSummarizeJSONPlanMariaDB(t *testing.T) {
+	const plan = `{"query_block": {"select_id": 1, "filesort": {"sort_key": "t.a", "temporary_table": {"table": {"table_name": "t", "access_type": "ALL", "rows": 500}}}}}`
+	s, err := summarizeJSONPlan(plan)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if !s.Filesort || !s.TempTable || len(s.FullScans()) != 1 || s.Tables[0].Rows != "500" {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+}
+
+func TestSummarizeTreePlan(t *testing.T) {
+	const plan = `-> Sort: o.created_at DESC
+    -> Table scan on <temporary>
+        -> Aggregate using temporary table
+            -> Table scan on o  (cost=9921 rows=98213)`
+	s := summarizeTreePlan(plan)
+	if !s.Filesort || !s.TempTable {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	var names []string
+	for _, tbl := range s.FullScans() {
+		names = append(names, tbl.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"o"}) {
+		t.Fatalf("unexpected scans: %v", names)
+	}
+}
+
+func TestExplainable(t *testing.T) {
+	cases := map[string]bool{
+		"/* redash */ SELECT 1":                true,
+		"with x as (select 1) select * from x": true,
+		"UPDATE t SET a = 1":                   true,
+		"ALTER TABLE t ADD COLUMN c INT":       false,
+		"COMMIT":                               false,
+	}
+	for info, want := range cases {
+		if got := explainable(info); got != want {
+			t.Fatalf("%q: got %v want %v", info, got, want)
+		}
+	}
+}
+
+func TestWriteExplain(t *testing.T) {
+	s, err := summarizeJSONPlan(testJSONPlan)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	r := Process{
+		ID:   42,
+		User: sql.NullString{String: "app", Valid: true},
+		Host: sql.NullString{String: "10.0.0.1:5000", Valid: true},
+		DB:   sql.NullString{String: "shop", Valid: true},
+		Time: sql.NullInt64{Int64: 30, Valid: true},
+		Info: sql.NullString{String: "SELECT *\n  FROM o", Valid: true},
+	}
+	res := explainResult{Source: planSourceInfo, FallbackReason: "Error 1095: You are not owner of thread 42", Format: explainFormatJSON, Summary: s}
+
+	var buf bytes.Buffer
+	if err := writeExplain(&buf, r, res, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := `process 42  app@10.0.0.1:5000  db=shop  time=30s
+INFO: SELECT * FROM o
+plan: EXPLAIN on captured INFO (json)
+note: EXPLAIN FOR CONNECTION unavailable (Error 1095: You are not owner of thread 42); the plan may differ from the running one
+cost: 10245.30
+
+TABLE  ACCESS  KEY      ROWS   FILTERED
+o      ALL              98213  10.00
+u      eq_ref  PRIMARY  1      100.00
+
+! full table scan on o (~98213 rows)
+! uses a temporary table
+! uses a filesort
+`
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writePlan(&buf, explainResult{Source: planSourceConnection, Format: explainFormatJSON}, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(buf.String(), "no full table scans, temporary tables or filesorts") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
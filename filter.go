@@ -0,0 +1,392 @@
+package mysqlkill
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostColumn is the information_schema client host without its port. Only
+// the text after the last colon is dropped, so IPv6 hosts such as
+// "::1:53412" keep their address.
+const hostColumn = "SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST)))"
+
+// filterFields maps --where fields to processlist columns.
+var filterFields = map[string]struct {
+	column  string
+	numeric bool
+}{
+	"id":      {column: "ID", numeric: true},
+	"user":    {column: "USER"},
+	"host":    {column: "HOST"},
+	"db":      {column: "DB"},
+	"command": {column: "COMMAND"},
+	"time":    {column: "TIME", numeric: true},
+	"state":   {column: "STATE"},
+	"info":    {column: "INFO"},
+}
+
+// validate checks the filters before connecting, so mistakes are reported
+// without touching the server.
+func (c *ListCmd) validate() error {
+	if err := validateGroupBy(c.GroupBy); err != nil {
+		return err
+	}
+	if c.GroupBy != "" && (c.Sort != "" || len(c.Columns) > 0) {
+		return errors.New("--sort and --columns are not supported with --group-by")
+	}
+	if c.Limit < 0 {
+		return errors.New("--limit must not be negative")
+	}
+	defs := listColumnDefs(killPrivileges{}, false)
+	if c.Sort != "" {
+		if _, err := lookupListColumn(defs, strings.TrimPrefix(c.Sort, "-")); err != nil {
+			return fmt.Errorf("invalid --sort: %w", err)
+		}
+	}
+	for _, name := range c.Columns {
+		if _, err := lookupListColumn(defs, strings.TrimSpace(name)); err != nil {
+			return fmt.Errorf("invalid --columns: %w", err)
+		}
+	}
+	_, _, err := c.filterConditions(processListSource{})
+	return err
+}
+
+// hasServerFilters reports whether filters beyond --match are set. They are
+// evaluated by MySQL and unavailable on ProxySQL.
+func (c *ListCmd) hasServerFilters() bool {
+	return len(c.User) > 0 || len(c.Host) > 0 || len(c.DB) > 0 || len(c.Command) > 0 ||
+		len(c.State) > 0 || c.MinTime > 0 || c.MaxTime > 0 ||
+		len(c.IgnoreUser) > 0 || len(c.IgnoreInfo) > 0 || c.Where != ""
+}
+
+// filterConditions returns the WHERE conditions and args of the session
+// filters on src. Values of a repeated flag are ORed; all conditions are
+// ANDed.
+func (c *ListCmd) filterConditions(src processListSource) ([]string, []any, error) {
+	var where []string
+	var args []any
+
+	for _, f := range []struct {
+		column string
+		values []string
+	}{
+		{column: "USER", values: c.User},
+		{column: "DB", values: c.DB},
+		{column: "COMMAND", values: c.Command},
+		{column: "STATE", values: c.State},
+	} {
+		if len(f.values) == 0 {
+			continue
+		}
+		where = append(where, f.column+" IN ("+placeholders(len(f.values))+")")
+		for _, v := range f.values {
+			args = append(args, v)
+		}
+	}
+
+	if len(c.Host) > 0 {
+		var or []string
+		for _, pattern := range c.Host {
+			cond, condArgs, err := hostCondition(pattern, src.hostColumn())
+			if err != nil {
+				return nil, nil, err
+			}
+			or = append(or, cond)
+			args = append(args, condArgs...)
+		}
+		where = append(where, orGroup(or))
+	}
+
+	if c.MinTime > 0 {
+		where = append(where, "TIME >= ?")
+		args = append(args, int64(c.MinTime/time.Second))
+	}
+	if c.MaxTime > 0 {
+		where = append(where, "TIME <= ?")
+		args = append(args, int64(c.MaxTime/time.Second))
+	}
+
+	for _, re := range c.IgnoreUser {
+		where = append(where, "(USER IS NULL OR USER NOT REGEXP ?)")
+		args = append(args, re)
+	}
+	for _, re := range c.IgnoreInfo {
+		where = append(where, "(INFO IS NULL OR INFO NOT REGEXP ?)")
+		args = append(args, re)
+	}
+
+	if c.Where != "" {
+		cond, condArgs, err := compileFilterExpr(c.Where, src.hostColumn())
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --where: %w", err)
+		}
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	return where, args, nil
+}
+
+// hostCondition matches the client host column against an IPv4 CIDR, a
+// wildcard pattern (*) or an exact host name.
+func hostCondition(pattern, column string) (string, []any, error) {
+	if strings.Contains(pattern, "/") {
+		_, ipNet, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid --host %q: %w", pattern, err)
+		}
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			return "", nil, fmt.Errorf("invalid --host %q: only IPv4 CIDRs are supported", pattern)
+		}
+		first := binary.BigEndian.Uint32(ip)
+		last := first | ^binary.BigEndian.Uint32(net.IP(ipNet.Mask).To4())
+		return "INET_ATON(" + column + ") BETWEEN ? AND ?", []any{int64(first), int64(last)}, nil
+	}
+	if strings.Contains(pattern, "*") {
+		like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%").Replace(pattern)
+		return column + " LIKE ?", []any{like}, nil
+	}
+	return column + " = ?", []any{pattern}, nil
+}
+
+// placeholders returns n comma-separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// orGroup joins conditions with OR, parenthesized when there are several.
+func orGroup(conds []string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
+
+// filterToken is a token of a --where expression.
+type filterToken struct {
+	kind  string // "ident", "number", "string", "op" or "eof"
+	text  string
+	value any
+	pos   int
+}
+
+// filterOps are the operators of --where, longest first.
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "=", "<", ">", "!", "(", ")"}
+
+// lexFilterExpr splits a --where expression into tokens.
+func lexFilterExpr(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case isSpaceByte(c):
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: "string", text: s[i : j+1], value: b.String(), pos: i})
+			i = j + 1
+		case isDigitByte(c):
+			j := i
+			for j < len(s) && isDigitByte(s[j]) {
+				j++
+			}
+			n, err := strconv.ParseInt(s[i:j], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", s[i:j])
+			}
+			tokens = append(tokens, filterToken{kind: "number", text: s[i:j], value: n, pos: i})
+			i = j
+		case isIdentByte(c):
+			j := i
+			for j < len(s) && isIdentByte(s[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: "ident", text: strings.ToLower(s[i:j]), pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: "eof", pos: len(s)}), nil
+}
+
+// filterParser compiles a --where expression into SQL with bound args.
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | "(" expr ")" | field op value
+//	op      = "=" | "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~"
+//
+// Every comparison evaluates to true or false, never NULL, so negation
+// behaves as expected on NULL columns such as DB or INFO.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	args   []any
+	// host is the column the host field compares.
+	host string
+}
+
+// compileFilterExpr compiles a --where expression, comparing the host field
+// against the host column.
+func compileFilterExpr(s, host string) (string, []any, error) {
+	tokens, err := lexFilterExpr(s)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &filterParser{tokens: tokens, host: host}
+	cond, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return "", nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return cond, p.args, nil
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == "op" && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (string, error) {
+	if p.accept("!") {
+		cond, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + cond, nil
+	}
+	if p.accept("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if !p.accept(")") {
+			t := p.peek()
+			return "", fmt.Errorf("expected ) at %d", t.pos)
+		}
+		return cond, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	t := p.next()
+	if t.kind != "ident" {
+		return "", fmt.Errorf("expected a field at %d", t.pos)
+	}
+	field, ok := filterFields[t.text]
+	if !ok {
+		return "", fmt.Errorf("unknown field %q (fields: id, user, host, db, command, time, state, info)", t.text)
+	}
+
+	op := p.next()
+	if op.kind != "op" {
+		return "", fmt.Errorf("expected an operator after %s at %d", t.text, op.pos)
+	}
+
+	v := p.next()
+	if v.kind != "number" && v.kind != "string" {
+		return "", fmt.Errorf("expected a value after %s %s at %d", t.text, op.text, v.pos)
+	}
+	if field.numeric && v.kind != "number" && op.text != "=~" && op.text != "!~" {
+		return "", errors.New(t.text + " takes a number")
+	}
+	p.args = append(p.args, v.value)
+
+	col := field.column
+	if col == "HOST" {
+		col = p.host
+	}
+	switch op.text {
+	case "=", "==":
+		return col + " <=> ?", nil
+	case "!=":
+		return "NOT (" + col + " <=> ?)", nil
+	case "<", "<=", ">", ">=":
+		if !field.numeric {
+			return "", fmt.Errorf("%s does not support %s", t.text, op.text)
+		}
+		return "COALESCE(" + col + " " + op.text + " ?, FALSE)", nil
+	case "=~":
+		return "COALESCE(" + col + " REGEXP ?, FALSE)", nil
+	case "!~":
+		return "NOT COALESCE(" + col + " REGEXP ?, FALSE)", nil
+	default:
+		return "", fmt.Errorf("unexpected operator %q at %d", op.text, op.pos)
+	}
+}
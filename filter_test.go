@@ -0,0 +1,156 @@
+package mysqlkill
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterConditions(t *testing.T) {
+	cmd := &ListCmd{
+		User:       []string{"app", "batch"},
+		Command:    []string{"Query"},
+		Host:       []string{"10.0.0.0/8", "web-*.example.com"},
+		MinTime:    30 * time.Second,
+		MaxTime:    time.Hour,
+		IgnoreUser: []string{"^system"},
+		IgnoreInfo: []string{"(?i)^select sleep", "mysqldump, "},
+	}
+
+	where, args, err := cmd.filterConditions(processListSource{})
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	wantWhere := []string{
+		"USER IN (?, ?)",
+		"COMMAND IN (?)",
+		"(INET_ATON(SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST)))) BETWEEN ? AND ? OR SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) LIKE ?)",
+		"TIME >= ?",
+		"TIME <= ?",
+		"(USER IS NULL OR USER NOT REGEXP ?)",
+		"(INFO IS NULL OR INFO NOT REGEXP ?)",
+		"(INFO IS NULL OR INFO NOT REGEXP ?)",
+	}
+	wantArgs := []any{"app", "batch", "Query", int64(0x0A000000), int64(0x0AFFFFFF), `web-%.example.com`,
+		int64(30), int64(3600), "^system", "(?i)^select sleep", "mysqldump, "}
+	if !reflect.DeepEqual(where, wantWhere) {
+		t.Fatalf("where mismatch:\n%q\n!=\n%q", where, wantWhere)
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("args mismatch: %#v != %#v", args, wantArgs)
+	}
+}
+
+func TestHostCondition(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		wantCond string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{pattern: "db-1", wantCond: "SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) = ?", wantArgs: []any{"db-1"}},
+		{pattern: "10.1.*", wantCond: "SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) LIKE ?", wantArgs: []any{"10.1.%"}},
+		{pattern: "app_*", wantCond: "SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) LIKE ?", wantArgs: []any{`app\_%`}},
+		{pattern: "192.168.1.17/28", wantCond: "INET_ATON(SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST)))) BETWEEN ? AND ?", wantArgs: []any{int64(0xC0A80110), int64(0xC0A8011F)}},
+		{pattern: "::1", wantCond: "SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) = ?", wantArgs: []any{"::1"}},
+		{pattern: "fd00::/8", wantErr: true},
+		{pattern: "10.0.0.0/33", wantErr: true},
+	}
+	for _, tc := range cases {
+		cond, args, err := hostCondition(tc.pattern, hostColumn)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error", tc.pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.pattern, err)
+		}
+		if cond != tc.wantCond || !reflect.DeepEqual(args, tc.wantArgs) {
+			t.Fatalf("%s: got %q %#v", tc.pattern, cond, args)
+		}
+	}
+}
+
+func TestCompileFilterExpr(t *testing.T) {
+	cases := []struct {
+		expr     string
+		wantCond string
+		wantArgs []any
+	}{
+		{
+			expr:     `time>30 && user=~"^redash"`,
+			wantCond: "(COALESCE(TIME > ?, FALSE) AND COALESCE(USER REGEXP ?, FALSE))",
+			wantArgs: []any{int64(30), "^redash"},
+		},
+		{
+			expr:     `command = 'Sleep' || !(db == "shop" && info !~ 'x\'y')`,
+			wantCond: "(COMMAND <=> ? OR NOT (DB <=> ? AND NOT COALESCE(INFO REGEXP ?, FALSE)))",
+			wantArgs: []any{"Sleep", "shop", "x'y"},
+		},
+		{
+			expr:     `Host != "10.0.0.1" && ID <= 100 || state = "Locked"`,
+			wantCond: "((NOT (SUBSTRING(HOST, 1, CHAR_LENGTH(HOST) - LOCATE(':', REVERSE(HOST))) <=> ?) AND COALESCE(ID <= ?, FALSE)) OR STATE <=> ?)",
+			wantArgs: []any{"10.0.0.1", int64(100), "Locked"},
+		},
+	}
+	for _, tc := range cases {
+		cond, args, err := compileFilterExpr(tc.expr, hostColumn)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if cond != tc.wantCond {
+			t.Fatalf("%s:\n%s\n!=\n%s", tc.expr, cond, tc.wantCond)
+		}
+		if !reflect.DeepEqual(args, tc.wantArgs) {
+			t.Fatalf("%s: args %#v != %#v", tc.expr, args, tc.wantArgs)
+		}
+	}
+}
+
+func TestCompileFilterExprErrors(t *testing.T) {
+	cases := map[string]string{
+		`time > "30"`:       "takes a number",
+		`user > "a"`:        "does not support",
+		`rows > 1`:          "unknown field",
+		`time > 1 &&`:       "expected a field",
+		`(time > 1`:         "expected )",
+		`user = "x`:         "unterminated string",
+		`time > 1 user = 1`: "unexpected",
+		`time # 1`:          "unexpected",
+	}
+	for expr, want := range cases {
+		_, _, err := compileFilterExpr(expr, hostColumn)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
+
+func TestListCmdValidate(t *testing.T) {
+	if err := (&ListCmd{Where: "time >"}).validate(); err == nil || !strings.Contains(err.Error(), "invalid --where") {
+		t.Fatalf("expected --where error, got %v", err)
+	}
+	if err := (&ListCmd{Host: []string{"10.0.0.0/99"}}).validate(); err == nil {
+		t.Fatalf("expected --host error")
+	}
+	if err := (&ListCmd{User: []string{"app"}, Where: "time > 1"}).validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListCmdValidateOutputOptions(t *testing.T) {
+	cases := map[string]ListCmd{
+		"invalid --sort":       {Sort: "-nope"},
+		"invalid --columns":    {Columns: []string{"id", "nope"}},
+		"not supported with":   {GroupBy: "user", Sort: "time"},
+		"must not be negative": {Limit: -1},
+	}
+	for want, cmd := range cases {
+		if err := cmd.validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%+v: expected error containing %q, got %v", cmd, want, err)
+		}
+	}
+}
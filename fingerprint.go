@@ -0,0 +1,155 @@
+package mysqlkill
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	fingerprintInList = regexp.MustCompile(`\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintValues = regexp.MustCompile(`\bvalues\s*\(\s*\?(?:\s*,\s*\?)*\s*\)(?:\s*,\s*\(\s*\?(?:\s*,\s*\?)*\s*\))*`)
+)
+
+// fingerprint normalizes a query so that statements differing only in
+// literals, comments, whitespace or IN-list length compare equal, in the
+// spirit of pt-fingerprint: literals become ?, IN (...) lists and
+// multi-row VALUES collapse to (?+), comments are removed and the text is
+// lowercased with whitespace collapsed.
+func fingerprint(query string) string {
+	s := replaceLiterals(query, true)
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimRight(s, "; ")
+	s = fingerprintInList.ReplaceAllString(s, "in(?+)")
+	s = fingerprintValues.ReplaceAllString(s, "values(?+)")
+	return s
+}
+
+// replaceLiterals replaces string, numeric and hex literals in query with ?.
+// With normalize, comments are dropped and text outside quoted identifiers
+// is lowercased; otherwise the rest of the query is kept as is.
+func replaceLiterals(query string, normalize bool) string {
+	var b strings.Builder
+	q := query
+	for i := 0; i < len(q); {
+		c := q[i]
+		var next byte
+		if i+1 < len(q) {
+			next = q[i+1]
+		}
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(q, i)
+			b.WriteByte('?')
+		case c == '`':
+			j := strings.IndexByte(q[i+1:], '`')
+			if j < 0 {
+				b.WriteString(q[i:])
+				i = len(q)
+				break
+			}
+			b.WriteString(q[i : i+j+2])
+			i += j + 2
+		case c == '/' && next == '*':
+			end := len(q)
+			if j := strings.Index(q[i+2:], "*/"); j >= 0 {
+				end = i + j + 4
+			}
+			if normalize {
+				b.WriteByte(' ')
+			} else {
+				b.WriteString(q[i:end])
+			}
+			i = end
+		case c == '#' || (c == '-' && next == '-' && (i+2 >= len(q) || isSpaceByte(q[i+2]))):
+			end := len(q)
+			if j := strings.IndexByte(q[i:], '\n'); j >= 0 {
+				end = i + j
+			}
+			if normalize {
+				b.WriteByte(' ')
+			} else {
+				b.WriteString(q[i:end])
+			}
+			i = end
+		case isDigitByte(c) && (i == 0 || !isIdentByte(q[i-1])):
+			i = skipNumber(q, i)
+			b.WriteByte('?')
+		default:
+			if normalize && c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// fingerprintID returns a short stable identifier of a query's fingerprint,
+// or "" for an empty query.
+func fingerprintID(query string) string {
+	fp := fingerprint(query)
+	if fp == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fp))
+	return strings.ToUpper(hex.EncodeToString(sum[:8]))
+}
+
+// skipQuoted returns the index after the string literal starting at i,
+// honoring backslash escapes and doubled quotes.
+func skipQuoted(q string, i int) int {
+	quote := q[i]
+	j := i + 1
+	for j < len(q) {
+		switch {
+		case q[j] == '\\':
+			j += 2
+		case q[j] == quote && j+1 < len(q) && q[j+1] == quote:
+			j += 2
+		case q[j] == quote:
+			return j + 1
+		default:
+			j++
+		}
+	}
+	return len(q)
+}
+
+// skipNumber returns the index after the numeric literal starting at i.
+func skipNumber(q string, i int) int {
+	j := i
+	if q[j] == '0' && j+1 < len(q) && (q[j+1] == 'x' || q[j+1] == 'X' || q[j+1] == 'b' || q[j+1] == 'B') {
+		j += 2
+		for j < len(q) && isIdentByte(q[j]) {
+			j++
+		}
+		return j
+	}
+	for j < len(q) && (isDigitByte(q[j]) || q[j] == '.') {
+		j++
+	}
+	if j < len(q) && (q[j] == 'e' || q[j] == 'E') {
+		k := j + 1
+		if k < len(q) && (q[k] == '+' || q[k] == '-') {
+			k++
+		}
+		if k < len(q) && isDigitByte(q[k]) {
+			j = k
+			for j < len(q) && isDigitByte(q[j]) {
+				j++
+			}
+		}
+	}
+	return j
+}
+
+func isDigitByte(c byte) bool { return c >= '0' && c <= '9' }
+
+func isSpaceByte(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || isDigitByte(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
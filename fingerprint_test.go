@@ -0,0 +1,72 @@
+package mysqlkill
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "literals",
+			query: "SELECT * FROM users WHERE id = 42 AND email = 'a@example.com'",
+			want:  "select * from users where id = ? and email = ?",
+		},
+		{
+			name:  "in list",
+			query: "SELECT name FROM t1 WHERE id IN (1, 2, 3,4)",
+			want:  "select name from t1 where id in(?+)",
+		},
+		{
+			name:  "comments and whitespace",
+			query: "/* redash user_id=42 */ SELECT\n\tcount(*)  FROM orders -- dashboard\n WHERE created_at > \"2024-01-01\";",
+			want:  "select count(*) from orders where created_at > ?",
+		},
+		{
+			name:  "multi-row values",
+			query: "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y')",
+			want:  "insert into t (a, b) values(?+)",
+		},
+		{
+			name:  "escaped quotes",
+			query: `SELECT 'it''s', 'a\'b' FROM dual`,
+			want:  "select ?, ? from dual",
+		},
+		{
+			name:  "identifiers with digits and numbers",
+			query: "SELECT col_2, 1.5e3, 0xFF FROM `Table9` WHERE x = -7",
+			want:  "select col_2, ?, ? from `Table9` where x = -?",
+		},
+		{
+			name:  "empty",
+			query: "",
+			want:  "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fingerprint(tc.query); got != tc.want {
+				t.Fatalf("got %q want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintID(t *testing.T) {
+	a := fingerprintID("SELECT * FROM t WHERE id IN (1,2)")
+	b := fingerprintID("select *\nfrom t where id in (7, 8, 9)")
+	if a == "" || a != b {
+		t.Fatalf("expected equal non-empty ids, got %q and %q", a, b)
+	}
+	if len(a) != 16 {
+		t.Fatalf("expected 16 hex chars, got %q", a)
+	}
+	if c := fingerprintID("SELECT * FROM u WHERE id IN (1,2)"); c == a {
+		t.Fatalf("different queries should have different ids")
+	}
+	if fingerprintID("") != "" {
+		t.Fatalf("empty query should have empty id")
+	}
+}
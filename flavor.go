@@ -0,0 +1,401 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Mode selects what a kill statement terminates.
+type Mode int
+
+const (
+	// ModeConnection kills the whole connection (KILL / rds_kill).
+	ModeConnection Mode = iota
+	// ModeQuery kills only the running statement (KILL QUERY / rds_kill_query).
+	ModeQuery
+)
+
+// String returns "connection" or "query".
+func (m Mode) String() string {
+	if m == ModeQuery {
+		return "query"
+	}
+	return "connection"
+}
+
+// flavorAuto selects the flavor by probing the server.
+const flavorAuto = "auto"
+
+// serverInfo holds server metadata shared by flavor detection.
+type serverInfo struct {
+	Version        string
+	VersionComment string
+}
+
+// flavor abstracts the differences between MySQL-compatible servers.
+type flavor interface {
+	// Name returns the identifier accepted by the flavor config key.
+	Name() string
+	// Detect reports whether the connected server is of this flavor.
+	Detect(ctx context.Context, db *sql.DB, info serverInfo) (bool, error)
+	// ProcessListSource resolves the configured processlist source.
+	ProcessListSource(ctx context.Context, db *sql.DB, configured string) (processListSource, error)
+	// ProcessListQuery builds the processlist query and args.
+	ProcessListQuery(cmd *ListCmd, src processListSource) (string, []any, error)
+	// KillSQL builds the statement shown for a kill (and run, unless Kill overrides it).
+	KillSQL(id int64, mode Mode) string
+	// Kill executes the kill.
+	Kill(ctx context.Context, db Execer, id int64, mode Mode) error
+	// DetectReader determines whether the instance is a reader, and why.
+	DetectReader(ctx context.Context, db *sql.DB) (roleVerdict, error)
+	// CheckPrivileges reports whether the current user may kill other users' sessions in mode.
+	CheckPrivileges(ctx context.Context, db *sql.DB, mode Mode) (killPrivileges, error)
+}
+
+// flavorRegistry lists the known flavors in detection order. More specific
+// flavors come first; mysqlFlavor matches everything and must stay last.
+var flavorRegistry = []flavor{
+	tidbFlavor{},
+	auroraFlavor{rdsFlavor{rdsProcs}},
+	rdsFlavor{rdsProcs},
+	azureFlavor{azureProcs},
+	mariadbFlavor{},
+	cloudSQLFlavor{},
+	perconaFlavor{},
+	mysqlFlavor{},
+}
+
+// flavorNames returns the names of all registered flavors.
+func flavorNames() []string {
+	names := make([]string, 0, len(flavorRegistry))
+	for _, f := range flavorRegistry {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+// lookupFlavor returns the registered flavor with the given name.
+func lookupFlavor(name string) (flavor, bool) {
+	for _, f := range flavorRegistry {
+		if f.Name() == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// validateFlavorName checks a flavor config value.
+func validateFlavorName(name string) error {
+	if name == "" || name == flavorAuto {
+		return nil
+	}
+	if _, ok := lookupFlavor(name); !ok {
+		return fmt.Errorf("unknown flavor %q: use %q or one of %s", name, flavorAuto, strings.Join(flavorNames(), ", "))
+	}
+	return nil
+}
+
+// detectFlavor returns the forced flavor, or detects it from server metadata.
+func detectFlavor(ctx context.Context, db *sql.DB, forced string) (flavor, error) {
+	if forced != "" && forced != flavorAuto {
+		f, ok := lookupFlavor(forced)
+		if !ok {
+			return nil, validateFlavorName(forced)
+		}
+		return f, nil
+	}
+
+	var info serverInfo
+	if err := db.QueryRowContext(ctx, "SELECT @@version, @@version_comment").Scan(&info.Version, &info.VersionComment); err != nil {
+		return nil, fmt.Errorf("detect flavor (version): %w", err)
+	}
+
+	for _, f := range flavorRegistry {
+		ok, err := f.Detect(ctx, db, info)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return f, nil
+		}
+	}
+	return mysqlFlavor{}, nil
+}
+
+// hasRoutines reports whether any of the named procedures exist in the mysql schema.
+func hasRoutines(ctx context.Context, db *sql.DB, names ...string) (bool, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	query := `
+SELECT COUNT(*)
+FROM information_schema.routines
+WHERE routine_schema = 'mysql'
+  AND routine_name IN (` + placeholders + `)`
+	args := make([]any, 0, len(names))
+	for _, n := range names {
+		args = append(args, n)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("detect flavor (routines): %w", err)
+	}
+	return count > 0, nil
+}
+
+// hasGlobalVariable reports whether the server knows the named variable.
+func hasGlobalVariable(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL VARIABLES LIKE ?", name)
+	if err != nil {
+		return false, fmt.Errorf("detect flavor (variables): %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := rows.Next()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("detect flavor (variables): %w", err)
+	}
+	return found, nil
+}
+
+// mysqlFlavor is stock MySQL and the fallback for unknown servers.
+type mysqlFlavor struct{}
+
+func (mysqlFlavor) Name() string { return "mysql" }
+
+func (mysqlFlavor) Detect(context.Context, *sql.DB, serverInfo) (bool, error) {
+	return true, nil
+}
+
+func (mysqlFlavor) ProcessListSource(ctx context.Context, db *sql.DB, configured string) (processListSource, error) {
+	return detectProcessListSource(ctx, db, configured)
+}
+
+func (mysqlFlavor) ProcessListQuery(cmd *ListCmd, src processListSource) (string, []any, error) {
+	return buildProcessListQuery(cmd, src)
+}
+
+func (mysqlFlavor) KillSQL(id int64, mode Mode) string {
+	if mode == ModeQuery {
+		return fmt.Sprintf("KILL QUERY %d", id)
+	}
+	return fmt.Sprintf("KILL %d", id)
+}
+
+func (f mysqlFlavor) Kill(ctx context.Context, db Execer, id int64, mode Mode) error {
+	if _, err := db.ExecContext(ctx, f.KillSQL(id, mode)); err != nil {
+		return fmt.Errorf("execute: %w", err)
+	}
+	return nil
+}
+
+func (mysqlFlavor) DetectReader(ctx context.Context, db *sql.DB) (roleVerdict, error) {
+	src, err := queryRoleSources(ctx, db)
+	if err != nil {
+		return roleVerdict{}, err
+	}
+	return verdictFromSources(src), nil
+}
+
+func (mysqlFlavor) CheckPrivileges(ctx context.Context, db *sql.DB, _ Mode) (killPrivileges, error) {
+	return inspectPrivileges(ctx, db, privilegeRule{
+		Privs:    []string{"SUPER", "CONNECTION_ADMIN"},
+		Objects:  []string{"*.*"},
+		Required: "CONNECTION_ADMIN or SUPER",
+	})
+}
+
+// perconaFlavor is Percona Server for MySQL.
+type perconaFlavor struct{ mysqlFlavor }
+
+func (perconaFlavor) Name() string { return "percona" }
+
+func (perconaFlavor) Detect(_ context.Context, _ *sql.DB, info serverInfo) (bool, error) {
+	return strings.Contains(strings.ToLower(info.VersionComment), "percona"), nil
+}
+
+// cloudSQLFlavor is Google Cloud SQL for MySQL.
+type cloudSQLFlavor struct{ mysqlFlavor }
+
+func (cloudSQLFlavor) Name() string { return "cloudsql" }
+
+func (cloudSQLFlavor) Detect(_ context.Context, _ *sql.DB, info serverInfo) (bool, error) {
+	return strings.Contains(strings.ToLower(info.VersionComment), "google"), nil
+}
+
+// mariadbFlavor is MariaDB.
+type mariadbFlavor struct{ mysqlFlavor }
+
+func (mariadbFlavor) Name() string { return "mariadb" }
+
+func (mariadbFlavor) Detect(_ context.Context, _ *sql.DB, info serverInfo) (bool, error) {
+	return strings.Contains(strings.ToLower(info.Version), "mariadb"), nil
+}
+
+func (mariadbFlavor) CheckPrivileges(ctx context.Context, db *sql.DB, _ Mode) (killPrivileges, error) {
+	return inspectPrivileges(ctx, db, privilegeRule{
+		Privs:    []string{"SUPER", "CONNECTION ADMIN"},
+		Objects:  []string{"*.*"},
+		Required: "CONNECTION ADMIN or SUPER",
+	})
+}
+
+// tidbFlavor is TiDB. KILL TIDB only affects the TiDB server the session is
+// connected to, which is also where processlist rows come from.
+type tidbFlavor struct{ mysqlFlavor }
+
+func (tidbFlavor) Name() string { return "tidb" }
+
+func (tidbFlavor) Detect(_ context.Context, _ *sql.DB, info serverInfo) (bool, error) {
+	return strings.Contains(strings.ToLower(info.Version), "tidb"), nil
+}
+
+// ProcessListSource always uses information_schema: TiDB's
+// performance_schema has no processlist columns.
+func (tidbFlavor) ProcessListSource(_ context.Context, _ *sql.DB, configured string) (processListSource, error) {
+	if configured == sourcePerformanceSchema {
+		return processListSource{}, fmt.Errorf("processlist_source %q is not supported on tidb", configured)
+	}
+	return processListSource{}, nil
+}
+
+func (tidbFlavor) KillSQL(id int64, mode Mode) string {
+	if mode == ModeQuery {
+		return fmt.Sprintf("KILL TIDB QUERY %d", id)
+	}
+	return fmt.Sprintf("KILL TIDB %d", id)
+}
+
+func (f tidbFlavor) Kill(ctx context.Context, db Execer, id int64, mode Mode) error {
+	if _, err := db.ExecContext(ctx, f.KillSQL(id, mode)); err != nil {
+		return fmt.Errorf("execute: %w", err)
+	}
+	return nil
+}
+
+func (tidbFlavor) DetectReader(ctx context.Context, db *sql.DB) (roleVerdict, error) {
+	flags, err := readGlobalFlags(ctx, db, "tidb_restricted_read_only", "tidb_super_read_only")
+	if err != nil {
+		return roleVerdict{}, fmt.Errorf("detect reader: %w", err)
+	}
+	return tidbVerdict(flags["tidb_restricted_read_only"], flags["tidb_super_read_only"]), nil
+}
+
+// tidbVerdict interprets TiDB's read-only variables as reader or writer.
+func tidbVerdict(restricted sql.NullInt64, super sql.NullInt64) roleVerdict {
+	var v roleVerdict
+	for _, f := range []struct {
+		name string
+		val  sql.NullInt64
+	}{
+		{"tidb_restricted_read_only", restricted},
+		{"tidb_super_read_only", super},
+	} {
+		if !f.val.Valid {
+			continue
+		}
+		v.Values = append(v.Values, roleValue{Name: f.name, Value: fmt.Sprint(f.val.Int64)})
+		if f.val.Int64 == 1 && !v.Reader {
+			v.Reader = true
+			v.Reason = f.name + "=1"
+		}
+	}
+	if !v.Reader {
+		v.Reason = "no read-only setting enabled"
+	}
+	return v
+}
+
+var (
+	rdsProcs   = procFlavor{killProc: "mysql.rds_kill", killQueryProc: "mysql.rds_kill_query", protectedUsers: []string{"rdsadmin"}}
+	azureProcs = procFlavor{killProc: "mysql.az_kill", killQueryProc: "mysql.az_kill_query", protectedUsers: []string{"azure_superuser"}}
+)
+
+// procFlavor kills through stored procedures instead of KILL, as managed
+// services that withhold CONNECTION_ADMIN do.
+type procFlavor struct {
+	mysqlFlavor
+	killProc      string
+	killQueryProc string
+	// protectedUsers own sessions the procedures refuse to kill.
+	protectedUsers []string
+}
+
+func (f procFlavor) proc(mode Mode) string {
+	if mode == ModeQuery {
+		return f.killQueryProc
+	}
+	return f.killProc
+}
+
+func (f procFlavor) KillSQL(id int64, mode Mode) string {
+	return fmt.Sprintf("CALL %s(%d)", f.proc(mode), id)
+}
+
+func (f procFlavor) Kill(ctx context.Context, db Execer, id int64, mode Mode) error {
+	if _, err := db.ExecContext(ctx, "CALL "+f.proc(mode)+"(?)", id); err != nil {
+		return fmt.Errorf("execute: %w", err)
+	}
+	return nil
+}
+
+func (f procFlavor) CheckPrivileges(ctx context.Context, db *sql.DB, mode Mode) (killPrivileges, error) {
+	return inspectPrivileges(ctx, db, f.privilegeRule(mode))
+}
+
+// privilegeRule requires EXECUTE on the procedure that kills in mode.
+func (f procFlavor) privilegeRule(mode Mode) privilegeRule {
+	proc := f.proc(mode)
+	return privilegeRule{
+		Privs:     []string{"EXECUTE"},
+		Objects:   []string{"*.*", "mysql.*", "PROCEDURE " + proc},
+		Required:  "EXECUTE on " + proc,
+		Protected: f.protectedUsers,
+	}
+}
+
+// rdsFlavor is Amazon RDS for MySQL/MariaDB.
+type rdsFlavor struct{ procFlavor }
+
+func (rdsFlavor) Name() string { return "rds" }
+
+func (rdsFlavor) Detect(ctx context.Context, db *sql.DB, info serverInfo) (bool, error) {
+	if strings.Contains(strings.ToLower(info.VersionComment), "amazon rds") {
+		return true, nil
+	}
+	return hasRoutines(ctx, db, "rds_kill", "rds_kill_query")
+}
+
+// auroraFlavor is Amazon Aurora MySQL.
+type auroraFlavor struct{ rdsFlavor }
+
+func (auroraFlavor) Name() string { return "aurora" }
+
+func (auroraFlavor) Detect(ctx context.Context, db *sql.DB, info serverInfo) (bool, error) {
+	if strings.Contains(strings.ToLower(info.VersionComment), "aurora") {
+		return true, nil
+	}
+	return hasGlobalVariable(ctx, db, "aurora_version")
+}
+
+func (auroraFlavor) DetectReader(ctx context.Context, db *sql.DB) (roleVerdict, error) {
+	src, err := queryRoleSources(ctx, db)
+	if err != nil {
+		return roleVerdict{}, err
+	}
+	src.AuroraSessionID, err = queryAuroraSessionID(ctx, db)
+	if err != nil {
+		return roleVerdict{}, err
+	}
+	return verdictFromSources(src), nil
+}
+
+// azureFlavor is Azure Database for MySQL.
+type azureFlavor struct{ procFlavor }
+
+func (azureFlavor) Name() string { return "azure" }
+
+func (azureFlavor) Detect(ctx context.Context, db *sql.DB, _ serverInfo) (bool, error) {
+	return hasRoutines(ctx, db, "az_kill", "az_kill_query")
+}
@@ -0,0 +1,79 @@
+package mysqlkill
+
+import "testing"
+
+func TestValidateFlavorName(t *testing.T) {
+	for _, name := range []string{"", "auto", "mysql", "rds", "aurora", "azure", "cloudsql", "mariadb", "tidb", "percona"} {
+		if err := validateFlavorName(name); err != nil {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+	}
+	if err := validateFlavorName("oracle"); err == nil {
+		t.Fatalf("expected error for unknown flavor")
+	}
+}
+
+func TestFlavorRegistryFallbackLast(t *testing.T) {
+	last := flavorRegistry[len(flavorRegistry)-1]
+	if last.Name() != "mysql" {
+		t.Fatalf("mysql must be the last flavor, got %q", last.Name())
+	}
+}
+
+func TestFlavorDetectFromServerInfo(t *testing.T) {
+	cases := []struct {
+		flavor string
+		info   serverInfo
+		want   bool
+	}{
+		{flavor: "tidb", info: serverInfo{Version: "8.0.11-TiDB-v7.5.0"}, want: true},
+		{flavor: "tidb", info: serverInfo{Version: "8.0.36"}, want: false},
+		{flavor: "mariadb", info: serverInfo{Version: "10.11.6-MariaDB-log"}, want: true},
+		{flavor: "percona", info: serverInfo{Version: "8.0.35-27", VersionComment: "Percona Server (GPL), Release 27"}, want: true},
+		{flavor: "cloudsql", info: serverInfo{Version: "8.0.31-google", VersionComment: "(Google)"}, want: true},
+		{flavor: "cloudsql", info: serverInfo{VersionComment: "MySQL Community Server - GPL"}, want: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.flavor+"/"+tc.info.Version, func(t *testing.T) {
+			f, ok := lookupFlavor(tc.flavor)
+			if !ok {
+				t.Fatalf("flavor %q not registered", tc.flavor)
+			}
+			// These flavors decide from serverInfo alone and never touch db.
+			got, err := f.Detect(t.Context(), nil, tc.info)
+			if err != nil {
+				t.Fatalf("detect: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcFlavorPrivilegeRule(t *testing.T) {
+	grants := []string{"GRANT EXECUTE ON PROCEDURE `mysql`.`rds_kill` TO `ops`@`%`"}
+	cases := []struct {
+		name     string
+		f        procFlavor
+		mode     Mode
+		required string
+		want     bool
+	}{
+		{name: "rds kill", f: rdsProcs, mode: ModeConnection, required: "EXECUTE on mysql.rds_kill", want: true},
+		{name: "rds kill query", f: rdsProcs, mode: ModeQuery, required: "EXECUTE on mysql.rds_kill_query", want: false},
+		{name: "azure kill query", f: azureProcs, mode: ModeQuery, required: "EXECUTE on mysql.az_kill_query", want: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.f.privilegeRule(tc.mode)
+			if rule.Required != tc.required {
+				t.Fatalf("required %q, want %q", rule.Required, tc.required)
+			}
+			if got := privilegesFromGrants(grants, rule.Privs, rule.Objects...); got.Any != tc.want {
+				t.Fatalf("got %v want %v", got.Any, tc.want)
+			}
+		})
+	}
+}
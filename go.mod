@@ -11,6 +11,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.41.1
 	github.com/go-sql-driver/mysql v1.9.3
 	golang.org/x/crypto v0.47.0
+	golang.org/x/term v0.39.0
 )
 
 require (
@@ -0,0 +1,130 @@
+package mysqlkill
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// groupKeys are the values accepted by list --group-by.
+var groupKeys = []string{"fingerprint", "user", "host", "db", "state"}
+
+// validateGroupBy validates a --group-by key; "" disables grouping.
+func validateGroupBy(key string) error {
+	if key == "" || slices.Contains(groupKeys, key) {
+		return nil
+	}
+	return fmt.Errorf("invalid --group-by %q: must be one of %s", key, strings.Join(groupKeys, ", "))
+}
+
+// processGroup aggregates the sessions sharing a group key.
+type processGroup struct {
+	Key string `json:"key"`
+	// FingerprintID is set when grouping by fingerprint.
+	FingerprintID string `json:"fingerprint_id,omitempty"`
+	Count         int    `json:"count"`
+	MaxTime       int64  `json:"max_time"`
+	TotalTime     int64  `json:"-"`
+	// SampleID is the longest-running session of the group.
+	SampleID int64 `json:"sample_id"`
+}
+
+// AvgTime returns the mean TIME of the group's sessions.
+func (g processGroup) AvgTime() float64 {
+	if g.Count == 0 {
+		return 0
+	}
+	return float64(g.TotalTime) / float64(g.Count)
+}
+
+// groupKey returns the key of r for the given --group-by key. Sessions
+// without a running statement have no fingerprint and are skipped.
+func groupKey(r Process, by string) (string, bool) {
+	switch by {
+	case "fingerprint":
+		fp := r.Fingerprint()
+		return fp, fp != ""
+	case "user":
+		return nullString(r.User), true
+	case "host":
+		return hostOnly(nullString(r.Host)), true
+	case "db":
+		return nullString(r.DB), true
+	case "state":
+		return nullString(r.State), true
+	default:
+		return "", false
+	}
+}
+
+// groupProcessRows aggregates rows by key, largest groups first.
+func groupProcessRows(rows []Process, by string) []processGroup {
+	index := make(map[string]int)
+	var groups []processGroup
+	for _, r := range rows {
+		key, ok := groupKey(r, by)
+		if !ok {
+			continue
+		}
+		i, seen := index[key]
+		if !seen {
+			i = len(groups)
+			index[key] = i
+			g := processGroup{Key: key, SampleID: r.ID, MaxTime: r.Time.Int64}
+			if by == "fingerprint" {
+				g.FingerprintID = r.FingerprintID()
+			}
+			groups = append(groups, g)
+		}
+		g := &groups[i]
+		g.Count++
+		g.TotalTime += r.Time.Int64
+		if r.Time.Int64 > g.MaxTime {
+			g.MaxTime = r.Time.Int64
+			g.SampleID = r.ID
+		}
+	}
+
+	slices.SortStableFunc(groups, func(a, b processGroup) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		if a.MaxTime != b.MaxTime {
+			if a.MaxTime > b.MaxTime {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return groups
+}
+
+// matchFingerprint returns the rows whose statement has fingerprint ID id.
+func matchFingerprint(rows []Process, id string) []Process {
+	var matches []Process
+	for _, r := range rows {
+		if fp := r.FingerprintID(); fp != "" && strings.EqualFold(fp, id) {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// processIDs returns the IDs of rows.
+func processIDs(rows []Process) []int64 {
+	ids := make([]int64, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// hostOnly strips the client port from a processlist HOST value.
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupProcessRows(t *testing.T) {
+	rows := []Process{
+		{ID: 1, User: sql.NullString{String: "app", Valid: true}, Host: sql.NullString{String: "10.0.0.1:5000", Valid: true}, Time: sql.NullInt64{Int64: 30, Valid: true}, Info: sql.NullString{String: "SELECT * FROM t WHERE id = 1", Valid: true}},
+		{ID: 2, User: sql.NullString{String: "app", Valid: true}, Host: sql.NullString{String: "10.0.0.1:5001", Valid: true}, Time: sql.NullInt64{Int64: 90, Valid: true}, Info: sql.NullString{String: "select * from t where id = 2", Valid: true}},
+		{ID: 3, User: sql.NullString{String: "batch", Valid: true}, Host: sql.NullString{String: "localhost", Valid: true}, Time: sql.NullInt64{Int64: 5, Valid: true}, Info: sql.NullString{String: "UPDATE u SET x = 1", Valid: true}},
+		{ID: 4, User: sql.NullString{String: "app", Valid: true}, Host: sql.NullString{String: "10.0.0.2:5000", Valid: true}, Time: sql.NullInt64{Int64: 600, Valid: true}},
+	}
+
+	fps := groupProcessRows(rows, "fingerprint")
+	if len(fps) != 2 {
+		t.Fatalf("expected 2 fingerprint groups, got %+v", fps)
+	}
+	if fps[0].Key != "select * from t where id = ?" || fps[0].Count != 2 || fps[0].MaxTime != 90 || fps[0].SampleID != 2 || fps[0].AvgTime() != 60 {
+		t.Fatalf("unexpected first group: %+v", fps[0])
+	}
+	if fps[0].FingerprintID != fingerprintID(rows[0].Info.String) {
+		t.Fatalf("unexpected fingerprint id: %+v", fps[0])
+	}
+
+	hosts := groupProcessRows(rows, "host")
+	if len(hosts) != 3 || hosts[0].Key != "10.0.0.1" || hosts[0].Count != 2 {
+		t.Fatalf("unexpected host groups: %+v", hosts)
+	}
+
+	users := groupProcessRows(rows, "user")
+	if len(users) != 2 || users[0].Key != "app" || users[0].Count != 3 || users[0].SampleID != 4 {
+		t.Fatalf("unexpected user groups: %+v", users)
+	}
+
+	ids := processIDs(matchFingerprint(rows, strings.ToLower(fps[0].FingerprintID)))
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Fatalf("unexpected matches: %v", ids)
+	}
+}
+
+func TestValidateGroupBy(t *testing.T) {
+	for _, key := range []string{"", "fingerprint", "user", "host", "db", "state"} {
+		if err := validateGroupBy(key); err != nil {
+			t.Fatalf("%q: %v", key, err)
+		}
+	}
+	if err := validateGroupBy("command"); err == nil {
+		t.Fatalf("expected error for unknown key")
+	}
+}
@@ -2,14 +2,49 @@ package mysqlkill
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 )
 
 // runKill executes the kill command.
 func runKill(ctx context.Context, cli *CLI, cmd *KillCmd) error {
-	if cmd.QueryID == 0 {
-		return errors.New("query id is required")
+	if cmd.QueryID == 0 && cmd.Fingerprint == "" {
+		return errors.New("query id or --fingerprint is required")
+	}
+
+	if cmd.QueryID != 0 && cmd.Fingerprint != "" {
+		return errors.New("query id and --fingerprint are mutually exclusive")
+	}
+
+	if cmd.Fingerprint != "" && cmd.Blocker {
+		return errors.New("--fingerprint and --blocker are mutually exclusive")
+	}
+
+	if cmd.Fingerprint == "" && cmd.Victims != "" && cmd.Victims != victimsAll {
+		return errors.New("--victims requires --fingerprint")
+	}
+
+	if err := validateVictims(cmd.Victims); err != nil {
+		return err
+	}
+
+	if cmd.AbortOver < 0 {
+		return errors.New("--abort-over must not be negative")
+	}
+
+	if cmd.Wait && cmd.WaitTimeout <= 0 {
+		return errors.New("--wait-timeout must be positive")
+	}
+
+	if cmd.EscalateAfter > 0 && (!cmd.Wait || !cmd.KillQuery) {
+		return errors.New("--escalate-after requires --wait and --kill-query")
+	}
+
+	if cmd.EscalateAfter >= cmd.WaitTimeout && cmd.EscalateAfter > 0 {
+		return errors.New("--escalate-after must be shorter than --wait-timeout")
 	}
 
 	if cmd.Kill && cmd.KillQuery {
@@ -24,75 +59,137 @@ func runKill(ctx context.Context, cli *CLI, cmd *KillCmd) error {
 	if err != nil {
 		return err
 	}
-	if cfg.MySQL.DSN == "" {
-		cfg.MySQL.DSN = buildDSN(cfg.MySQL)
-	}
-	if cfg.MySQL.DSN == "" {
-		return errors.New("connection info missing: provide --dsn flag or config file")
+	if err := cmd.checkTarget(cfg.Target); err != nil {
+		return err
 	}
 
-	db, tunnel, err := openDBWithTunnel(ctx, cfg.MySQL, cfg.SSH)
+	c, err := newClient(ctx, cfg, "kill")
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if tunnel != nil {
-			tunnel.Close()
-		}
-		_ = db.Close()
-	}()
+	defer func() { _ = c.Close() }()
 
-	isRDS, err := detectRDS(ctx, db)
+	au, err := c.auditor()
 	if err != nil {
 		return err
 	}
+	if cfg.Target == targetProxySQL {
+		return runProxySQLKill(ctx, c.db, cfg, cmd, au, c.allow)
+	}
 
-	if err := enforceReader(ctx, db, cfg.AllowWriter); err != nil {
+	results, err := c.kill(ctx, os.Stdout, cmd, cmd.QueryID, au)
+	if err != nil {
 		return err
 	}
+	return c.waitResults(ctx, os.Stdout, cmd, results, au)
+}
 
-	sqlText := buildKillSQL(isRDS, cmd.Kill, cmd.KillQuery, cmd.QueryID)
+// refusedError is a kill refused by a privilege or policy check.
+type refusedError struct {
+	err error
+}
 
-	if cmd.DryRun {
-		fmt.Printf("DRY RUN: %s\n", sqlText)
-		return nil
-	}
+func (e refusedError) Error() string { return e.err.Error() }
+func (e refusedError) Unwrap() error { return e.err }
 
-	if isRDS {
-		return execRDSKill(ctx, db, cmd.Kill, cmd.QueryID)
+// killProcesses kills each of ids on the server of c, reporting each
+// statement to w and recording each attempt to au. allow, when not nil, vets
+// each victim on top of the privilege check. Every target is checked up
+// front, so nothing is killed unless all of them can be, nor when they are
+// more than the abort_over cap, lowered by --abort-over. It returns the
+// kills made.
+func killProcesses(ctx context.Context, w io.Writer, c *Client, cmd *KillCmd, ids []int64, au *auditor, allow func(Process) error) ([]Result, error) {
+	if err := checkVictimCap(len(ids), victimCap(c.cfg.AbortOver, cmd.AbortOver)); err != nil {
+		au.Record(auditRecord{DryRun: cmd.DryRun, Outcome: auditRefused, Error: err.Error()}, Process{})
+		return nil, err
 	}
 
-	if _, err := db.ExecContext(ctx, sqlText); err != nil {
-		return fmt.Errorf("execute: %w", err)
+	mode := cmd.mode()
+	privs, err := c.f.CheckPrivileges(ctx, c.db, mode)
+	if err != nil {
+		return nil, err
+	}
+	victims := make([]Process, len(ids))
+	for i, id := range ids {
+		victim, err := checkKillable(ctx, c.db, privs, c.src, id)
+		if err == nil && allow != nil {
+			if err = allow(victim); err != nil {
+				err = refusedError{err}
+			}
+		}
+		if err != nil {
+			au.Record(auditRecord{ProcessID: id, SQL: c.f.KillSQL(id, mode), DryRun: cmd.DryRun,
+				Outcome: auditRefused, Error: err.Error()}, victim)
+			return nil, err
+		}
+		victims[i] = victim
 	}
-	fmt.Printf("OK: %s\n", sqlText)
-	return nil
-}
 
-// buildKillSQL builds the kill statement or RDS stored procedure call.
-func buildKillSQL(rds bool, kill bool, killQuery bool, id int64) string {
-	if rds {
-		if killQuery {
-			return fmt.Sprintf("CALL mysql.rds_kill_query(%d)", id)
+	var results []Result
+	for i, id := range ids {
+		rec := auditRecord{ProcessID: id, SQL: c.f.KillSQL(id, mode), DryRun: cmd.DryRun}
+
+		if cmd.DryRun {
+			rec.Outcome = auditDryRun
+			au.Record(rec, victims[i])
+			results = append(results, Result{ID: id, SQL: rec.SQL, DryRun: true, Process: victims[i]})
+			fmt.Fprintf(w, "DRY RUN: %s\n", rec.SQL)
+			continue
+		}
+
+		if err := c.f.Kill(ctx, c.db, id, mode); err != nil {
+			rec.Outcome, rec.Error = auditError, err.Error()
+			au.Record(rec, victims[i])
+			return results, err
 		}
-		return fmt.Sprintf("CALL mysql.rds_kill(%d)", id)
+		rec.Outcome = auditOK
+		au.Record(rec, victims[i])
+		results = append(results, Result{ID: id, SQL: rec.SQL, Process: victims[i]})
+		fmt.Fprintf(w, "OK: %s\n", rec.SQL)
 	}
+	return results, nil
+}
 
-	if killQuery {
-		return fmt.Sprintf("KILL QUERY %d", id)
+// checkKillable verifies up front that the current user may kill process id,
+// so a missing privilege surfaces as a clear error instead of a server error.
+// It returns the process, or a zero row when it was not found.
+func checkKillable(ctx context.Context, db *sql.DB, privs killPrivileges, src processListSource, id int64) (Process, error) {
+	r, err := lookupProcess(ctx, db, src, id)
+	if err != nil {
+		return Process{}, err
 	}
-	return fmt.Sprintf("KILL %d", id)
+	if err := privs.Check(id, nullString(r.User)); err != nil {
+		return r, refusedError{err}
+	}
+	return r, nil
 }
 
-// execRDSKill executes the RDS kill stored procedure.
-func execRDSKill(ctx context.Context, db Execer, kill bool, id int64) error {
-	proc := "mysql.rds_kill"
-	if !kill {
-		proc = "mysql.rds_kill_query"
+// checkTarget rejects the flags that target does not support.
+func (c *KillCmd) checkTarget(target string) error {
+	if c.Backend && target != targetProxySQL {
+		return errors.New("--backend requires target = \"proxysql\"")
+	}
+	if target != targetProxySQL {
+		return nil
 	}
-	if _, err := db.ExecContext(ctx, "CALL "+proc+"(?)", id); err != nil {
-		return fmt.Errorf("execute: %w", err)
+	if c.Fingerprint != "" {
+		return errors.New("--fingerprint is not supported with target proxysql")
+	}
+	// Only the backend server knows the lock waits; killing the frontend
+	// session would kill the waiter instead of its blocker.
+	if c.Blocker && !c.Backend {
+		return errors.New("--blocker requires a MySQL target or --backend")
+	}
+	if c.Wait && !c.Backend {
+		return errors.New("--wait requires a MySQL target or --backend")
 	}
-	fmt.Printf("OK: CALL %s(%d)\n", proc, id)
 	return nil
 }
+
+// mode returns the kill mode selected by the flags.
+func (c *KillCmd) mode() Mode {
+	if c.KillQuery {
+		return ModeQuery
+	}
+	return ModeConnection
+}
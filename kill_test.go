@@ -1,28 +1,97 @@
 package mysqlkill
 
-import "testing"
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
 
-func TestBuildKillSQL(t *testing.T) {
+func TestFlavorKillSQL(t *testing.T) {
 	cases := []struct {
-		name      string
-		rds       bool
-		kill      bool
-		killQuery bool
-		id        int64
-		want      string
+		name   string
+		flavor string
+		mode   Mode
+		id     int64
+		want   string
 	}{
-		{name: "mysql kill", rds: false, kill: true, id: 10, want: "KILL 10"},
-		{name: "mysql kill query", rds: false, killQuery: true, id: 11, want: "KILL QUERY 11"},
-		{name: "rds kill", rds: true, kill: true, id: 12, want: "CALL mysql.rds_kill(12)"},
-		{name: "rds kill query", rds: true, killQuery: true, id: 13, want: "CALL mysql.rds_kill_query(13)"},
+		{name: "mysql kill", flavor: "mysql", mode: ModeConnection, id: 10, want: "KILL 10"},
+		{name: "mysql kill query", flavor: "mysql", mode: ModeQuery, id: 11, want: "KILL QUERY 11"},
+		{name: "rds kill", flavor: "rds", mode: ModeConnection, id: 12, want: "CALL mysql.rds_kill(12)"},
+		{name: "rds kill query", flavor: "rds", mode: ModeQuery, id: 13, want: "CALL mysql.rds_kill_query(13)"},
+		{name: "aurora kill", flavor: "aurora", mode: ModeConnection, id: 14, want: "CALL mysql.rds_kill(14)"},
+		{name: "azure kill query", flavor: "azure", mode: ModeQuery, id: 15, want: "CALL mysql.az_kill_query(15)"},
+		{name: "tidb kill", flavor: "tidb", mode: ModeConnection, id: 16, want: "KILL TIDB 16"},
+		{name: "tidb kill query", flavor: "tidb", mode: ModeQuery, id: 17, want: "KILL TIDB QUERY 17"},
+		{name: "mariadb kill query", flavor: "mariadb", mode: ModeQuery, id: 18, want: "KILL QUERY 18"},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			got := buildKillSQL(tc.rds, tc.kill, tc.killQuery, tc.id)
+			f, ok := lookupFlavor(tc.flavor)
+			if !ok {
+				t.Fatalf("flavor %q not registered", tc.flavor)
+			}
+			got := f.KillSQL(tc.id, tc.mode)
 			if got != tc.want {
 				t.Fatalf("got %q want %q", got, tc.want)
 			}
 		})
 	}
 }
+
+func TestKillCmdMode(t *testing.T) {
+	if got := (&KillCmd{Kill: true}).mode(); got != ModeConnection {
+		t.Fatalf("--kill: got %v", got)
+	}
+	if got := (&KillCmd{KillQuery: true}).mode(); got != ModeQuery {
+		t.Fatalf("--kill-query: got %v", got)
+	}
+}
+
+func TestKillCmdCheckTarget(t *testing.T) {
+	cases := []struct {
+		name    string
+		cmd     KillCmd
+		target  string
+		wantErr string
+	}{
+		{name: "blocker on mysql", cmd: KillCmd{Blocker: true}, target: targetMySQL},
+		{name: "blocker on proxysql", cmd: KillCmd{Blocker: true}, target: targetProxySQL, wantErr: "--blocker requires"},
+		{name: "blocker on proxysql backend", cmd: KillCmd{Blocker: true, Backend: true}, target: targetProxySQL},
+		{name: "backend on mysql", cmd: KillCmd{Backend: true}, target: targetMySQL, wantErr: "--backend requires"},
+		{name: "fingerprint on proxysql", cmd: KillCmd{Fingerprint: "AB", Backend: true}, target: targetProxySQL, wantErr: "--fingerprint"},
+		{name: "wait on proxysql", cmd: KillCmd{Wait: true}, target: targetProxySQL, wantErr: "--wait requires"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cmd.checkTarget(tc.target)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("got %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestKillProcessesVictimCap(t *testing.T) {
+	// The cap is checked before the server is queried.
+	c := &Client{cfg: AppConfig{AbortOver: 2}}
+	cases := []struct {
+		cmd  *KillCmd
+		ids  []int64
+		want string
+	}{
+		{cmd: &KillCmd{Kill: true}, ids: []int64{1, 2, 3}, want: "3 sessions would be killed, over the cap of 2"},
+		{cmd: &KillCmd{Kill: true, AbortOver: 1}, ids: []int64{1, 2}, want: "over the cap of 1"},
+		{cmd: &KillCmd{Kill: true, AbortOver: 5}, ids: []int64{1, 2, 3}, want: "over the cap of 2"},
+	}
+	for _, tc := range cases {
+		_, err := killProcesses(context.Background(), io.Discard, c, tc.cmd, tc.ids, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("ids %v abort-over %d: got %v, want %q", tc.ids, tc.cmd.AbortOver, err, tc.want)
+		}
+	}
+}
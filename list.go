@@ -1,114 +1,354 @@
 package mysqlkill
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 )
 
 // runList executes the list command.
 func runList(ctx context.Context, cli *CLI, cmd *ListCmd) error {
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
 	cfg, err := resolveConfig(ctx, cli)
 	if err != nil {
 		return err
 	}
-	if cfg.MySQL.DSN == "" {
-		cfg.MySQL.DSN = buildDSN(cfg.MySQL)
+
+	c, err := newClient(ctx, cfg, "list")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if cfg.Target == targetProxySQL {
+		if cmd.showTrx() {
+			return errors.New("--trx, --in-trx and --trx-age are not supported with target proxysql")
+		}
+		if cmd.GroupBy != "" {
+			return errors.New("--group-by is not supported with target proxysql")
+		}
+		if cmd.hasServerFilters() {
+			return errors.New("only --match is supported with target proxysql")
+		}
+		if cmd.Sort != "" || len(cmd.Columns) > 0 || cmd.Limit > 0 || cmd.Format == "json" {
+			return errors.New("--sort, --columns, --limit and --format json are not supported with target proxysql")
+		}
+		return listProxySQLProcess(ctx, os.Stdout, c.db, cmd, cfg.Redaction)
 	}
-	if cfg.MySQL.DSN == "" {
-		return errors.New("connection info missing: provide --dsn flag or config file")
+
+	if _, err := enforceReader(ctx, c.db, c.f, cfg); err != nil {
+		return err
 	}
 
-	db, tunnel, err := openDBWithTunnel(ctx, cfg.MySQL, cfg.SSH)
+	privs, err := c.f.CheckPrivileges(ctx, c.db, ModeConnection)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if tunnel != nil {
-			tunnel.Close()
-		}
-		_ = db.Close()
-	}()
 
-	if err := enforceReader(ctx, db, cfg.AllowWriter); err != nil {
+	return listProcess(ctx, os.Stdout, c.db, c.f, c.src, privs, cfg.Redaction, cmd)
+}
+
+// Process is a session of the processlist. Columns that are NULL, such as
+// the SQL text of an idle session, are invalid.
+type Process struct {
+	ID            int64
+	User          sql.NullString
+	Host          sql.NullString
+	DB            sql.NullString
+	Command       sql.NullString
+	Time          sql.NullInt64
+	State         sql.NullString
+	Info          sql.NullString
+	ThreadID      sql.NullInt64
+	ResourceGroup sql.NullString
+	// Trx is nil unless transactions were queried.
+	Trx *Transaction
+
+	// fingerprintID is the fingerprint ID of the unredacted SQL of a
+	// redacted row.
+	fingerprintID string
+}
+
+// Fingerprint returns the SQL text with literals replaced by placeholders
+// and whitespace and case normalized, "" for an idle session.
+func (p Process) Fingerprint() string {
+	return fingerprint(nullString(p.Info))
+}
+
+// FingerprintID returns the short hash of Fingerprint, as shown by
+// list --group-by fingerprint, "" for an idle session. A redacted row keeps
+// the ID of its unredacted SQL.
+func (p Process) FingerprintID() string {
+	if p.fingerprintID != "" {
+		return p.fingerprintID
+	}
+	return fingerprintID(nullString(p.Info))
+}
+
+// Elapsed returns how long the session has been in its current state.
+func (p Process) Elapsed() time.Duration {
+	return time.Duration(p.Time.Int64) * time.Second
+}
+
+// TrxAge returns how long the session's transaction has been open. ok is
+// false without an open transaction or when transactions were not queried.
+func (p Process) TrxAge() (age time.Duration, ok bool) {
+	if p.Trx == nil || !p.Trx.Age.Valid {
+		return 0, false
+	}
+	return time.Duration(p.Trx.Age.Int64) * time.Second, true
+}
+
+// Transaction is the InnoDB transaction of a session. All fields are invalid
+// when the session has no open transaction.
+type Transaction struct {
+	ID             sql.NullString
+	State          sql.NullString
+	Started        sql.NullString
+	Age            sql.NullInt64
+	RowsLocked     sql.NullInt64
+	RowsModified   sql.NullInt64
+	IsolationLevel sql.NullString
+}
+
+// listColumn is an output column of the list table.
+type listColumn struct {
+	Name  string
+	Value func(r Process) string
+	// Order is the SQL ORDER BY expression, "" for computed columns.
+	Order string
+	// Trx reports whether the column needs the innodb_trx join.
+	Trx bool
+}
+
+// infoMaxWidth is the width INFO is truncated to without --full.
+const infoMaxWidth = 120
+
+// listProcess queries and renders the processlist to w in the --format of
+// cmd, annotating each row with whether the current user may kill it.
+func listProcess(ctx context.Context, w io.Writer, db *sql.DB, f flavor, src processListSource, privs killPrivileges, red redactor, cmd *ListCmd) error {
+	out, err := lookupRenderer(cmd.Format)
+	if err != nil {
+		return err
+	}
+	rows, err := fetchProcessList(ctx, db, f, src, cmd)
+	if err != nil {
 		return err
 	}
 
-	return listProcess(ctx, db, cmd)
+	if cmd.GroupBy != "" {
+		groups := red.Groups(cmd.GroupBy, groupProcessRows(rows, cmd.GroupBy))
+		if cmd.Limit > 0 && len(groups) > cmd.Limit {
+			groups = groups[:cmd.Limit]
+		}
+		return out.groups(w, cmd.GroupBy, groups)
+	}
+	rows = red.Rows(rows)
+
+	if out.rawSQL() {
+		full := *cmd
+		full.Full = true
+		cmd = &full
+	}
+	cols, err := listColumns(cmd, src, privs)
+	if err != nil {
+		return err
+	}
+	// Computed columns cannot be sorted by the server.
+	if col, desc, ok := cmd.sortColumn(); ok && col.Order == "" {
+		sortProcessRows(rows, col, desc)
+	}
+	if cmd.Limit > 0 && len(rows) > cmd.Limit {
+		rows = rows[:cmd.Limit]
+	}
+	return out.rows(w, cols, rows)
 }
 
-// listProcess queries and prints the processlist.
-func listProcess(ctx context.Context, db *sql.DB, cmd *ListCmd) error {
-	query, args := buildProcessListQuery(cmd)
+// fetchProcessList queries the processlist rows matching cmd.
+func fetchProcessList(ctx context.Context, db *sql.DB, f flavor, src processListSource, cmd *ListCmd) ([]Process, error) {
+	query, args, err := f.ProcessListQuery(cmd, src)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("query processlist: %w", err)
+		return nil, fmt.Errorf("query processlist: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
-	if _, err := fmt.Fprintln(tw, "ID\tUSER\tHOST\tDB\tCOMMAND\tTIME\tSTATE\tINFO"); err != nil {
-		return fmt.Errorf("write header: %w", err)
+	var result []Process
+	for rows.Next() {
+		var r Process
+		if err := rows.Scan(processRowDest(&r, cmd.showTrx())...); err != nil {
+			return nil, fmt.Errorf("scan processlist: %w", err)
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
 	}
+	return result, nil
+}
 
-	for rows.Next() {
-		var (
-			id      int64
-			user    sql.NullString
-			host    sql.NullString
-			db      sql.NullString
-			command sql.NullString
-			timeSec sql.NullInt64
-			state   sql.NullString
-			info    sql.NullString
-		)
-		if err := rows.Scan(&id, &user, &host, &db, &command, &timeSec, &state, &info); err != nil {
-			return fmt.Errorf("scan processlist: %w", err)
+// processRowDest returns the scan destinations of a processlist query, with
+// the transaction columns when trx is true.
+func processRowDest(r *Process, trx bool) []any {
+	dest := []any{&r.ID, &r.User, &r.Host, &r.DB, &r.Command, &r.Time, &r.State, &r.Info, &r.ThreadID, &r.ResourceGroup}
+	if trx {
+		r.Trx = &Transaction{}
+		dest = append(dest, &r.Trx.ID, &r.Trx.State, &r.Trx.Started, &r.Trx.Age,
+			&r.Trx.RowsLocked, &r.Trx.RowsModified, &r.Trx.IsolationLevel)
+	}
+	return dest
+}
+
+// listColumnDefs returns every column list can show. Without full, SQL
+// text is flattened to one line and truncated.
+func listColumnDefs(privs killPrivileges, full bool) []listColumn {
+	sqlText := func(s string) string {
+		if full {
+			return s
 		}
-		if _, err := fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			id,
-			nullString(user),
-			nullString(host),
-			nullString(db),
-			nullString(command),
-			nullInt(timeSec),
-			nullString(state),
-			nullString(info),
-		); err != nil {
-			return fmt.Errorf("write row: %w", err)
+		return truncateText(flattenSpace(s), infoMaxWidth)
+	}
+	return []listColumn{
+		{Name: "ID", Order: "ID", Value: func(r Process) string { return strconv.FormatInt(r.ID, 10) }},
+		{Name: "THREAD_ID", Order: "THREAD_ID", Value: func(r Process) string { return nullInt(r.ThreadID) }},
+		{Name: "USER", Order: "USER", Value: func(r Process) string { return nullString(r.User) }},
+		{Name: "HOST", Order: "HOST", Value: func(r Process) string { return nullString(r.Host) }},
+		{Name: "DB", Order: "DB", Value: func(r Process) string { return nullString(r.DB) }},
+		{Name: "COMMAND", Order: "COMMAND", Value: func(r Process) string { return nullString(r.Command) }},
+		{Name: "TIME", Order: "TIME", Value: func(r Process) string { return nullInt(r.Time) }},
+		{Name: "STATE", Order: "STATE", Value: func(r Process) string { return nullString(r.State) }},
+		{Name: "RESOURCE_GROUP", Order: "RESOURCE_GROUP", Value: func(r Process) string { return nullString(r.ResourceGroup) }},
+		{Name: "TRX_ID", Order: "trx_id", Trx: true, Value: func(r Process) string { return nullString(r.Trx.ID) }},
+		{Name: "TRX_STATE", Order: "trx_state", Trx: true, Value: func(r Process) string { return nullString(r.Trx.State) }},
+		{Name: "TRX_STARTED", Order: "trx_started", Trx: true, Value: func(r Process) string { return nullString(r.Trx.Started) }},
+		{Name: "TRX_AGE", Order: "trx_age", Trx: true, Value: func(r Process) string { return nullInt(r.Trx.Age) }},
+		{Name: "ROWS_LOCKED", Order: "trx_rows_locked", Trx: true, Value: func(r Process) string { return nullInt(r.Trx.RowsLocked) }},
+		{Name: "ROWS_MODIFIED", Order: "trx_rows_modified", Trx: true, Value: func(r Process) string { return nullInt(r.Trx.RowsModified) }},
+		{Name: "ISOLATION", Order: "trx_isolation_level", Trx: true, Value: func(r Process) string { return nullString(r.Trx.IsolationLevel) }},
+		{Name: "KILLABLE", Value: func(r Process) string { return yesNo(privs.CanKill(nullString(r.User))) }},
+		{Name: "FINGERPRINT_ID", Value: func(r Process) string { return r.FingerprintID() }},
+		{Name: "FINGERPRINT", Value: func(r Process) string { return sqlText(r.Fingerprint()) }},
+		{Name: "INFO", Order: "INFO", Value: func(r Process) string { return sqlText(nullString(r.Info)) }},
+	}
+}
+
+// defaultColumns returns the columns shown without --columns.
+func defaultColumns(src processListSource, showTrx bool) []string {
+	names := []string{"ID"}
+	if src.PerformanceSchema {
+		names = append(names, "THREAD_ID")
+	}
+	names = append(names, "USER", "HOST", "DB", "COMMAND", "TIME", "STATE")
+	if src.PerformanceSchema {
+		names = append(names, "RESOURCE_GROUP")
+	}
+	if showTrx {
+		names = append(names, "TRX_ID", "TRX_STATE", "TRX_STARTED", "TRX_AGE", "ROWS_LOCKED", "ROWS_MODIFIED", "ISOLATION")
+	}
+	return append(names, "KILLABLE", "INFO")
+}
+
+// lookupListColumn returns the column named name, case-insensitively.
+func lookupListColumn(defs []listColumn, name string) (listColumn, error) {
+	for _, c := range defs {
+		if strings.EqualFold(c.Name, name) {
+			return c, nil
 		}
 	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("rows: %w", err)
+	names := make([]string, len(defs))
+	for i, c := range defs {
+		names[i] = strings.ToLower(c.Name)
 	}
+	return listColumn{}, fmt.Errorf("unknown column %q: must be one of %s", name, strings.Join(names, ", "))
+}
 
-	return tw.Flush()
+// listColumns returns the table columns selected by cmd.
+func listColumns(cmd *ListCmd, src processListSource, privs killPrivileges) ([]listColumn, error) {
+	names := cmd.Columns
+	if len(names) == 0 {
+		names = defaultColumns(src, cmd.showTrx())
+	}
+	defs := listColumnDefs(privs, cmd.Full)
+	cols := make([]listColumn, 0, len(names))
+	for _, name := range names {
+		c, err := lookupListColumn(defs, strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
 }
 
-// buildProcessListQuery builds the processlist query and args.
-func buildProcessListQuery(cmd *ListCmd) (string, []any) {
-	base := `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO FROM information_schema.processlist`
-	var where []string
-	var args []any
+// sortProcessRows sorts rows by the values of col, numerically when possible.
+func sortProcessRows(rows []Process, col listColumn, desc bool) {
+	slices.SortStableFunc(rows, func(a, b Process) int {
+		c := compareValues(col.Value(a), col.Value(b))
+		if desc {
+			c = -c
+		}
+		return c
+	})
+}
 
-	if cmd.Match != "" {
-		where = append(where, "INFO REGEXP ?")
-		args = append(args, cmd.Match)
+// resolveProcessListSource picks the processlist source for f, reporting it
+// on stderr with --verbose.
+func resolveProcessListSource(ctx context.Context, db *sql.DB, f flavor, cfg AppConfig) (processListSource, error) {
+	src, err := f.ProcessListSource(ctx, db, cfg.ProcessListSource)
+	if err != nil {
+		return src, err
+	}
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "processlist source: %s\n", src)
+	}
+	return src, nil
+}
+
+// compareValues compares two cell values, numerically when both are integers.
+func compareValues(a, b string) int {
+	ai, aerr := strconv.ParseInt(a, 10, 64)
+	bi, berr := strconv.ParseInt(b, 10, 64)
+	if aerr == nil && berr == nil {
+		return cmp.Compare(ai, bi)
 	}
+	return strings.Compare(a, b)
+}
+
+// flattenSpace collapses all whitespace, including newlines, to single spaces.
+func flattenSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
 
-	query := base
-	if len(where) > 0 {
-		query += " WHERE " + strings.Join(where, " AND ")
+// truncateText cuts s to at most width runes, marking the cut with "...".
+func truncateText(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
 	}
-	query += " ORDER BY TIME DESC"
+	return string([]rune(s)[:width-3]) + "..."
+}
 
-	return query, args
+// yesNo formats a boolean for table output.
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
 }
 
 // nullString converts sql.NullString to a plain string.
@@ -1,8 +1,11 @@
 package mysqlkill
 
 import (
+	"database/sql"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildProcesslistQuery(t *testing.T) {
@@ -10,8 +13,11 @@ func TestBuildProcesslistQuery(t *testing.T) {
 		Match: "SELECT",
 	}
 
-	gotQuery, gotArgs := buildProcessListQuery(cmd)
-	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO FROM information_schema.processlist WHERE INFO REGEXP ? ORDER BY TIME DESC"
+	gotQuery, gotArgs, err := buildProcessListQuery(cmd, processListSource{})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, NULL AS THREAD_ID, NULL AS RESOURCE_GROUP FROM information_schema.processlist WHERE INFO REGEXP ? ORDER BY TIME DESC"
 	wantArgs := []any{"SELECT"}
 
 	if gotQuery != wantQuery {
@@ -24,8 +30,11 @@ func TestBuildProcesslistQuery(t *testing.T) {
 
 func TestBuildProcesslistQueryNoFilters(t *testing.T) {
 	cmd := &ListCmd{}
-	gotQuery, gotArgs := buildProcessListQuery(cmd)
-	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO FROM information_schema.processlist ORDER BY TIME DESC"
+	gotQuery, gotArgs, err := buildProcessListQuery(cmd, processListSource{})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, NULL AS THREAD_ID, NULL AS RESOURCE_GROUP FROM information_schema.processlist ORDER BY TIME DESC"
 
 	if gotQuery != wantQuery {
 		t.Fatalf("query mismatch: %s != %s", gotQuery, wantQuery)
@@ -34,3 +43,188 @@ func TestBuildProcesslistQueryNoFilters(t *testing.T) {
 		t.Fatalf("expected no args, got %#v", gotArgs)
 	}
 }
+
+func TestBuildProcesslistQueryTrx(t *testing.T) {
+	cmd := &ListCmd{TrxAge: 90 * time.Second}
+
+	gotQuery, gotArgs, err := buildProcessListQuery(cmd, processListSource{})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, NULL AS THREAD_ID, NULL AS RESOURCE_GROUP, " +
+		"trx_id, trx_state, CAST(trx_started AS CHAR) AS trx_started, TIMESTAMPDIFF(SECOND, trx_started, NOW()) AS trx_age, " +
+		"trx_rows_locked, trx_rows_modified, trx_isolation_level " +
+		"FROM information_schema.processlist LEFT JOIN information_schema.innodb_trx ON trx_mysql_thread_id = ID " +
+		"WHERE trx_id IS NOT NULL AND trx_started <= NOW() - INTERVAL ? SECOND ORDER BY TIME DESC"
+	wantArgs := []any{int64(90)}
+
+	if gotQuery != wantQuery {
+		t.Fatalf("query mismatch:\n%s\n!=\n%s", gotQuery, wantQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Fatalf("args mismatch: %#v != %#v", gotArgs, wantArgs)
+	}
+}
+
+func TestListCmdShowTrx(t *testing.T) {
+	cases := []struct {
+		cmd  ListCmd
+		want bool
+	}{
+		{cmd: ListCmd{}, want: false},
+		{cmd: ListCmd{Trx: true}, want: true},
+		{cmd: ListCmd{InTrx: true}, want: true},
+		{cmd: ListCmd{TrxAge: time.Minute}, want: true},
+	}
+	for _, tc := range cases {
+		if got := tc.cmd.showTrx(); got != tc.want {
+			t.Fatalf("%+v: got %v want %v", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestBuildProcesslistQueryFilters(t *testing.T) {
+	cmd := &ListCmd{Match: "orders", User: []string{"app"}, Where: "time > 10"}
+
+	gotQuery, gotArgs, err := buildProcessListQuery(cmd, processListSource{})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, NULL AS THREAD_ID, NULL AS RESOURCE_GROUP FROM information_schema.processlist " +
+		"WHERE INFO REGEXP ? AND USER IN (?) AND COALESCE(TIME > ?, FALSE) ORDER BY TIME DESC"
+	wantArgs := []any{"orders", "app", int64(10)}
+
+	if gotQuery != wantQuery {
+		t.Fatalf("query mismatch:\n%s\n!=\n%s", gotQuery, wantQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Fatalf("args mismatch: %#v != %#v", gotArgs, wantArgs)
+	}
+
+	if _, _, err := buildProcessListQuery(&ListCmd{Where: "nope"}, processListSource{}); err == nil {
+		t.Fatalf("expected error for invalid --where")
+	}
+}
+
+func TestBuildProcesslistQuerySortLimit(t *testing.T) {
+	cases := []struct {
+		cmd       ListCmd
+		wantTail  string
+		wantArgs  []any
+		wantTrxOn bool
+	}{
+		{cmd: ListCmd{Limit: 5}, wantTail: " ORDER BY TIME DESC LIMIT ?", wantArgs: []any{5}},
+		{cmd: ListCmd{Sort: "user"}, wantTail: " ORDER BY USER ASC"},
+		{cmd: ListCmd{Sort: "-TRX_AGE", Limit: 3}, wantTail: " ORDER BY trx_age DESC LIMIT ?", wantArgs: []any{3}, wantTrxOn: true},
+		// Computed columns are sorted and limited on the client.
+		{cmd: ListCmd{Sort: "fingerprint", Limit: 3}, wantTail: " ORDER BY TIME DESC"},
+		{cmd: ListCmd{GroupBy: "user", Limit: 3}, wantTail: " ORDER BY TIME DESC"},
+	}
+	for _, tc := range cases {
+		query, args, err := buildProcessListQuery(&tc.cmd, processListSource{})
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.cmd, err)
+		}
+		if !strings.HasSuffix(query, tc.wantTail) {
+			t.Fatalf("%+v: query %q does not end with %q", tc.cmd, query, tc.wantTail)
+		}
+		if len(args) != len(tc.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tc.wantArgs)) {
+			t.Fatalf("%+v: args %#v != %#v", tc.cmd, args, tc.wantArgs)
+		}
+		if got := strings.Contains(query, "innodb_trx"); got != tc.wantTrxOn {
+			t.Fatalf("%+v: trx join %v, want %v", tc.cmd, got, tc.wantTrxOn)
+		}
+	}
+}
+
+func TestListColumnsSelection(t *testing.T) {
+	cmd := &ListCmd{Columns: []string{"id", "fingerprint_id", "Trx_Age", "info"}}
+	if !cmd.showTrx() {
+		t.Fatalf("trx columns should imply the trx join")
+	}
+	cols, err := listColumns(cmd, processListSource{}, killPrivileges{})
+	if err != nil {
+		t.Fatalf("listColumns: %v", err)
+	}
+	var names []string
+	for _, c := range cols {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"ID", "FINGERPRINT_ID", "TRX_AGE", "INFO"}) {
+		t.Fatalf("unexpected columns: %v", names)
+	}
+
+	if _, err := listColumns(&ListCmd{Columns: []string{"bogus"}}, processListSource{}, killPrivileges{}); err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Fatalf("expected unknown column error, got %v", err)
+	}
+}
+
+func TestListInfoTruncation(t *testing.T) {
+	info := "SELECT *\n\tFROM orders\n WHERE id IN (" + strings.Repeat("1, ", 60) + "1)"
+	row := Process{ID: 1, Info: sql.NullString{String: info, Valid: true}}
+
+	short, err := listColumns(&ListCmd{Columns: []string{"info"}}, processListSource{}, killPrivileges{})
+	if err != nil {
+		t.Fatalf("listColumns: %v", err)
+	}
+	got := short[0].Value(row)
+	if strings.ContainsAny(got, "\n\t") || len([]rune(got)) != infoMaxWidth || !strings.HasPrefix(got, "SELECT * FROM orders WHERE") || !strings.HasSuffix(got, "...") {
+		t.Fatalf("unexpected truncated INFO: %q", got)
+	}
+
+	full, err := listColumns(&ListCmd{Columns: []string{"info"}, Full: true}, processListSource{}, killPrivileges{})
+	if err != nil {
+		t.Fatalf("listColumns: %v", err)
+	}
+	if got := full[0].Value(row); got != info {
+		t.Fatalf("--full should keep INFO as is, got %q", got)
+	}
+}
+
+func TestSortProcessRows(t *testing.T) {
+	rows := []Process{
+		{ID: 1, Info: sql.NullString{String: "select b", Valid: true}},
+		{ID: 2, Info: sql.NullString{String: "select a", Valid: true}},
+		{ID: 10},
+	}
+	col, err := lookupListColumn(listColumnDefs(killPrivileges{}, false), "fingerprint")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	sortProcessRows(rows, col, false)
+	if got := []int64{rows[0].ID, rows[1].ID, rows[2].ID}; !reflect.DeepEqual(got, []int64{10, 2, 1}) {
+		t.Fatalf("ascending: %v", got)
+	}
+
+	idCol, _ := lookupListColumn(listColumnDefs(killPrivileges{}, false), "id")
+	sortProcessRows(rows, idCol, true)
+	if got := []int64{rows[0].ID, rows[1].ID, rows[2].ID}; !reflect.DeepEqual(got, []int64{10, 2, 1}) {
+		t.Fatalf("numeric descending: %v", got)
+	}
+}
+
+func TestProcessDerived(t *testing.T) {
+	p := Process{
+		ID:   7,
+		Time: sql.NullInt64{Int64: 90, Valid: true},
+		Info: sql.NullString{String: "SELECT * FROM users WHERE id = 42", Valid: true},
+	}
+	if p.Fingerprint() != fingerprint(p.Info.String) || p.FingerprintID() != fingerprintID(p.Info.String) || p.FingerprintID() == "" {
+		t.Fatalf("fingerprint: %q %q", p.Fingerprint(), p.FingerprintID())
+	}
+	if p.Elapsed() != 90*time.Second {
+		t.Fatalf("elapsed: %v", p.Elapsed())
+	}
+	if _, ok := p.TrxAge(); ok {
+		t.Fatal("expected no transaction")
+	}
+	p.Trx = &Transaction{Age: sql.NullInt64{Int64: 30, Valid: true}}
+	if age, ok := p.TrxAge(); !ok || age != 30*time.Second {
+		t.Fatalf("trx age: %v %v", age, ok)
+	}
+
+	idle := Process{ID: 8}
+	if idle.Fingerprint() != "" || idle.FingerprintID() != "" {
+		t.Fatalf("idle fingerprint: %q %q", idle.Fingerprint(), idle.FingerprintID())
+	}
+}
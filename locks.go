@@ -0,0 +1,274 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lockWait is an edge of the wait-for graph: Waiting waits for a lock held
+// by Blocking. Both are processlist IDs.
+type lockWait struct {
+	Waiting  int64
+	Blocking int64
+}
+
+// lockGraph is the InnoDB wait-for graph between sessions.
+type lockGraph struct {
+	// blockers maps a waiting session to the sessions it waits for.
+	blockers map[int64][]int64
+	// waiters maps a blocking session to the sessions waiting for it.
+	waiters map[int64][]int64
+}
+
+// newLockGraph builds a wait-for graph from lock waits.
+func newLockGraph(waits []lockWait) *lockGraph {
+	g := &lockGraph{
+		blockers: make(map[int64][]int64),
+		waiters:  make(map[int64][]int64),
+	}
+	for _, w := range waits {
+		if w.Waiting == w.Blocking || slices.Contains(g.blockers[w.Waiting], w.Blocking) {
+			continue
+		}
+		g.blockers[w.Waiting] = append(g.blockers[w.Waiting], w.Blocking)
+		g.waiters[w.Blocking] = append(g.waiters[w.Blocking], w.Waiting)
+	}
+	for _, ids := range g.blockers {
+		slices.Sort(ids)
+	}
+	for _, ids := range g.waiters {
+		slices.Sort(ids)
+	}
+	return g
+}
+
+// roots returns the head blockers: sessions blocking others while not
+// waiting themselves.
+func (g *lockGraph) roots() []int64 {
+	var roots []int64
+	for id := range g.waiters {
+		if len(g.blockers[id]) == 0 {
+			roots = append(roots, id)
+		}
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// rootsOf returns the head blockers that process id transitively waits for.
+func (g *lockGraph) rootsOf(id int64) ([]int64, error) {
+	if len(g.blockers[id]) == 0 {
+		return nil, fmt.Errorf("process %d is not waiting on a lock", id)
+	}
+
+	var roots []int64
+	visited := map[int64]bool{id: true}
+	stack := slices.Clone(g.blockers[id])
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[cur] {
+			continue
+		}
+		visited[cur] = true
+		if len(g.blockers[cur]) == 0 {
+			roots = append(roots, cur)
+			continue
+		}
+		stack = append(stack, g.blockers[cur]...)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("process %d is part of a lock wait cycle with no head blocker", id)
+	}
+	slices.Sort(roots)
+	return roots, nil
+}
+
+// waitingCount returns how many sessions transitively wait for id.
+func (g *lockGraph) waitingCount(id int64) int {
+	visited := map[int64]bool{id: true}
+	queue := slices.Clone(g.waiters[id])
+	count := 0
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if visited[cur] {
+			continue
+		}
+		visited[cur] = true
+		count++
+		queue = append(queue, g.waiters[cur]...)
+	}
+	return count
+}
+
+// runLocks executes the locks command.
+func runLocks(ctx context.Context, cli *CLI) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return fmt.Errorf("locks is not supported with target proxysql")
+	}
+
+	c, err := newClient(ctx, cfg, "locks")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if _, err := c.checkReader(ctx); err != nil {
+		return err
+	}
+
+	waits, err := fetchLockWaits(ctx, c.db)
+	if err != nil {
+		return err
+	}
+	if len(waits) == 0 {
+		fmt.Println("no lock waits")
+		return nil
+	}
+
+	rows, err := fetchProcessList(ctx, c.db, c.f, c.src, &ListCmd{Trx: true})
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]Process, len(rows))
+	for _, r := range cfg.Redaction.Rows(rows) {
+		byID[r.ID] = r
+	}
+
+	return writeLockTree(os.Stdout, newLockGraph(waits), byID)
+}
+
+// fetchLockWaits reads lock waits from performance_schema.data_lock_waits
+// (MySQL 8.0), falling back to information_schema.innodb_lock_waits (5.7,
+// MariaDB).
+func fetchLockWaits(ctx context.Context, db *sql.DB) ([]lockWait, error) {
+	const pfsQuery = `
+SELECT r.trx_mysql_thread_id, b.trx_mysql_thread_id
+FROM performance_schema.data_lock_waits w
+JOIN information_schema.innodb_trx r ON r.trx_id = w.REQUESTING_ENGINE_TRANSACTION_ID
+JOIN information_schema.innodb_trx b ON b.trx_id = w.BLOCKING_ENGINE_TRANSACTION_ID`
+	const isQuery = `
+SELECT r.trx_mysql_thread_id, b.trx_mysql_thread_id
+FROM information_schema.innodb_lock_waits w
+JOIN information_schema.innodb_trx r ON r.trx_id = w.requesting_trx_id
+JOIN information_schema.innodb_trx b ON b.trx_id = w.blocking_trx_id`
+
+	waits, err := queryLockWaits(ctx, db, pfsQuery)
+	if err != nil && isMissingObjectError(err) {
+		waits, err = queryLockWaits(ctx, db, isQuery)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query lock waits: %w", err)
+	}
+	return waits, nil
+}
+
+// queryLockWaits runs a waiting/blocking thread ID query.
+func queryLockWaits(ctx context.Context, db *sql.DB, query string) ([]lockWait, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var waits []lockWait
+	for rows.Next() {
+		var w lockWait
+		if err := rows.Scan(&w.Waiting, &w.Blocking); err != nil {
+			return nil, err
+		}
+		waits = append(waits, w)
+	}
+	return waits, rows.Err()
+}
+
+// rootBlockersOf returns the head blockers of waiting process id.
+func rootBlockersOf(ctx context.Context, db *sql.DB, id int64) ([]int64, error) {
+	waits, err := fetchLockWaits(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return newLockGraph(waits).rootsOf(id)
+}
+
+// writeLockTree prints the blocking tree under each head blocker.
+func writeLockTree(w io.Writer, g *lockGraph, rows map[int64]Process) error {
+	var write func(id int64, prefix, branch string, path map[int64]bool) error
+	write = func(id int64, prefix, branch string, path map[int64]bool) error {
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, branch, lockNodeLabel(g, id, rows)); err != nil {
+			return fmt.Errorf("write lock tree: %w", err)
+		}
+		if path[id] {
+			return nil
+		}
+		path[id] = true
+		defer delete(path, id)
+
+		childPrefix := prefix
+		switch branch {
+		case "├─ ":
+			childPrefix += "│  "
+		case "└─ ":
+			childPrefix += "   "
+		}
+		children := g.waiters[id]
+		for i, child := range children {
+			b := "├─ "
+			if i == len(children)-1 {
+				b = "└─ "
+			}
+			if err := write(child, childPrefix, b, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range g.roots() {
+		if err := write(root, "", "", map[int64]bool{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockNodeLabel describes a session in the lock tree.
+func lockNodeLabel(g *lockGraph, id int64, rows map[int64]Process) string {
+	parts := []string{strconv.FormatInt(id, 10)}
+	if r, ok := rows[id]; ok {
+		parts = append(parts, nullString(r.User), nullString(r.Command))
+		if r.Time.Valid {
+			parts = append(parts, "time="+nullInt(r.Time)+"s")
+		}
+		if r.Trx != nil && r.Trx.Age.Valid {
+			parts = append(parts, "trx_age="+nullInt(r.Trx.Age)+"s")
+		}
+	}
+	if n := g.waitingCount(id); n > 0 {
+		parts = append(parts, "waiting="+strconv.Itoa(n))
+	}
+	if r, ok := rows[id]; ok && r.Info.Valid {
+		parts = append(parts, flattenSpace(r.Info.String))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// formatIDs formats process IDs as a comma-separated list.
+func formatIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,104 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestLockGraph(t *testing.T) {
+	// 1 blocks 2 and 3, 3 blocks 4; 5 blocks 6; 4 also waits for 5.
+	g := newLockGraph([]lockWait{
+		{Waiting: 2, Blocking: 1},
+		{Waiting: 3, Blocking: 1},
+		{Waiting: 4, Blocking: 3},
+		{Waiting: 4, Blocking: 3},
+		{Waiting: 6, Blocking: 5},
+		{Waiting: 4, Blocking: 5},
+	})
+
+	if got := g.roots(); !reflect.DeepEqual(got, []int64{1, 5}) {
+		t.Fatalf("roots: got %v", got)
+	}
+
+	got, err := g.rootsOf(4)
+	if err != nil {
+		t.Fatalf("rootsOf: %v", err)
+	}
+	if !reflect.DeepEqual(got, []int64{1, 5}) {
+		t.Fatalf("rootsOf(4): got %v", got)
+	}
+
+	got, err = g.rootsOf(2)
+	if err != nil {
+		t.Fatalf("rootsOf: %v", err)
+	}
+	if !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("rootsOf(2): got %v", got)
+	}
+
+	if _, err := g.rootsOf(1); err == nil {
+		t.Fatalf("expected error for a process that is not waiting")
+	}
+
+	if n := g.waitingCount(1); n != 3 {
+		t.Fatalf("waitingCount(1): got %d want 3", n)
+	}
+	if n := g.waitingCount(5); n != 2 {
+		t.Fatalf("waitingCount(5): got %d want 2", n)
+	}
+}
+
+func TestLockGraphCycle(t *testing.T) {
+	g := newLockGraph([]lockWait{
+		{Waiting: 1, Blocking: 2},
+		{Waiting: 2, Blocking: 1},
+	})
+	if _, err := g.rootsOf(1); err == nil {
+		t.Fatalf("expected error for a cycle")
+	}
+}
+
+func TestWriteLockTree(t *testing.T) {
+	g := newLockGraph([]lockWait{
+		{Waiting: 2, Blocking: 1},
+		{Waiting: 3, Blocking: 1},
+		{Waiting: 4, Blocking: 3},
+	})
+	rows := map[int64]Process{
+		1: {
+			ID:      1,
+			User:    sql.NullString{String: "batch", Valid: true},
+			Command: sql.NullString{String: "Sleep", Valid: true},
+			Time:    sql.NullInt64{Int64: 300, Valid: true},
+			Trx:     &Transaction{Age: sql.NullInt64{Int64: 310, Valid: true}},
+		},
+		3: {
+			ID:      3,
+			User:    sql.NullString{String: "app", Valid: true},
+			Command: sql.NullString{String: "Query", Valid: true},
+			Time:    sql.NullInt64{Int64: 12, Valid: true},
+			Info:    sql.NullString{String: "UPDATE t\n  SET a = 1", Valid: true},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeLockTree(&buf, g, rows); err != nil {
+		t.Fatalf("writeLockTree: %v", err)
+	}
+
+	want := "1  batch  Sleep  time=300s  trx_age=310s  waiting=3\n" +
+		"├─ 2\n" +
+		"└─ 3  app  Query  time=12s  waiting=1  UPDATE t SET a = 1\n" +
+		"   └─ 4\n"
+	if buf.String() != want {
+		t.Fatalf("tree mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestFormatIDs(t *testing.T) {
+	if got := formatIDs([]int64{3, 14}); got != "3, 14" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,309 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// mdlLockCodes abbreviates table-level MDL types for the compatibility matrix.
+var mdlLockCodes = map[string]string{
+	"SHARED":                "S",
+	"SHARED_HIGH_PRIO":      "SH",
+	"SHARED_READ":           "SR",
+	"SHARED_WRITE":          "SW",
+	"SHARED_WRITE_LOW_PRIO": "SWLP",
+	"SHARED_UPGRADABLE":     "SU",
+	"SHARED_READ_ONLY":      "SRO",
+	"SHARED_NO_WRITE":       "SNW",
+	"SHARED_NO_READ_WRITE":  "SNRW",
+	"EXCLUSIVE":             "X",
+}
+
+// mdlTableIncompatible lists, per requested table lock, the granted locks it
+// conflicts with (MySQL's MDL_object_lock granted-compatibility matrix).
+var mdlTableIncompatible = map[string][]string{
+	"S":    {"X"},
+	"SH":   {"X"},
+	"SR":   {"SNRW", "X"},
+	"SW":   {"SRO", "SNW", "SNRW", "X"},
+	"SWLP": {"SRO", "SNW", "SNRW", "X"},
+	"SU":   {"SU", "SNW", "SNRW", "X"},
+	"SRO":  {"SW", "SWLP", "SNW", "SNRW", "X"},
+	"SNW":  {"SW", "SWLP", "SU", "SNW", "SNRW", "X"},
+	"SNRW": {"SR", "SW", "SWLP", "SU", "SRO", "SNW", "SNRW", "X"},
+	"X":    {"S", "SH", "SR", "SW", "SWLP", "SU", "SRO", "SNW", "SNRW", "X"},
+}
+
+// mdlConflicts reports whether a pending MDL request conflicts with a
+// granted lock on the same object. Scoped locks (GLOBAL, SCHEMA, ...) use
+// intention-exclusive semantics; unknown lock types are assumed to conflict.
+func mdlConflicts(objectType, requested, granted string) bool {
+	scoped := requested == "INTENTION_EXCLUSIVE" || granted == "INTENTION_EXCLUSIVE" ||
+		(objectType != "TABLE" && objectType != "FUNCTION" && objectType != "PROCEDURE" &&
+			objectType != "TRIGGER" && objectType != "EVENT")
+	if scoped {
+		if requested == "INTENTION_EXCLUSIVE" && granted == "INTENTION_EXCLUSIVE" {
+			return false
+		}
+		if requested == "SHARED" && granted == "SHARED" {
+			return false
+		}
+		return true
+	}
+
+	req, ok := mdlLockCodes[requested]
+	if !ok {
+		return true
+	}
+	gr, ok := mdlLockCodes[granted]
+	if !ok {
+		return true
+	}
+	return slices.Contains(mdlTableIncompatible[req], gr)
+}
+
+// mdlHolder is a session holding a granted MDL that blocks a waiter.
+type mdlHolder struct {
+	ID       int64
+	LockType string
+	Duration string
+}
+
+// mdlWait is a pending MDL request and the sessions blocking it.
+type mdlWait struct {
+	WaitingID  int64
+	ObjectType string
+	Object     string
+	LockType   string
+	Holders    []mdlHolder
+}
+
+// mdlLockRow is a pending request paired with a granted lock on the same object.
+type mdlLockRow struct {
+	ObjectType     string
+	Schema         sql.NullString
+	Name           sql.NullString
+	WaitingID      int64
+	WaitingType    string
+	HolderID       int64
+	HolderType     string
+	HolderDuration string
+}
+
+// groupMDLWaits keeps the conflicting pairs and groups them by waiter.
+func groupMDLWaits(rows []mdlLockRow) []mdlWait {
+	var waits []mdlWait
+	index := make(map[string]int)
+	for _, r := range rows {
+		if !mdlConflicts(r.ObjectType, r.WaitingType, r.HolderType) {
+			continue
+		}
+		object := nullString(r.Schema)
+		if name := nullString(r.Name); name != "" {
+			if object != "" {
+				object += "."
+			}
+			object += name
+		}
+		key := fmt.Sprintf("%d/%s/%s/%s", r.WaitingID, r.ObjectType, object, r.WaitingType)
+		i, ok := index[key]
+		if !ok {
+			i = len(waits)
+			index[key] = i
+			waits = append(waits, mdlWait{
+				WaitingID:  r.WaitingID,
+				ObjectType: r.ObjectType,
+				Object:     object,
+				LockType:   r.WaitingType,
+			})
+		}
+		h := mdlHolder{ID: r.HolderID, LockType: r.HolderType, Duration: r.HolderDuration}
+		if !slices.Contains(waits[i].Holders, h) {
+			waits[i].Holders = append(waits[i].Holders, h)
+		}
+	}
+	return waits
+}
+
+// mdlHolderIDs returns the distinct holder IDs, optionally limited to the
+// holders blocking waiting process waitingID.
+func mdlHolderIDs(waits []mdlWait, waitingID int64) []int64 {
+	var ids []int64
+	for _, w := range waits {
+		if waitingID != 0 && w.WaitingID != waitingID {
+			continue
+		}
+		for _, h := range w.Holders {
+			if !slices.Contains(ids, h.ID) {
+				ids = append(ids, h.ID)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// runMDL executes the mdl command.
+func runMDL(ctx context.Context, cli *CLI, cmd *MDLCmd) error {
+	if cmd.Kill && cmd.KillQuery {
+		return errors.New("--kill and --kill-query are mutually exclusive")
+	}
+
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return errors.New("mdl is not supported with target proxysql")
+	}
+
+	c, err := newClient(ctx, cfg, "mdl")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	verdict, err := c.checkReader(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkMDLInstrument(ctx, c.db); err != nil {
+		return err
+	}
+
+	lockRows, err := fetchMDLLocks(ctx, c.db)
+	if err != nil {
+		return err
+	}
+	waits := groupMDLWaits(lockRows)
+	if cmd.Waiting != 0 {
+		waits = slices.DeleteFunc(waits, func(w mdlWait) bool { return w.WaitingID != cmd.Waiting })
+	}
+	if len(waits) == 0 {
+		fmt.Println("no metadata lock waits")
+		return nil
+	}
+
+	rows, err := fetchProcessList(ctx, c.db, c.f, c.src, &ListCmd{})
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]Process, len(rows))
+	for _, r := range cfg.Redaction.Rows(rows) {
+		byID[r.ID] = r
+	}
+
+	if err := writeMDLWaits(os.Stdout, waits, byID); err != nil {
+		return err
+	}
+
+	if !cmd.Kill && !cmd.KillQuery {
+		return nil
+	}
+	au, err := c.auditor()
+	if err != nil {
+		return err
+	}
+	au.setServer(c.f.Name(), verdict)
+
+	kill := &KillCmd{Kill: cmd.Kill, KillQuery: cmd.KillQuery, DryRun: cmd.DryRun}
+	_, err = killProcesses(ctx, os.Stdout, c, kill, mdlHolderIDs(waits, cmd.Waiting), au, c.allow)
+	return err
+}
+
+// checkMDLInstrument fails when metadata locks are not instrumented, since
+// metadata_locks would then be empty instead of showing the waits.
+func checkMDLInstrument(ctx context.Context, db *sql.DB) error {
+	var enabled string
+	err := db.QueryRowContext(ctx, "SELECT ENABLED FROM performance_schema.setup_instruments WHERE NAME = 'wait/lock/metadata/sql/mdl'").Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) || isMissingObjectError(err) {
+		return errors.New("performance_schema.metadata_locks is not available on this server")
+	}
+	if err != nil {
+		return fmt.Errorf("check mdl instrument: %w", err)
+	}
+	if !strings.EqualFold(enabled, "YES") {
+		return errors.New("metadata lock instrumentation is disabled: enable the wait/lock/metadata/sql/mdl instrument in performance_schema.setup_instruments")
+	}
+	return nil
+}
+
+// fetchMDLLocks pairs each pending MDL request with the granted locks other
+// sessions hold on the same object.
+func fetchMDLLocks(ctx context.Context, db *sql.DB) ([]mdlLockRow, error) {
+	const query = `
+SELECT w.OBJECT_TYPE, w.OBJECT_SCHEMA, w.OBJECT_NAME, wt.PROCESSLIST_ID, w.LOCK_TYPE,
+       ht.PROCESSLIST_ID, h.LOCK_TYPE, h.LOCK_DURATION
+FROM performance_schema.metadata_locks w
+JOIN performance_schema.threads wt ON wt.THREAD_ID = w.OWNER_THREAD_ID
+JOIN performance_schema.metadata_locks h
+  ON h.OBJECT_TYPE = w.OBJECT_TYPE
+ AND h.OBJECT_SCHEMA <=> w.OBJECT_SCHEMA
+ AND h.OBJECT_NAME <=> w.OBJECT_NAME
+ AND h.LOCK_STATUS = 'GRANTED'
+ AND h.OWNER_THREAD_ID <> w.OWNER_THREAD_ID
+JOIN performance_schema.threads ht ON ht.THREAD_ID = h.OWNER_THREAD_ID
+WHERE w.LOCK_STATUS = 'PENDING'
+  AND wt.PROCESSLIST_ID IS NOT NULL
+  AND ht.PROCESSLIST_ID IS NOT NULL
+ORDER BY wt.PROCESSLIST_ID, ht.PROCESSLIST_ID`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query metadata locks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []mdlLockRow
+	for rows.Next() {
+		var r mdlLockRow
+		if err := rows.Scan(&r.ObjectType, &r.Schema, &r.Name, &r.WaitingID, &r.WaitingType,
+			&r.HolderID, &r.HolderType, &r.HolderDuration); err != nil {
+			return nil, fmt.Errorf("scan metadata locks: %w", err)
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return result, nil
+}
+
+// writeMDLWaits prints each waiting session with the holders blocking it.
+func writeMDLWaits(w io.Writer, waits []mdlWait, rows map[int64]Process) error {
+	for _, wait := range waits {
+		if _, err := fmt.Fprintf(w, "waiting for %s on %s %s: %s\n",
+			wait.LockType, wait.ObjectType, wait.Object, mdlSessionLabel(wait.WaitingID, rows)); err != nil {
+			return fmt.Errorf("write mdl waits: %w", err)
+		}
+		for _, h := range wait.Holders {
+			if _, err := fmt.Fprintf(w, "  held as %s (%s): %s\n",
+				h.LockType, h.Duration, mdlSessionLabel(h.ID, rows)); err != nil {
+				return fmt.Errorf("write mdl waits: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// mdlSessionLabel describes a session in the mdl output.
+func mdlSessionLabel(id int64, rows map[int64]Process) string {
+	parts := []string{fmt.Sprint(id)}
+	if r, ok := rows[id]; ok {
+		parts = append(parts, nullString(r.User), nullString(r.Command))
+		if r.Time.Valid {
+			parts = append(parts, "time="+nullInt(r.Time)+"s")
+		}
+		if r.Info.Valid {
+			parts = append(parts, flattenSpace(r.Info.String))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
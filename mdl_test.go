@@ -0,0 +1,106 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestMDLConflicts(t *testing.T) {
+	cases := []struct {
+		objectType string
+		requested  string
+		granted    string
+		want       bool
+	}{
+		{objectType: "TABLE", requested: "EXCLUSIVE", granted: "SHARED_READ", want: true},
+		{objectType: "TABLE", requested: "SHARED_READ", granted: "SHARED_WRITE", want: false},
+		{objectType: "TABLE", requested: "SHARED_UPGRADABLE", granted: "SHARED_UPGRADABLE", want: true},
+		{objectType: "TABLE", requested: "SHARED_UPGRADABLE", granted: "SHARED_WRITE", want: false},
+		{objectType: "TABLE", requested: "SHARED_WRITE", granted: "SHARED_READ_ONLY", want: true},
+		{objectType: "TABLE", requested: "SHARED_NO_READ_WRITE", granted: "SHARED_HIGH_PRIO", want: false},
+		{objectType: "TABLE", requested: "EXCLUSIVE", granted: "MYSTERY", want: true},
+		{objectType: "SCHEMA", requested: "INTENTION_EXCLUSIVE", granted: "INTENTION_EXCLUSIVE", want: false},
+		{objectType: "GLOBAL", requested: "INTENTION_EXCLUSIVE", granted: "SHARED", want: true},
+		{objectType: "USER LEVEL LOCK", requested: "EXCLUSIVE", granted: "EXCLUSIVE", want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.objectType+"/"+tc.requested+"/"+tc.granted, func(t *testing.T) {
+			if got := mdlConflicts(tc.objectType, tc.requested, tc.granted); got != tc.want {
+				t.Fatalf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGroupMDLWaits(t *testing.T) {
+	schema := sql.NullString{String: "shop", Valid: true}
+	name := sql.NullString{String: "orders", Valid: true}
+	rows := []mdlLockRow{
+		// ALTER waiting on two readers; one compatible pair is dropped.
+		{ObjectType: "TABLE", Schema: schema, Name: name, WaitingID: 10, WaitingType: "EXCLUSIVE", HolderID: 3, HolderType: "SHARED_READ", HolderDuration: "TRANSACTION"},
+		{ObjectType: "TABLE", Schema: schema, Name: name, WaitingID: 10, WaitingType: "EXCLUSIVE", HolderID: 4, HolderType: "SHARED_WRITE", HolderDuration: "TRANSACTION"},
+		{ObjectType: "TABLE", Schema: schema, Name: name, WaitingID: 11, WaitingType: "SHARED_READ", HolderID: 4, HolderType: "SHARED_WRITE", HolderDuration: "TRANSACTION"},
+	}
+
+	waits := groupMDLWaits(rows)
+	want := []mdlWait{
+		{
+			WaitingID:  10,
+			ObjectType: "TABLE",
+			Object:     "shop.orders",
+			LockType:   "EXCLUSIVE",
+			Holders: []mdlHolder{
+				{ID: 3, LockType: "SHARED_READ", Duration: "TRANSACTION"},
+				{ID: 4, LockType: "SHARED_WRITE", Duration: "TRANSACTION"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(waits, want) {
+		t.Fatalf("got %#v want %#v", waits, want)
+	}
+
+	if got := mdlHolderIDs(waits, 0); !reflect.DeepEqual(got, []int64{3, 4}) {
+		t.Fatalf("holder ids: got %v", got)
+	}
+	if got := mdlHolderIDs(waits, 99); len(got) != 0 {
+		t.Fatalf("holder ids for unknown waiter: got %v", got)
+	}
+}
+
+func TestWriteMDLWaits(t *testing.T) {
+	waits := []mdlWait{{
+		WaitingID:  10,
+		ObjectType: "TABLE",
+		Object:     "shop.orders",
+		LockType:   "EXCLUSIVE",
+		Holders:    []mdlHolder{{ID: 3, LockType: "SHARED_READ", Duration: "TRANSACTION"}},
+	}}
+	rows := map[int64]Process{
+		10: {
+			ID:      10,
+			User:    sql.NullString{String: "deploy", Valid: true},
+			Command: sql.NullString{String: "Query", Valid: true},
+			Time:    sql.NullInt64{Int64: 35, Valid: true},
+			Info:    sql.NullString{String: "ALTER TABLE orders ADD COLUMN note TEXT", Valid: true},
+		},
+		3: {
+			ID:      3,
+			User:    sql.NullString{String: "batch", Valid: true},
+			Command: sql.NullString{String: "Sleep", Valid: true},
+			Time:    sql.NullInt64{Int64: 600, Valid: true},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeMDLWaits(&buf, waits, rows); err != nil {
+		t.Fatalf("writeMDLWaits: %v", err)
+	}
+	want := "waiting for EXCLUSIVE on TABLE shop.orders: 10  deploy  Query  time=35s  ALTER TABLE orders ADD COLUMN note TEXT\n" +
+		"  held as SHARED_READ (TRANSACTION): 3  batch  Sleep  time=600s\n"
+	if buf.String() != want {
+		t.Fatalf("output mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
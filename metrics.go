@@ -0,0 +1,275 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFingerprintLabels is how many query fingerprints the kill metrics label
+// by ID; the fingerprints seen after them are labeled "other".
+const maxFingerprintLabels = 20
+
+// pollBuckets are the upper bounds, in seconds, of the poll latency histogram.
+var pollBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics are the Prometheus metrics of the watch daemon, exposed in the
+// text format on /metrics.
+type metrics struct {
+	mu sync.Mutex
+
+	kills             *metricVec
+	killFailures      *metricVec
+	polls             *metricVec
+	pollDuration      *histogram
+	longRunning       *metricVec
+	reconnects        *metricVec
+	writerRefusals    *metricVec
+	lastPollTimestamp *metricVec
+
+	// users are the MySQL users named by the rules; the kill metrics label
+	// any other user "other", so their series stay bounded.
+	users map[string]bool
+	// fingerprints are the fingerprint IDs labeled so far.
+	fingerprints map[string]bool
+}
+
+// newMetrics returns zeroed metrics for rules.
+func newMetrics(rules []Rule) *metrics {
+	users := make(map[string]bool)
+	for _, r := range rules {
+		for _, u := range r.Filter.Users {
+			users[u] = true
+		}
+	}
+	return &metrics{
+		users:        users,
+		fingerprints: make(map[string]bool),
+		kills: newMetricVec("mysql_kill_kills_total", "counter",
+			"Sessions killed, by rule, MySQL user named by the rules, query fingerprint ID and dry run.", "rule", "user", "fingerprint", "dry_run"),
+		killFailures: newMetricVec("mysql_kill_kill_failures_total", "counter",
+			"Kill attempts that failed or were refused, by rule, MySQL user named by the rules and query fingerprint ID.", "rule", "user", "fingerprint"),
+		polls: newMetricVec("mysql_kill_processlist_polls_total", "counter",
+			"Processlist polls, by result (ok or error).", "result"),
+		pollDuration: &histogram{
+			name:    "mysql_kill_processlist_poll_duration_seconds",
+			help:    "Latency of processlist polls.",
+			buckets: pollBuckets,
+			counts:  make([]uint64, len(pollBuckets)),
+		},
+		longRunning: newMetricVec("mysql_kill_long_running_sessions", "gauge",
+			"Non-sleeping sessions running for at least --long-time at the last poll, by state.", "state"),
+		reconnects: newMetricVec("mysql_kill_reconnects_total", "counter",
+			"Reconnections to the target after a failed poll, by path (ssh or direct).", "via"),
+		writerRefusals: newMetricVec("mysql_kill_writer_refusals_total", "counter",
+			"Kill cycles skipped because the reader guard detected a writer."),
+		lastPollTimestamp: newMetricVec("mysql_kill_last_poll_timestamp_seconds", "gauge",
+			"Unix time of the last successful processlist poll."),
+	}
+}
+
+// observeKill counts a kill attempt recorded by an auditor.
+func (m *metrics) observeKill(rec auditRecord) {
+	var user, fp string
+	if p := rec.Process; p != nil {
+		user, fp = p.User, p.FingerprintID
+	}
+	if user != "" && !m.users[user] {
+		user = "other"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fp = m.fingerprintLabel(fp)
+	switch rec.Outcome {
+	case auditOK, auditDryRun:
+		m.kills.add(1, rec.Rule, user, fp, strconv.FormatBool(rec.DryRun))
+	case auditError, auditRefused:
+		m.killFailures.add(1, rec.Rule, user, fp)
+	}
+}
+
+// fingerprintLabel returns the label of fingerprint ID fp: the ID for the
+// first maxFingerprintLabels IDs seen, else "other". Call with m.mu held.
+func (m *metrics) fingerprintLabel(fp string) string {
+	if fp == "" || m.fingerprints[fp] {
+		return fp
+	}
+	if len(m.fingerprints) >= maxFingerprintLabels {
+		return "other"
+	}
+	m.fingerprints[fp] = true
+	return fp
+}
+
+// observePoll records the result and latency of a processlist poll.
+func (m *metrics) observePoll(d time.Duration, err error, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.polls.add(1, "error")
+		return
+	}
+	m.polls.add(1, "ok")
+	m.pollDuration.observe(d.Seconds())
+	m.lastPollTimestamp.set(float64(at.Unix()))
+}
+
+// setLongRunning replaces the long-running session counts.
+func (m *metrics) setLongRunning(byState map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.longRunning.reset()
+	for state, n := range byState {
+		m.longRunning.set(float64(n), state)
+	}
+}
+
+// observeReconnect counts a reconnection to the target.
+func (m *metrics) observeReconnect(tunnel bool) {
+	via := "direct"
+	if tunnel {
+		via = "ssh"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects.add(1, via)
+}
+
+// observeWriterRefusal counts a cycle refused by the reader guard.
+func (m *metrics) observeWriterRefusal() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writerRefusals.add(1)
+}
+
+// write prints the metrics in the Prometheus text format.
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	var b bytes.Buffer
+	m.kills.write(&b)
+	m.killFailures.write(&b)
+	m.polls.write(&b)
+	m.pollDuration.write(&b)
+	m.longRunning.write(&b)
+	m.reconnects.write(&b)
+	m.writerRefusals.write(&b)
+	m.lastPollTimestamp.write(&b)
+	m.mu.Unlock()
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ServeHTTP serves /metrics.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.write(w)
+}
+
+// metricVec is a counter or gauge with labels. A metric without labels has
+// a single series, reported even before it is first set.
+type metricVec struct {
+	name   string
+	typ    string
+	help   string
+	labels []string
+	series map[string]*series
+}
+
+// series is one label combination of a metricVec.
+type series struct {
+	values []string
+	value  float64
+}
+
+func newMetricVec(name, typ, help string, labels ...string) *metricVec {
+	v := &metricVec{name: name, typ: typ, help: help, labels: labels, series: make(map[string]*series)}
+	if len(labels) == 0 {
+		v.series[""] = &series{}
+	}
+	return v
+}
+
+func (v *metricVec) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: values}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) add(delta float64, values ...string) {
+	v.get(values).value += delta
+}
+
+func (v *metricVec) set(value float64, values ...string) {
+	v.get(values).value = value
+}
+
+func (v *metricVec) reset() {
+	clear(v.series)
+}
+
+func (v *metricVec) write(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+	for _, key := range slices.Sorted(maps.Keys(v.series)) {
+		s := v.series[key]
+		fmt.Fprintf(b, "%s%s %s\n", v.name, formatLabels(v.labels, s.values), formatFloat(s.value))
+	}
+}
+
+// histogram is a Prometheus histogram without labels.
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, le := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(le), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+// formatLabels formats a label set, e.g. {user="app",state="Sending data"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats a sample value.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,83 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics([]Rule{{Name: "redash-long", Filter: Filter{Users: []string{"redash"}}}})
+	at := time.Unix(1792315800, 0)
+	m.observePoll(30*time.Millisecond, nil, at)
+	m.observePoll(2*time.Second, nil, at)
+	m.observePoll(0, errors.New("connection refused"), at.Add(time.Second))
+	m.setLongRunning(map[string]int{"Sending data": 3, "": 1})
+	m.setLongRunning(map[string]int{"Sending data": 2, `waiting for "lock"`: 1})
+	m.observeReconnect(true)
+	m.observeWriterRefusal()
+
+	victim := &auditProcess{User: "redash", FingerprintID: "0123456789ABCDEF"}
+	m.observeKill(auditRecord{Rule: "redash-long", Process: victim, Outcome: auditOK})
+	m.observeKill(auditRecord{Rule: "redash-long", Process: victim, Outcome: auditOK})
+	m.observeKill(auditRecord{Rule: "redash-long", Process: victim, DryRun: true, Outcome: auditDryRun})
+	m.observeKill(auditRecord{Rule: "redash-long", Outcome: auditRefused})
+	m.observeKill(auditRecord{Rule: "redash-long", Process: &auditProcess{User: "app"}, Outcome: auditOK})
+	for i := range maxFingerprintLabels {
+		m.observeKill(auditRecord{Rule: "bulk", Process: &auditProcess{FingerprintID: fmt.Sprintf("%016X", i)}, Outcome: auditOK})
+	}
+
+	var b bytes.Buffer
+	if err := m.write(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE mysql_kill_kills_total counter\n",
+		`mysql_kill_kills_total{rule="redash-long",user="redash",fingerprint="0123456789ABCDEF",dry_run="false"} 2` + "\n",
+		`mysql_kill_kills_total{rule="redash-long",user="redash",fingerprint="0123456789ABCDEF",dry_run="true"} 1` + "\n",
+		`mysql_kill_kills_total{rule="redash-long",user="other",fingerprint="",dry_run="false"} 1` + "\n",
+		`mysql_kill_kills_total{rule="bulk",user="",fingerprint="0000000000000012",dry_run="false"} 1` + "\n",
+		`mysql_kill_kills_total{rule="bulk",user="",fingerprint="other",dry_run="false"} 1` + "\n",
+		`mysql_kill_kill_failures_total{rule="redash-long",user="",fingerprint=""} 1` + "\n",
+		`mysql_kill_processlist_polls_total{result="error"} 1` + "\n",
+		`mysql_kill_processlist_polls_total{result="ok"} 2` + "\n",
+		"# TYPE mysql_kill_processlist_poll_duration_seconds histogram\n",
+		`mysql_kill_processlist_poll_duration_seconds_bucket{le="0.025"} 0` + "\n",
+		`mysql_kill_processlist_poll_duration_seconds_bucket{le="0.05"} 1` + "\n",
+		`mysql_kill_processlist_poll_duration_seconds_bucket{le="2.5"} 2` + "\n",
+		`mysql_kill_processlist_poll_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"mysql_kill_processlist_poll_duration_seconds_sum 2.03\n",
+		"mysql_kill_processlist_poll_duration_seconds_count 2\n",
+		`mysql_kill_long_running_sessions{state="Sending data"} 2` + "\n",
+		`mysql_kill_long_running_sessions{state="waiting for \"lock\""} 1` + "\n",
+		`mysql_kill_reconnects_total{via="ssh"} 1` + "\n",
+		"mysql_kill_writer_refusals_total 1\n",
+		"mysql_kill_last_poll_timestamp_seconds 1.7923158e+09\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `state=""`) {
+		t.Fatalf("stale long-running series kept:\n%s", out)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newMetrics(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type: %q", ct)
+	}
+	// Unlabeled metrics are reported before they are first set.
+	if !strings.Contains(string(body), "mysql_kill_writer_refusals_total 0\n") {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
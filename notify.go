@@ -0,0 +1,163 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification types.
+const (
+	notifyWebhook = "webhook"
+	notifySlack   = "slack"
+)
+
+// defaultNotifyBody posts the audit record itself.
+const defaultNotifyBody = `{{json .}}`
+
+// defaultNotifyText is the default Slack message.
+const defaultNotifyText = `mysql-kill {{.Outcome}}{{if .DryRun}} (dry run){{end}}: {{.OSUser}} ran {{printf "%q" .SQL}} on {{.Target}}{{with .Profile}} [{{.}}]{{end}}` +
+	`{{with .Process}}
+victim: {{.User}}@{{.Host}}{{with .DB}}/{{.}}{{end}}, {{.Time}}s: {{.Info}}{{end}}{{with .Error}}
+error: {{.}}{{end}}`
+
+// notifyBackoff is the delay before the first retry; it doubles each retry.
+const notifyBackoff = 500 * time.Millisecond
+
+// notifyFuncs are the functions available to notification templates.
+var notifyFuncs = template.FuncMap{
+	// json encodes a value, so strings can be embedded in a JSON body.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// notifier posts kill attempts to a webhook.
+type notifier struct {
+	cfg     NotifyConfig
+	tmpl    *template.Template
+	client  *http.Client
+	backoff time.Duration
+}
+
+// newNotifier parses the template of cfg.
+func newNotifier(cfg NotifyConfig) (*notifier, error) {
+	text := cfg.Body
+	if cfg.Type == notifySlack {
+		text = cfg.Text
+	}
+	if text == "" {
+		text = defaultNotifyBody
+		if cfg.Type == notifySlack {
+			text = defaultNotifyText
+		}
+	}
+	tmpl, err := template.New(cfg.Type).Funcs(notifyFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notify %s: parse template: %w", cfg.Type, err)
+	}
+	return &notifier{
+		cfg:     cfg,
+		tmpl:    tmpl,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		backoff: notifyBackoff,
+	}, nil
+}
+
+// String names the notifier without its URL, which often embeds a secret.
+func (n *notifier) String() string {
+	if u, err := url.Parse(n.cfg.URL); err == nil && u.Host != "" {
+		return n.cfg.Type + " " + u.Host
+	}
+	return n.cfg.Type
+}
+
+// wants reports whether attempts with outcome are notified.
+func (n *notifier) wants(outcome string) bool {
+	for _, o := range n.cfg.On {
+		if o == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// payload renders the request body for rec.
+func (n *notifier) payload(rec auditRecord) ([]byte, error) {
+	var b bytes.Buffer
+	if err := n.tmpl.Execute(&b, rec); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	if n.cfg.Type == notifySlack {
+		return json.Marshal(map[string]string{"text": b.String()})
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, errors.New("body template produced invalid JSON")
+	}
+	return b.Bytes(), nil
+}
+
+// send posts rec, retrying network errors, 429 and 5xx responses.
+func (n *notifier) send(ctx context.Context, rec auditRecord) error {
+	body, err := n.payload(rec)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.cfg.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (n *notifier) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL is dropped from the error since it may embed a secret.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,215 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifyServer records request bodies, answering with the queued statuses
+// and 200 once they run out.
+type notifyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	statuses []int
+}
+
+func newNotifyServer(t *testing.T, statuses ...int) *notifyServer {
+	t.Helper()
+	s := &notifyServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, string(body))
+		s.headers = append(s.headers, r.Header.Clone())
+		if len(s.statuses) > 0 {
+			w.WriteHeader(s.statuses[0])
+			s.statuses = s.statuses[1:]
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *notifyServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func testNotifyRecord() auditRecord {
+	return auditRecord{
+		Time:      time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+		OSUser:    "alice",
+		Profile:   "prod",
+		Command:   "kill",
+		Target:    "db1:3306",
+		ProcessID: 42,
+		SQL:       "KILL 42",
+		Process:   &auditProcess{User: "app", Host: "10.0.0.5", Time: 310, Info: `SELECT "x" FROM t WHERE id = ?`},
+		Outcome:   auditOK,
+	}
+}
+
+func TestNotifierWebhook(t *testing.T) {
+	srv := newNotifyServer(t)
+	n, err := newNotifier(NotifyConfig{
+		Type:    notifyWebhook,
+		URL:     srv.URL,
+		Body:    `{"who": {{json .OSUser}}, "id": {{.ProcessID}}, "info": {{json .Process.Info}}}`,
+		Headers: map[string]string{"Authorization": "Bearer t0ken"},
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	if err := n.send(context.Background(), testNotifyRecord()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	reqs := srv.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests", len(reqs))
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(reqs[0]), &got); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, reqs[0])
+	}
+	if got["who"] != "alice" || got["id"] != float64(42) || got["info"] != `SELECT "x" FROM t WHERE id = ?` {
+		t.Fatalf("unexpected body: %v", got)
+	}
+	if h := srv.headers[0]; h.Get("Authorization") != "Bearer t0ken" || h.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers: %v", h)
+	}
+}
+
+func TestNotifierDefaultBodies(t *testing.T) {
+	srv := newNotifyServer(t)
+	for _, typ := range []string{notifyWebhook, notifySlack} {
+		n, err := newNotifier(NotifyConfig{Type: typ, URL: srv.URL, Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("newNotifier: %v", err)
+		}
+		if err := n.send(context.Background(), testNotifyRecord()); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	reqs := srv.requests()
+	var rec auditRecord
+	if err := json.Unmarshal([]byte(reqs[0]), &rec); err != nil || rec.ProcessID != 42 || rec.OSUser != "alice" {
+		t.Fatalf("webhook body should be the audit record: %v %s", err, reqs[0])
+	}
+
+	var slack struct{ Text string }
+	if err := json.Unmarshal([]byte(reqs[1]), &slack); err != nil {
+		t.Fatalf("slack body: %v", err)
+	}
+	want := "mysql-kill ok: alice ran \"KILL 42\" on db1:3306 [prod]\nvictim: app@10.0.0.5, 310s: SELECT \"x\" FROM t WHERE id = ?"
+	if slack.Text != want {
+		t.Fatalf("got %q want %q", slack.Text, want)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		retries  int
+		wantReqs int
+		wantErr  bool
+	}{
+		{name: "recovers", statuses: []int{503, 429}, retries: 2, wantReqs: 3},
+		{name: "gives up", statuses: []int{500, 502, 503}, retries: 1, wantReqs: 2, wantErr: true},
+		{name: "client error is final", statuses: []int{400}, retries: 2, wantReqs: 1, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newNotifyServer(t, tc.statuses...)
+			n, err := newNotifier(NotifyConfig{Type: notifyWebhook, URL: srv.URL, Timeout: time.Second, Retries: tc.retries})
+			if err != nil {
+				t.Fatalf("newNotifier: %v", err)
+			}
+			n.backoff = time.Millisecond
+			err = n.send(context.Background(), testNotifyRecord())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if got := len(srv.requests()); got != tc.wantReqs {
+				t.Fatalf("got %d requests want %d", got, tc.wantReqs)
+			}
+		})
+	}
+}
+
+func TestNotifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n, err := newNotifier(NotifyConfig{Type: notifyWebhook, URL: srv.URL, Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	err = n.send(context.Background(), testNotifyRecord())
+	if err == nil {
+		t.Fatalf("expected a timeout")
+	}
+	if strings.Contains(err.Error(), srv.URL) {
+		t.Fatalf("error leaks the URL: %v", err)
+	}
+}
+
+func TestNotifierInvalidBody(t *testing.T) {
+	n, err := newNotifier(NotifyConfig{Type: notifyWebhook, URL: "http://127.0.0.1:0", Body: `{"id": {{.SQL}}}`})
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	if _, err := n.payload(testNotifyRecord()); err == nil {
+		t.Fatalf("expected invalid JSON error")
+	}
+	if _, err := newNotifier(NotifyConfig{Type: notifySlack, Text: "{{.Nope"}); err == nil {
+		t.Fatalf("expected template parse error")
+	}
+}
+
+func TestAuditorNotify(t *testing.T) {
+	srv := newNotifyServer(t, 500)
+	cfg := AppConfig{
+		MySQL: MySQLConfig{Host: "db1", Port: 3306},
+		Notify: []NotifyConfig{
+			{Type: notifyWebhook, URL: srv.URL, On: []string{auditOK, auditError}, Timeout: time.Second, Async: true},
+		},
+	}
+	au, err := newAuditor(cfg, "kill")
+	if err != nil {
+		t.Fatalf("newAuditor: %v", err)
+	}
+	var warn bytes.Buffer
+	au.warn = &warn
+
+	au.Record(auditRecord{ProcessID: 1, Outcome: auditDryRun}, Process{})
+	au.Record(auditRecord{ProcessID: 2, Outcome: auditOK}, Process{})
+	au.Close()
+
+	reqs := srv.requests()
+	if len(reqs) != 1 || !strings.Contains(reqs[0], `"process_id":2`) {
+		t.Fatalf("unexpected requests: %v", reqs)
+	}
+	if !strings.Contains(warn.String(), "notify webhook 127.0.0.1") || !strings.Contains(warn.String(), "HTTP 500") {
+		t.Fatalf("unexpected warnings: %q", warn.String())
+	}
+}
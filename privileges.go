@@ -0,0 +1,188 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// killPrivileges describes which sessions the current user may kill.
+type killPrivileges struct {
+	// User is the user part of CURRENT_USER(); its own sessions are always killable.
+	User string
+	// Any reports whether sessions of other users may be killed.
+	Any bool
+	// Grant is the grant statement that allows it, if any.
+	Grant string
+	// Required names the privilege needed to kill other users' sessions.
+	Required string
+	// Protected lists users whose sessions cannot be killed even with Any.
+	Protected []string
+}
+
+// CanKill reports whether a session owned by user may be killed.
+func (p killPrivileges) CanKill(user string) bool {
+	if slices.Contains(p.Protected, user) {
+		return false
+	}
+	return p.Any || (p.User != "" && user == p.User)
+}
+
+// Check returns an error explaining why the session of process id owned by
+// user cannot be killed, or nil if it can.
+func (p killPrivileges) Check(id int64, user string) error {
+	if p.CanKill(user) {
+		return nil
+	}
+	if slices.Contains(p.Protected, user) {
+		return fmt.Errorf("cannot kill process %d: sessions of %q are protected by the server", id, user)
+	}
+	return fmt.Errorf("cannot kill process %d owned by %q: %q lacks %s and can kill only its own sessions", id, user, p.User, p.Required)
+}
+
+// privilegeRule describes what allows killing other users' sessions on a flavor.
+type privilegeRule struct {
+	// Privs are the privilege names that allow it (ALL PRIVILEGES always does).
+	Privs []string
+	// Objects are the grant levels the privilege counts on, e.g. "*.*".
+	Objects []string
+	// Required is the human-readable form used in errors.
+	Required string
+	// Protected lists users whose sessions cannot be killed.
+	Protected []string
+}
+
+// inspectPrivileges determines which sessions the current user may kill
+// from SHOW GRANTS, falling back to information_schema.USER_PRIVILEGES for
+// global privileges SHOW GRANTS does not spell out (e.g. via active roles).
+func inspectPrivileges(ctx context.Context, db *sql.DB, rule privilegeRule) (killPrivileges, error) {
+	var currentUser string
+	if err := db.QueryRowContext(ctx, "SELECT CURRENT_USER()").Scan(&currentUser); err != nil {
+		return killPrivileges{}, fmt.Errorf("current user: %w", err)
+	}
+
+	grants, err := showGrants(ctx, db)
+	if err != nil {
+		return killPrivileges{}, err
+	}
+
+	p := privilegesFromGrants(grants, rule.Privs, rule.Objects...)
+	if !p.Any && slices.Contains(rule.Objects, "*.*") {
+		priv, err := userPrivilegeFromSchema(ctx, db, rule.Privs)
+		if err != nil {
+			return killPrivileges{}, err
+		}
+		if priv != "" {
+			p.Any = true
+			p.Grant = priv + " (information_schema.USER_PRIVILEGES)"
+		}
+	}
+
+	p.User = userName(currentUser)
+	p.Required = rule.Required
+	p.Protected = rule.Protected
+	return p, nil
+}
+
+// userName returns the user part of a user@host account name.
+func userName(account string) string {
+	if i := strings.LastIndex(account, "@"); i >= 0 {
+		return account[:i]
+	}
+	return account
+}
+
+// showGrants returns the grant statements of the current user.
+func showGrants(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW GRANTS")
+	if err != nil {
+		return nil, fmt.Errorf("show grants: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var grants []string
+	for rows.Next() {
+		var g string
+		if err := rows.Scan(&g); err != nil {
+			return nil, fmt.Errorf("scan grants: %w", err)
+		}
+		grants = append(grants, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return grants, nil
+}
+
+// userPrivilegeFromSchema returns the first of privs the current user holds
+// globally according to information_schema.USER_PRIVILEGES, or "".
+func userPrivilegeFromSchema(ctx context.Context, db *sql.DB, privs []string) (string, error) {
+	const query = `
+SELECT PRIVILEGE_TYPE
+FROM information_schema.USER_PRIVILEGES
+WHERE GRANTEE = CONCAT('''', SUBSTRING_INDEX(CURRENT_USER(), '@', 1), '''@''', SUBSTRING_INDEX(CURRENT_USER(), '@', -1), '''')`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		if isMissingObjectError(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("query user privileges: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var priv string
+		if err := rows.Scan(&priv); err != nil {
+			return "", fmt.Errorf("scan user privileges: %w", err)
+		}
+		for _, want := range privs {
+			if strings.EqualFold(priv, want) {
+				return priv, nil
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("rows: %w", err)
+	}
+	return "", nil
+}
+
+var grantPattern = regexp.MustCompile(`(?i)^GRANT\s+(.+?)\s+ON\s+(.+?)\s+TO\s`)
+
+// privilegesFromGrants reports whether any grant gives one of privs (or ALL
+// PRIVILEGES) on one of objects. Objects are compared without quoting, e.g.
+// "*.*", "mysql.*" or "PROCEDURE mysql.rds_kill".
+func privilegesFromGrants(grants []string, privs []string, objects ...string) killPrivileges {
+	for _, g := range grants {
+		m := grantPattern.FindStringSubmatch(g)
+		if m == nil {
+			continue
+		}
+		on := strings.ToLower(strings.NewReplacer("`", "", "'", "", `"`, "").Replace(m[2]))
+		matched := false
+		for _, o := range objects {
+			if on == strings.ToLower(o) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, p := range strings.Split(m[1], ",") {
+			p = strings.ToUpper(strings.TrimSpace(p))
+			if p == "ALL" || p == "ALL PRIVILEGES" {
+				return killPrivileges{Any: true, Grant: g}
+			}
+			for _, want := range privs {
+				if p == want {
+					return killPrivileges{Any: true, Grant: g}
+				}
+			}
+		}
+	}
+	return killPrivileges{}
+}
@@ -0,0 +1,121 @@
+package mysqlkill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrivilegesFromGrants(t *testing.T) {
+	cases := []struct {
+		name    string
+		grants  []string
+		privs   []string
+		objects []string
+		want    bool
+	}{
+		{
+			name:    "connection_admin",
+			grants:  []string{"GRANT USAGE ON *.* TO `ops`@`%`", "GRANT CONNECTION_ADMIN ON *.* TO `ops`@`%`"},
+			privs:   []string{"SUPER", "CONNECTION_ADMIN"},
+			objects: []string{"*.*"},
+			want:    true,
+		},
+		{
+			name:    "super in list",
+			grants:  []string{"GRANT SELECT, PROCESS, SUPER ON *.* TO 'ops'@'%'"},
+			privs:   []string{"SUPER", "CONNECTION_ADMIN"},
+			objects: []string{"*.*"},
+			want:    true,
+		},
+		{
+			name:    "all privileges",
+			grants:  []string{"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION"},
+			privs:   []string{"SUPER"},
+			objects: []string{"*.*"},
+			want:    true,
+		},
+		{
+			name:    "schema level does not count",
+			grants:  []string{"GRANT ALL PRIVILEGES ON `app`.* TO `app`@`%`"},
+			privs:   []string{"SUPER"},
+			objects: []string{"*.*"},
+			want:    false,
+		},
+		{
+			name:    "rds execute on procedure",
+			grants:  []string{"GRANT EXECUTE ON PROCEDURE `mysql`.`rds_kill` TO `ops`@`%`"},
+			privs:   []string{"EXECUTE"},
+			objects: []string{"*.*", "mysql.*", "PROCEDURE mysql.rds_kill"},
+			want:    true,
+		},
+		{
+			name:    "process only",
+			grants:  []string{"GRANT PROCESS ON *.* TO `ops`@`%`"},
+			privs:   []string{"SUPER", "CONNECTION_ADMIN"},
+			objects: []string{"*.*"},
+			want:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := privilegesFromGrants(tc.grants, tc.privs, tc.objects...)
+			if got.Any != tc.want {
+				t.Fatalf("got %v want %v", got.Any, tc.want)
+			}
+			if got.Any && got.Grant == "" {
+				t.Fatalf("expected matching grant to be reported")
+			}
+		})
+	}
+}
+
+func TestKillPrivilegesCanKill(t *testing.T) {
+	own := killPrivileges{User: "ops", Required: "CONNECTION_ADMIN or SUPER"}
+	if !own.CanKill("ops") {
+		t.Fatalf("own session should be killable")
+	}
+	if own.CanKill("app") {
+		t.Fatalf("other user's session should not be killable")
+	}
+
+	admin := killPrivileges{User: "ops", Any: true, Protected: []string{"rdsadmin"}}
+	if !admin.CanKill("app") {
+		t.Fatalf("expected any session to be killable")
+	}
+	if admin.CanKill("rdsadmin") {
+		t.Fatalf("protected user should not be killable")
+	}
+}
+
+func TestKillPrivilegesCheck(t *testing.T) {
+	p := killPrivileges{User: "ops", Required: "EXECUTE on mysql.rds_kill", Protected: []string{"rdsadmin"}}
+
+	if err := p.Check(1, "ops"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := p.Check(2, "app")
+	if err == nil || !strings.Contains(err.Error(), "lacks EXECUTE on mysql.rds_kill") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = p.Check(3, "rdsadmin")
+	if err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUserName(t *testing.T) {
+	cases := map[string]string{
+		"ops@%":          "ops",
+		"ops@10.0.0.%":   "ops",
+		"user@corp@host": "user@corp",
+		"root":           "root",
+	}
+	for in, want := range cases {
+		if got := userName(in); got != want {
+			t.Fatalf("userName(%q): got %q want %q", in, got, want)
+		}
+	}
+}
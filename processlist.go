@@ -0,0 +1,212 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// sourceAuto prefers performance_schema and falls back to information_schema.
+	sourceAuto = "auto"
+	// sourcePerformanceSchema reads performance_schema.threads.
+	sourcePerformanceSchema = "performance_schema"
+	// sourceInformationSchema reads information_schema.processlist.
+	sourceInformationSchema = "information_schema"
+)
+
+// processListSource describes where processlist rows are read from.
+// Every source exposes the same columns: ID, USER, HOST, DB, COMMAND, TIME,
+// STATE, INFO, THREAD_ID and RESOURCE_GROUP.
+type processListSource struct {
+	// PerformanceSchema reads performance_schema.threads, which does not take
+	// the global mutex information_schema.processlist does.
+	PerformanceSchema bool
+	// ResourceGroup reports whether threads has RESOURCE_GROUP (MySQL 8.0+).
+	ResourceGroup bool
+}
+
+// String returns the table rows are read from.
+func (s processListSource) String() string {
+	if s.PerformanceSchema {
+		return "performance_schema.threads"
+	}
+	return "information_schema.processlist"
+}
+
+// table returns a FROM clause item exposing the processlist columns.
+func (s processListSource) table() string {
+	if !s.PerformanceSchema {
+		return "information_schema.processlist"
+	}
+	resourceGroup := "NULL AS RESOURCE_GROUP"
+	if s.ResourceGroup {
+		resourceGroup = "RESOURCE_GROUP"
+	}
+	return "(SELECT PROCESSLIST_ID AS ID, PROCESSLIST_USER AS USER, PROCESSLIST_HOST AS HOST, PROCESSLIST_DB AS DB, " +
+		"PROCESSLIST_COMMAND AS COMMAND, PROCESSLIST_TIME AS TIME, PROCESSLIST_STATE AS STATE, PROCESSLIST_INFO AS INFO, " +
+		"THREAD_ID, " + resourceGroup + " FROM performance_schema.threads WHERE PROCESSLIST_ID IS NOT NULL) AS p"
+}
+
+// hostColumn returns the client host without its port. performance_schema
+// already reports it without one.
+func (s processListSource) hostColumn() string {
+	if s.PerformanceSchema {
+		return "HOST"
+	}
+	return hostColumn
+}
+
+// columns returns the select list for the processlist columns.
+func (s processListSource) columns() string {
+	if !s.PerformanceSchema {
+		return "ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, NULL AS THREAD_ID, NULL AS RESOURCE_GROUP"
+	}
+	return "ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, THREAD_ID, RESOURCE_GROUP"
+}
+
+// validateProcessListSource checks a processlist_source config value.
+func validateProcessListSource(name string) error {
+	switch name {
+	case "", sourceAuto, sourcePerformanceSchema, sourceInformationSchema:
+		return nil
+	}
+	return fmt.Errorf("unknown processlist_source %q: use %q, %q or %q", name, sourceAuto, sourcePerformanceSchema, sourceInformationSchema)
+}
+
+// detectProcessListSource resolves the configured source. In auto mode
+// performance_schema is used when it is enabled and readable; otherwise the
+// source falls back to information_schema.
+func detectProcessListSource(ctx context.Context, db *sql.DB, configured string) (processListSource, error) {
+	if configured == sourceInformationSchema {
+		return processListSource{}, nil
+	}
+
+	src, err := probePerformanceSchema(ctx, db)
+	if err == nil {
+		return src, nil
+	}
+	var myErr *mysql.MySQLError
+	if configured != sourcePerformanceSchema && (errors.Is(err, errPerformanceSchemaOff) || errors.As(err, &myErr)) {
+		return processListSource{}, nil
+	}
+	return processListSource{}, fmt.Errorf("processlist source: %w", err)
+}
+
+var errPerformanceSchemaOff = errors.New("performance_schema is disabled")
+
+// probePerformanceSchema checks that performance_schema.threads is usable.
+func probePerformanceSchema(ctx context.Context, db *sql.DB) (processListSource, error) {
+	var enabled sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT @@performance_schema").Scan(&enabled); err != nil {
+		if isMissingObjectError(err) {
+			return processListSource{}, errPerformanceSchemaOff
+		}
+		return processListSource{}, err
+	}
+	if !enabled.Valid || enabled.Int64 != 1 {
+		return processListSource{}, errPerformanceSchemaOff
+	}
+
+	src := processListSource{PerformanceSchema: true, ResourceGroup: true}
+	if err := probeQuery(ctx, db, "SELECT THREAD_ID, RESOURCE_GROUP FROM performance_schema.threads LIMIT 0"); err != nil {
+		if !isMissingObjectError(err) {
+			return processListSource{}, err
+		}
+		src.ResourceGroup = false
+		if err := probeQuery(ctx, db, "SELECT THREAD_ID FROM performance_schema.threads LIMIT 0"); err != nil {
+			return processListSource{}, err
+		}
+	}
+	return src, nil
+}
+
+// probeQuery runs query and discards its rows.
+func probeQuery(ctx context.Context, db *sql.DB, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// trxColumns are the information_schema.innodb_trx columns joined by --trx.
+const trxColumns = "trx_id, trx_state, CAST(trx_started AS CHAR) AS trx_started, " +
+	"TIMESTAMPDIFF(SECOND, trx_started, NOW()) AS trx_age, trx_rows_locked, trx_rows_modified, trx_isolation_level"
+
+// buildProcessListQuery builds the processlist query and args.
+func buildProcessListQuery(cmd *ListCmd, src processListSource) (string, []any, error) {
+	base := "SELECT " + src.columns() + " FROM " + src.table()
+	var where []string
+	var args []any
+
+	if cmd.showTrx() {
+		// innodb_trx columns are all trx_-prefixed, so the processlist
+		// columns stay unambiguous without qualifying them.
+		base = "SELECT " + src.columns() + ", " + trxColumns + " FROM " + src.table() +
+			" LEFT JOIN information_schema.innodb_trx ON trx_mysql_thread_id = ID"
+	}
+	if cmd.InTrx || cmd.TrxAge > 0 {
+		where = append(where, "trx_id IS NOT NULL")
+	}
+	if cmd.TrxAge > 0 {
+		where = append(where, "trx_started <= NOW() - INTERVAL ? SECOND")
+		args = append(args, int64(cmd.TrxAge/time.Second))
+	}
+	if cmd.Match != "" {
+		where = append(where, "INFO REGEXP ?")
+		args = append(args, cmd.Match)
+	}
+
+	conds, condArgs, err := cmd.filterConditions(src)
+	if err != nil {
+		return "", nil, err
+	}
+	where = append(where, conds...)
+	args = append(args, condArgs...)
+
+	query := base
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	order := "TIME DESC"
+	col, desc, sorted := cmd.sortColumn()
+	if sorted && col.Order != "" {
+		order = col.Order + " ASC"
+		if desc {
+			order = col.Order + " DESC"
+		}
+	}
+	query += " ORDER BY " + order
+
+	// With a computed sort column or --group-by, the limit applies after
+	// sorting or grouping on the client.
+	if cmd.Limit > 0 && cmd.GroupBy == "" && (!sorted || col.Order != "") {
+		query += " LIMIT ?"
+		args = append(args, cmd.Limit)
+	}
+
+	return query, args, nil
+}
+
+// errProcessNotFound reports a process that is not in the processlist.
+var errProcessNotFound = errors.New("not found")
+
+// lookupProcess returns the processlist row of process id.
+func lookupProcess(ctx context.Context, db *sql.DB, src processListSource, id int64) (Process, error) {
+	var r Process
+	err := db.QueryRowContext(ctx, "SELECT "+src.columns()+" FROM "+src.table()+" WHERE ID = ?", id).
+		Scan(processRowDest(&r, false)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("process %d %w", id, errProcessNotFound)
+	}
+	if err != nil {
+		return r, fmt.Errorf("lookup process %d: %w", id, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,55 @@
+package mysqlkill
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildProcessListQueryPerformanceSchema(t *testing.T) {
+	cmd := &ListCmd{Match: "SELECT", Host: []string{"::1"}}
+
+	gotQuery, gotArgs, err := buildProcessListQuery(cmd, processListSource{PerformanceSchema: true, ResourceGroup: true})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	wantQuery := "SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO, THREAD_ID, RESOURCE_GROUP FROM " +
+		"(SELECT PROCESSLIST_ID AS ID, PROCESSLIST_USER AS USER, PROCESSLIST_HOST AS HOST, PROCESSLIST_DB AS DB, " +
+		"PROCESSLIST_COMMAND AS COMMAND, PROCESSLIST_TIME AS TIME, PROCESSLIST_STATE AS STATE, PROCESSLIST_INFO AS INFO, " +
+		"THREAD_ID, RESOURCE_GROUP FROM performance_schema.threads WHERE PROCESSLIST_ID IS NOT NULL) AS p " +
+		"WHERE INFO REGEXP ? AND HOST = ? ORDER BY TIME DESC"
+	wantArgs := []any{"SELECT", "::1"}
+
+	if gotQuery != wantQuery {
+		t.Fatalf("query mismatch:\n%s\n!=\n%s", gotQuery, wantQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Fatalf("args mismatch: %#v != %#v", gotArgs, wantArgs)
+	}
+}
+
+func TestProcessListSourceWithoutResourceGroup(t *testing.T) {
+	src := processListSource{PerformanceSchema: true}
+	want := "(SELECT PROCESSLIST_ID AS ID, PROCESSLIST_USER AS USER, PROCESSLIST_HOST AS HOST, PROCESSLIST_DB AS DB, " +
+		"PROCESSLIST_COMMAND AS COMMAND, PROCESSLIST_TIME AS TIME, PROCESSLIST_STATE AS STATE, PROCESSLIST_INFO AS INFO, " +
+		"THREAD_ID, NULL AS RESOURCE_GROUP FROM performance_schema.threads WHERE PROCESSLIST_ID IS NOT NULL) AS p"
+	if got := src.table(); got != want {
+		t.Fatalf("table mismatch:\n%s\n!=\n%s", got, want)
+	}
+	if got := src.String(); got != "performance_schema.threads" {
+		t.Fatalf("got %q", got)
+	}
+	if got := (processListSource{}).String(); got != "information_schema.processlist" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestValidateProcessListSource(t *testing.T) {
+	for _, name := range []string{"", "auto", "performance_schema", "information_schema"} {
+		if err := validateProcessListSource(name); err != nil {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+	}
+	if err := validateProcessListSource("sys"); err == nil {
+		t.Fatalf("expected error for unknown source")
+	}
+}
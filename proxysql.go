@@ -0,0 +1,284 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+)
+
+// proxySQLSession is a row of ProxySQL's stats_mysql_processlist.
+type proxySQLSession struct {
+	SessionID  int64
+	User       sql.NullString
+	DB         sql.NullString
+	ClientHost sql.NullString
+	ClientPort sql.NullInt64
+	Hostgroup  sql.NullInt64
+	ServerHost sql.NullString
+	ServerPort sql.NullInt64
+	ThreadID   sql.NullInt64
+	Command    sql.NullString
+	TimeMS     sql.NullInt64
+	Info       sql.NullString
+}
+
+// hasBackend reports whether the session currently holds a backend connection.
+func (s proxySQLSession) hasBackend() bool {
+	return nullString(s.ServerHost) != "" && s.ServerPort.Valid && s.ThreadID.Valid && s.ThreadID.Int64 > 0
+}
+
+// process returns the session as a processlist row, for the audit log.
+func (s proxySQLSession) process() Process {
+	r := Process{
+		ID:      s.SessionID,
+		User:    s.User,
+		Host:    s.ClientHost,
+		DB:      s.DB,
+		Command: s.Command,
+		Info:    s.Info,
+	}
+	if s.TimeMS.Valid {
+		r.Time = sql.NullInt64{Int64: s.TimeMS.Int64 / 1000, Valid: true}
+	}
+	return r
+}
+
+// buildProxySQLProcessListQuery builds the stats_mysql_processlist query.
+// ProxySQL's admin interface does not support prepared statements, so the
+// session ID is formatted into the query instead of being bound. A zero
+// sessionID selects all sessions.
+func buildProxySQLProcessListQuery(sessionID int64) string {
+	query := `SELECT SessionID, user, db, cli_host, cli_port, hostgroup, srv_host, srv_port, ThreadID, command, time_ms, info FROM stats_mysql_processlist`
+	if sessionID != 0 {
+		query += fmt.Sprintf(" WHERE SessionID = %d", sessionID)
+	}
+	query += " ORDER BY time_ms DESC"
+	return query
+}
+
+// buildProxySQLKillSQL builds the admin statement that kills a client session.
+func buildProxySQLKillSQL(sessionID int64) string {
+	return fmt.Sprintf("KILL CONNECTION %d", sessionID)
+}
+
+// queryProxySQLSessions runs a stats_mysql_processlist query and scans the rows.
+func queryProxySQLSessions(ctx context.Context, db *sql.DB, query string) ([]proxySQLSession, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query proxysql processlist: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sessions []proxySQLSession
+	for rows.Next() {
+		var s proxySQLSession
+		if err := rows.Scan(&s.SessionID, &s.User, &s.DB, &s.ClientHost, &s.ClientPort, &s.Hostgroup,
+			&s.ServerHost, &s.ServerPort, &s.ThreadID, &s.Command, &s.TimeMS, &s.Info); err != nil {
+			return nil, fmt.Errorf("scan proxysql processlist: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return sessions, nil
+}
+
+// listProxySQLProcess queries and prints the ProxySQL processlist to w.
+func listProxySQLProcess(ctx context.Context, w io.Writer, db *sql.DB, cmd *ListCmd, red redactor) error {
+	// The admin interface is SQLite-backed and has no REGEXP, so --match is
+	// applied client-side. (?i) mirrors MySQL's case-insensitive REGEXP.
+	var match *regexp.Regexp
+	if cmd.Match != "" {
+		re, err := regexp.Compile("(?i)" + cmd.Match)
+		if err != nil {
+			return fmt.Errorf("compile --match: %w", err)
+		}
+		match = re
+	}
+
+	sessions, err := queryProxySQLSessions(ctx, db, buildProxySQLProcessListQuery(0))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "SESSION\tUSER\tCLIENT\tHOSTGROUP\tSRV_HOST\tTHREAD\tDB\tCOMMAND\tTIME\tINFO"); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for _, s := range sessions {
+		if match != nil && !match.MatchString(nullString(s.Info)) {
+			continue
+		}
+		if _, err := fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.SessionID,
+			nullString(s.User),
+			joinHostPort(s.ClientHost, s.ClientPort),
+			nullInt(s.Hostgroup),
+			joinHostPort(s.ServerHost, s.ServerPort),
+			nullInt(s.ThreadID),
+			nullString(s.DB),
+			nullString(s.Command),
+			millisToSeconds(s.TimeMS),
+			red.SQL(nullString(s.Info)),
+		); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// runProxySQLKill kills a ProxySQL client session, or with --backend the
+// backend thread serving it on the MySQL server.
+func runProxySQLKill(ctx context.Context, db *sql.DB, cfg AppConfig, cmd *KillCmd, au *auditor, allow func(Process) error) error {
+	sessions, err := queryProxySQLSessions(ctx, db, buildProxySQLProcessListQuery(cmd.QueryID))
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("proxysql session %d not found", cmd.QueryID)
+	}
+	sess := sessions[0]
+
+	if allow != nil {
+		if err := allow(sess.process()); err != nil {
+			au.setServer(targetProxySQL, roleVerdict{})
+			au.Record(auditRecord{ProcessID: sess.SessionID, DryRun: cmd.DryRun, Outcome: auditRefused, Error: err.Error()}, sess.process())
+			return err
+		}
+	}
+
+	if cmd.Backend {
+		return killProxySQLBackend(ctx, cfg, cmd, sess, au)
+	}
+
+	if cmd.KillQuery {
+		return errors.New("--kill-query is not supported on a ProxySQL session: use --backend to kill the query on the MySQL server")
+	}
+
+	au.setServer(targetProxySQL, roleVerdict{})
+	sqlText := buildProxySQLKillSQL(sess.SessionID)
+	rec := auditRecord{ProcessID: sess.SessionID, SQL: sqlText, DryRun: cmd.DryRun}
+	if err := enforceProxySQLReader(ctx, db, sess, cfg.AllowWriter); err != nil {
+		rec.Outcome, rec.Error = auditRefused, err.Error()
+		au.Record(rec, sess.process())
+		return err
+	}
+
+	if cmd.DryRun {
+		rec.Outcome = auditDryRun
+		au.Record(rec, sess.process())
+		fmt.Printf("DRY RUN: %s\n", sqlText)
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, sqlText); err != nil {
+		rec.Outcome, rec.Error = auditError, err.Error()
+		au.Record(rec, sess.process())
+		return fmt.Errorf("execute: %w", err)
+	}
+	rec.Outcome = auditOK
+	au.Record(rec, sess.process())
+	fmt.Printf("OK: %s\n", sqlText)
+	return nil
+}
+
+// killProxySQLBackend connects to the backend server of a session and kills
+// its thread through the regular kill path.
+func killProxySQLBackend(ctx context.Context, cfg AppConfig, cmd *KillCmd, sess proxySQLSession, au *auditor) error {
+	if !sess.hasBackend() {
+		return fmt.Errorf("proxysql session %d has no backend connection", sess.SessionID)
+	}
+
+	backendCfg, err := proxySQLBackendConfig(cfg.ProxySQL, sess)
+	if err != nil {
+		return err
+	}
+
+	backendDB, tunnel, err := openDBWithTunnel(ctx, backendCfg, cfg.SSH)
+	if err != nil {
+		return fmt.Errorf("connect backend %s: %w", joinHostPort(sess.ServerHost, sess.ServerPort), err)
+	}
+	bcfg := cfg
+	bcfg.Target, bcfg.MySQL = targetMySQL, backendCfg
+	backend, err := openClient(ctx, bcfg, backendDB, tunnel, "kill")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = backend.Close() }()
+	// The session was vetted by the self-service policy, whose user the
+	// backend thread may not share.
+	backend.allow = nil
+
+	au.setTarget(targetAddr(backendCfg))
+	results, err := backend.kill(ctx, os.Stdout, cmd, sess.ThreadID.Int64, au)
+	if err != nil {
+		return err
+	}
+	return backend.waitResults(ctx, os.Stdout, cmd, results, au)
+}
+
+// proxySQLBackendConfig builds the connection settings for the backend
+// server of a session from the [proxysql] backend credentials.
+func proxySQLBackendConfig(cfg ProxySQLConfig, sess proxySQLSession) (MySQLConfig, error) {
+	if cfg.BackendUser == "" {
+		return MySQLConfig{}, errors.New("proxysql backend credentials missing: set backend_user in [proxysql]")
+	}
+	backend := MySQLConfig{
+		Host:     nullString(sess.ServerHost),
+		Port:     int(sess.ServerPort.Int64),
+		User:     cfg.BackendUser,
+		Password: cfg.BackendPassword,
+		TLS:      cfg.BackendTLS,
+	}
+	backend.DSN = buildDSN(backend)
+	return backend, nil
+}
+
+// enforceProxySQLReader rejects sessions routed to a hostgroup that is not a
+// configured reader hostgroup unless allowWriter is true.
+func enforceProxySQLReader(ctx context.Context, db *sql.DB, sess proxySQLSession, allowWriter bool) error {
+	if allowWriter {
+		return nil
+	}
+	if !sess.Hostgroup.Valid {
+		return errors.New("writer detected (hostgroup unknown): use --allow-writer to proceed")
+	}
+
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM runtime_mysql_replication_hostgroups WHERE reader_hostgroup = %d", sess.Hostgroup.Int64)
+	if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return fmt.Errorf("detect reader hostgroup: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("writer detected (hostgroup %d is not a reader hostgroup): use --allow-writer to proceed", sess.Hostgroup.Int64)
+	}
+	return nil
+}
+
+// joinHostPort formats a nullable host and port pair.
+func joinHostPort(host sql.NullString, port sql.NullInt64) string {
+	h := nullString(host)
+	if h == "" {
+		return ""
+	}
+	if !port.Valid {
+		return h
+	}
+	return net.JoinHostPort(h, strconv.FormatInt(port.Int64, 10))
+}
+
+// millisToSeconds converts a nullable millisecond duration to whole seconds.
+func millisToSeconds(v sql.NullInt64) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.FormatInt(v.Int64/1000, 10)
+}
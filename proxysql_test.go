@@ -0,0 +1,98 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestBuildProxySQLProcessListQuery(t *testing.T) {
+	got := buildProxySQLProcessListQuery(0)
+	want := "SELECT SessionID, user, db, cli_host, cli_port, hostgroup, srv_host, srv_port, ThreadID, command, time_ms, info FROM stats_mysql_processlist ORDER BY time_ms DESC"
+	if got != want {
+		t.Fatalf("query mismatch:\n%s\n!=\n%s", got, want)
+	}
+
+	got = buildProxySQLProcessListQuery(42)
+	want = "SELECT SessionID, user, db, cli_host, cli_port, hostgroup, srv_host, srv_port, ThreadID, command, time_ms, info FROM stats_mysql_processlist WHERE SessionID = 42 ORDER BY time_ms DESC"
+	if got != want {
+		t.Fatalf("query mismatch:\n%s\n!=\n%s", got, want)
+	}
+}
+
+func TestBuildProxySQLKillSQL(t *testing.T) {
+	if got := buildProxySQLKillSQL(7); got != "KILL CONNECTION 7" {
+		t.Fatalf("got %q want %q", got, "KILL CONNECTION 7")
+	}
+}
+
+func TestProxySQLBackendConfig(t *testing.T) {
+	sess := proxySQLSession{
+		SessionID:  1,
+		ServerHost: sql.NullString{String: "10.0.0.5", Valid: true},
+		ServerPort: sql.NullInt64{Int64: 3306, Valid: true},
+		ThreadID:   sql.NullInt64{Int64: 99, Valid: true},
+	}
+
+	if _, err := proxySQLBackendConfig(ProxySQLConfig{}, sess); err == nil {
+		t.Fatalf("expected error without backend_user")
+	}
+
+	got, err := proxySQLBackendConfig(ProxySQLConfig{BackendUser: "app", BackendPassword: "pass"}, sess)
+	if err != nil {
+		t.Fatalf("proxySQLBackendConfig: %v", err)
+	}
+	want := "app:pass@tcp(10.0.0.5:3306)/?parseTime=true"
+	if got.DSN != want {
+		t.Fatalf("dsn: got %q want %q", got.DSN, want)
+	}
+}
+
+func TestProxySQLSessionHasBackend(t *testing.T) {
+	cases := []struct {
+		name string
+		sess proxySQLSession
+		want bool
+	}{
+		{
+			name: "backend",
+			sess: proxySQLSession{
+				ServerHost: sql.NullString{String: "db1", Valid: true},
+				ServerPort: sql.NullInt64{Int64: 3306, Valid: true},
+				ThreadID:   sql.NullInt64{Int64: 10, Valid: true},
+			},
+			want: true,
+		},
+		{
+			name: "no thread",
+			sess: proxySQLSession{
+				ServerHost: sql.NullString{String: "db1", Valid: true},
+				ServerPort: sql.NullInt64{Int64: 3306, Valid: true},
+				ThreadID:   sql.NullInt64{Int64: -1, Valid: true},
+			},
+			want: false,
+		},
+		{
+			name: "no server",
+			sess: proxySQLSession{},
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sess.hasBackend(); got != tc.want {
+				t.Fatalf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJoinHostPort(t *testing.T) {
+	got := joinHostPort(sql.NullString{String: "10.0.0.1", Valid: true}, sql.NullInt64{Int64: 51234, Valid: true})
+	if got != "10.0.0.1:51234" {
+		t.Fatalf("got %q", got)
+	}
+	if got := joinHostPort(sql.NullString{}, sql.NullInt64{Int64: 1, Valid: true}); got != "" {
+		t.Fatalf("expected empty, got %q", got)
+	}
+}
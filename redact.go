@@ -0,0 +1,112 @@
+package mysqlkill
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redactRule is a custom redaction: matches of Pattern are replaced with
+// Replacement, which may reference groups as in regexp.ReplaceAllString.
+type redactRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// redactor masks sensitive data in SQL text before it is displayed or
+// recorded. The zero value leaves text unchanged.
+type redactor struct {
+	Enabled bool
+	Rules   []redactRule
+}
+
+// newRedactRule compiles a custom rule. The replacement defaults to "?".
+func newRedactRule(pattern, replacement string) (redactRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return redactRule{}, fmt.Errorf("invalid redact rule %q: %w", pattern, err)
+	}
+	if replacement == "" {
+		replacement = "?"
+	}
+	return redactRule{Pattern: re, Replacement: replacement}, nil
+}
+
+// SQL replaces the literals of a statement with ? and applies the rules.
+// Comments are kept, so the rules can mask data in them.
+func (r redactor) SQL(s string) string {
+	if !r.Enabled || s == "" {
+		return s
+	}
+	return r.applyRules(replaceLiterals(s, false))
+}
+
+// Plan masks the quoted string literals of an EXPLAIN plan (tree or JSON)
+// and applies the rules. Numbers are kept since most are costs and row
+// estimates.
+func (r redactor) Plan(s string) string {
+	if !r.Enabled || s == "" {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '\'' {
+			i = skipQuoted(s, i)
+			b.WriteString("'?'")
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return r.applyRules(b.String())
+}
+
+// Explain returns res with its plan and fallback reason redacted.
+func (r redactor) Explain(res explainResult) explainResult {
+	res.Raw = r.Plan(res.Raw)
+	res.FallbackReason = r.Plan(res.FallbackReason)
+	return res
+}
+
+// Row returns r with its SQL text redacted, keeping its fingerprint ID.
+func (r redactor) Row(row Process) Process {
+	if r.Enabled && row.Info.Valid {
+		row.fingerprintID = row.FingerprintID()
+		row.Info.String = r.SQL(row.Info.String)
+	}
+	return row
+}
+
+// Rows returns copies of rows with their SQL text redacted.
+func (r redactor) Rows(rows []Process) []Process {
+	if !r.Enabled {
+		return rows
+	}
+	out := make([]Process, len(rows))
+	for i, row := range rows {
+		out[i] = r.Row(row)
+	}
+	return out
+}
+
+// Groups returns copies of groups with the fingerprint text of a
+// fingerprint grouping redacted. The fingerprint IDs are kept: they identify
+// the unredacted statements, as kill --fingerprint matches them.
+func (r redactor) Groups(by string, groups []processGroup) []processGroup {
+	if !r.Enabled || by != "fingerprint" {
+		return groups
+	}
+	out := make([]processGroup, len(groups))
+	for i, g := range groups {
+		g.Key = r.SQL(g.Key)
+		out[i] = g
+	}
+	return out
+}
+
+func (r redactor) applyRules(s string) string {
+	for _, rule := range r.Rules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestRedactorSQL(t *testing.T) {
+	email, err := newRedactRule(`[\w.+-]+@[\w-]+\.[\w.]+`, "<email>")
+	if err != nil {
+		t.Fatalf("rule: %v", err)
+	}
+	r := redactor{Enabled: true, Rules: []redactRule{email}}
+
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "SELECT * FROM users WHERE email = 'alice@example.com' AND id = 42",
+			want: "SELECT * FROM users WHERE email = ? AND id = ?",
+		},
+		{
+			in:   "/* user: bob@example.com */ UPDATE t SET hash = 0xDEADBEEF,\n  token = \"abc\" WHERE col2 IN (1, 2)",
+			want: "/* user: <email> */ UPDATE t SET hash = ?,\n  token = ? WHERE col2 IN (?, ?)",
+		},
+		{in: "", want: ""},
+	}
+	for _, tc := range cases {
+		if got := r.SQL(tc.in); got != tc.want {
+			t.Fatalf("got %q want %q", got, tc.want)
+		}
+	}
+
+	if got := (redactor{}).SQL(cases[0].in); got != cases[0].in {
+		t.Fatalf("disabled redactor changed text: %q", got)
+	}
+}
+
+func TestRedactorPlan(t *testing.T) {
+	r := redactor{Enabled: true}
+	plan := `-> Filter: (o.email = 'alice@example.com')  (cost=9921 rows=98213)`
+	want := `-> Filter: (o.email = '?')  (cost=9921 rows=98213)`
+	if got := r.Plan(plan); got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+
+	json := `{"attached_condition": "(` + "`o`.`email`" + ` = 'it''s')", "rows": 5}`
+	wantJSON := `{"attached_condition": "(` + "`o`.`email`" + ` = '?')", "rows": 5}`
+	if got := r.Plan(json); got != wantJSON {
+		t.Fatalf("got %q want %q", got, wantJSON)
+	}
+}
+
+func TestRedactorRows(t *testing.T) {
+	rows := []Process{
+		{ID: 1, Info: sql.NullString{String: "SELECT 'secret'", Valid: true}},
+		{ID: 2},
+	}
+	got := redactor{Enabled: true}.Rows(rows)
+	if got[0].Info.String != "SELECT ?" || got[1].Info.Valid {
+		t.Fatalf("unexpected rows: %+v", got)
+	}
+	if rows[0].Info.String != "SELECT 'secret'" {
+		t.Fatalf("input rows must not be modified")
+	}
+}
+
+func TestRedactorGroups(t *testing.T) {
+	table, err := newRedactRule(`customers`, "<table>")
+	if err != nil {
+		t.Fatalf("rule: %v", err)
+	}
+	r := redactor{Enabled: true, Rules: []redactRule{table}}
+	info := "SELECT * FROM customers WHERE id = 1"
+	rows := []Process{
+		{ID: 1, Info: sql.NullString{String: info, Valid: true}},
+		{ID: 2, Info: sql.NullString{String: "SELECT * FROM customers WHERE id = 2", Valid: true}},
+	}
+
+	groups := r.Groups("fingerprint", groupProcessRows(rows, "fingerprint"))
+	if len(groups) != 1 || strings.Contains(groups[0].Key, "customers") {
+		t.Fatalf("fingerprint text not redacted: %+v", groups)
+	}
+	// The ID shown by list must be the one kill --fingerprint matches.
+	if groups[0].FingerprintID != fingerprintID(info) || len(matchFingerprint(rows, groups[0].FingerprintID)) != 2 {
+		t.Fatalf("fingerprint ID %s does not match the sessions", groups[0].FingerprintID)
+	}
+
+	// So must the FINGERPRINT_ID column of a redacted row.
+	if got := r.Row(rows[0]).FingerprintID(); got != fingerprintID(info) {
+		t.Fatalf("redacted row fingerprint ID %s, want %s", got, fingerprintID(info))
+	}
+
+	users := []processGroup{{Key: "customers"}}
+	if got := r.Groups("user", users); got[0].Key != "customers" {
+		t.Fatalf("user group redacted: %+v", got)
+	}
+}
@@ -0,0 +1,143 @@
+package mysqlkill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// renderer writes list output in one --format.
+type renderer interface {
+	// rawSQL reports whether the format carries SQL text as is, instead of
+	// flattened and truncated to fit a line.
+	rawSQL() bool
+	// rows writes sessions with the given columns.
+	rows(w io.Writer, cols []listColumn, rows []Process) error
+	// groups writes sessions aggregated by the --group-by key by.
+	groups(w io.Writer, by string, groups []processGroup) error
+}
+
+// renderers are the renderers by --format.
+var renderers = map[string]renderer{
+	"table": tableRenderer{},
+	"json":  jsonRenderer{},
+}
+
+// lookupRenderer returns the renderer of format, the table when empty.
+func lookupRenderer(format string) (renderer, error) {
+	if format == "" {
+		format = "table"
+	}
+	r, ok := renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return r, nil
+}
+
+// tableRenderer writes aligned columns.
+type tableRenderer struct{}
+
+func (tableRenderer) rawSQL() bool { return false }
+
+// rows prints rows as a table with the given columns.
+func (tableRenderer) rows(w io.Writer, cols []listColumn, rows []Process) error {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+
+	fields := make([]string, len(cols))
+	for i, c := range cols {
+		fields[i] = c.Name
+	}
+	if _, err := fmt.Fprintln(tw, strings.Join(fields, "\t")); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for _, r := range rows {
+		for i, c := range cols {
+			fields[i] = c.Value(r)
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(fields, "\t")); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// groups prints grouped sessions as a table.
+func (tableRenderer) groups(w io.Writer, by string, groups []processGroup) error {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+
+	header := []string{strings.ToUpper(by), "COUNT", "MAX_TIME", "AVG_TIME", "SAMPLE_ID"}
+	if by == "fingerprint" {
+		header = []string{"FINGERPRINT_ID", "COUNT", "MAX_TIME", "AVG_TIME", "SAMPLE_ID", "FINGERPRINT"}
+	}
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for _, g := range groups {
+		fields := []string{
+			g.Key,
+			strconv.Itoa(g.Count),
+			strconv.FormatInt(g.MaxTime, 10),
+			strconv.FormatFloat(g.AvgTime(), 'f', 1, 64),
+			strconv.FormatInt(g.SampleID, 10),
+		}
+		if by == "fingerprint" {
+			fields = append([]string{g.FingerprintID}, fields[1:]...)
+			fields = append(fields, g.Key)
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(fields, "\t")); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// jsonRenderer writes an indented JSON array.
+type jsonRenderer struct{}
+
+// rawSQL is true: JSON consumers get the SQL text as is.
+func (jsonRenderer) rawSQL() bool { return true }
+
+// rows prints rows as a JSON array of objects keyed by the lowercase column
+// names.
+func (jsonRenderer) rows(w io.Writer, cols []listColumn, rows []Process) error {
+	out := make([]map[string]string, 0, len(rows))
+	for _, r := range rows {
+		obj := make(map[string]string, len(cols))
+		for _, c := range cols {
+			obj[strings.ToLower(c.Name)] = c.Value(r)
+		}
+		out = append(out, obj)
+	}
+	return writeIndentedJSON(w, out)
+}
+
+// groups prints grouped sessions as a JSON array.
+func (jsonRenderer) groups(w io.Writer, _ string, groups []processGroup) error {
+	type groupJSON struct {
+		processGroup
+		AvgTime float64 `json:"avg_time"`
+	}
+	out := make([]groupJSON, len(groups))
+	for i, g := range groups {
+		out[i] = groupJSON{processGroup: g, AvgTime: g.AvgTime()}
+	}
+	return writeIndentedJSON(w, out)
+}
+
+// writeIndentedJSON encodes v to w with two-space indentation.
+func writeIndentedJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("write json: %w", err)
+	}
+	return nil
+}
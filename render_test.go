@@ -0,0 +1,93 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableRendererRows(t *testing.T) {
+	rows := []Process{
+		{
+			ID:      7,
+			User:    sql.NullString{String: "app", Valid: true},
+			Command: sql.NullString{String: "Sleep", Valid: true},
+			Time:    sql.NullInt64{Int64: 120, Valid: true},
+			Trx: &Transaction{
+				ID:           sql.NullString{String: "421", Valid: true},
+				State:        sql.NullString{String: "RUNNING", Valid: true},
+				Age:          sql.NullInt64{Int64: 118, Valid: true},
+				RowsModified: sql.NullInt64{Int64: 3, Valid: true},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	cols, err := listColumns(&ListCmd{Trx: true}, processListSource{}, killPrivileges{User: "app"})
+	if err != nil {
+		t.Fatalf("listColumns: %v", err)
+	}
+	if err := (tableRenderer{}).rows(&buf, cols, rows); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got:\n%s", buf.String())
+	}
+	if got := strings.Fields(lines[0]); !reflect.DeepEqual(got, []string{
+		"ID", "USER", "HOST", "DB", "COMMAND", "TIME", "STATE",
+		"TRX_ID", "TRX_STATE", "TRX_STARTED", "TRX_AGE", "ROWS_LOCKED", "ROWS_MODIFIED", "ISOLATION",
+		"KILLABLE", "INFO",
+	}) {
+		t.Fatalf("header mismatch: %q", lines[0])
+	}
+	for _, want := range []string{"7", "app", "Sleep", "421", "RUNNING", "118", "yes"} {
+		if !strings.Contains(lines[1], want) {
+			t.Fatalf("row missing %q: %q", want, lines[1])
+		}
+	}
+}
+
+func TestJSONRendererRows(t *testing.T) {
+	rows := []Process{{ID: 7, User: sql.NullString{String: "app", Valid: true}, Info: sql.NullString{String: "SELECT\n 1", Valid: true}}}
+	cols, err := listColumns(&ListCmd{Columns: []string{"id", "user", "db", "info"}, Full: true}, processListSource{}, killPrivileges{})
+	if err != nil {
+		t.Fatalf("listColumns: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := (jsonRenderer{}).rows(&buf, cols, rows); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "[\n  {\n    \"db\": \"\",\n    \"id\": \"7\",\n    \"info\": \"SELECT\\n 1\",\n    \"user\": \"app\"\n  }\n]\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestTableRendererGroups(t *testing.T) {
+	groups := []processGroup{{Key: "select ?", FingerprintID: "ABCDEF0123456789", Count: 2, MaxTime: 9, TotalTime: 10, SampleID: 7}}
+	var buf bytes.Buffer
+	if err := (tableRenderer{}).groups(&buf, "fingerprint", groups); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := "FINGERPRINT_ID    COUNT  MAX_TIME  AVG_TIME  SAMPLE_ID  FINGERPRINT\n" +
+		"ABCDEF0123456789  2      9         5.0       7          select ?\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestLookupRenderer(t *testing.T) {
+	for format, want := range map[string]renderer{"": tableRenderer{}, "table": tableRenderer{}, "json": jsonRenderer{}} {
+		got, err := lookupRenderer(format)
+		if err != nil || got != want {
+			t.Fatalf("%q: got %T, %v", format, got, err)
+		}
+	}
+	if _, err := lookupRenderer("yaml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
@@ -0,0 +1,198 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// auroraWriterSessionID is the SESSION_ID of the writer in
+// information_schema.replica_host_status.
+const auroraWriterSessionID = "MASTER_SESSION_ID"
+
+// roleVerdict is the outcome of reader/writer detection.
+type roleVerdict struct {
+	Reader bool
+	// Reason names the source that decided the verdict.
+	Reason string
+	// Values lists the raw values consulted, in the order they were checked.
+	Values []roleValue
+}
+
+// roleValue is a raw value consulted during role detection.
+type roleValue struct {
+	Name  string
+	Value string
+}
+
+// Role returns "reader" or "writer".
+func (v roleVerdict) Role() string {
+	if v.Reader {
+		return "reader"
+	}
+	return "writer"
+}
+
+// String formats the verdict with its reason and raw values.
+func (v roleVerdict) String() string {
+	vals := make([]string, 0, len(v.Values))
+	for _, rv := range v.Values {
+		vals = append(vals, rv.Name+"="+rv.Value)
+	}
+	return fmt.Sprintf("%s (%s) [%s]", v.Role(), v.Reason, strings.Join(vals, " "))
+}
+
+// roleSources holds the raw values that decide the reader/writer role.
+// Invalid fields were unavailable on the server.
+type roleSources struct {
+	InnodbReadOnly sql.NullInt64
+	ReadOnly       sql.NullInt64
+	SuperReadOnly  sql.NullInt64
+	// GroupRole is the Group Replication MEMBER_ROLE (PRIMARY/SECONDARY).
+	GroupRole sql.NullString
+	// AuroraSessionID is this instance's SESSION_ID in replica_host_status.
+	AuroraSessionID sql.NullString
+}
+
+// verdictFromSources interprets role sources as reader or writer.
+// Topology sources (Aurora, Group Replication) win over read-only variables,
+// since they reflect the role the cluster assigned to the instance.
+func verdictFromSources(s roleSources) roleVerdict {
+	var v roleVerdict
+	addInt := func(name string, n sql.NullInt64) {
+		if n.Valid {
+			v.Values = append(v.Values, roleValue{Name: name, Value: strconv.FormatInt(n.Int64, 10)})
+		}
+	}
+	addString := func(name string, str sql.NullString) {
+		if str.Valid && str.String != "" {
+			v.Values = append(v.Values, roleValue{Name: name, Value: str.String})
+		}
+	}
+	addString("aurora_session_id", s.AuroraSessionID)
+	addString("group_replication_role", s.GroupRole)
+	addInt("innodb_read_only", s.InnodbReadOnly)
+	addInt("super_read_only", s.SuperReadOnly)
+	addInt("read_only", s.ReadOnly)
+
+	switch {
+	case s.AuroraSessionID.Valid && s.AuroraSessionID.String != "":
+		v.Reader = s.AuroraSessionID.String != auroraWriterSessionID
+		if v.Reader {
+			v.Reason = "aurora replica"
+		} else {
+			v.Reason = "aurora writer"
+		}
+	case strings.EqualFold(s.GroupRole.String, "PRIMARY"):
+		v.Reason = "group replication PRIMARY"
+	case strings.EqualFold(s.GroupRole.String, "SECONDARY"):
+		v.Reader = true
+		v.Reason = "group replication SECONDARY"
+	case s.InnodbReadOnly.Valid && s.InnodbReadOnly.Int64 == 1:
+		v.Reader = true
+		v.Reason = "innodb_read_only=1"
+	case s.SuperReadOnly.Valid && s.SuperReadOnly.Int64 == 1:
+		v.Reader = true
+		v.Reason = "super_read_only=1"
+	case s.ReadOnly.Valid && s.ReadOnly.Int64 == 1:
+		v.Reader = true
+		v.Reason = "read_only=1"
+	default:
+		v.Reason = "no read-only setting enabled"
+	}
+	return v
+}
+
+// queryRoleSources reads the read-only variables and Group Replication role.
+// Sources the server does not support are left invalid.
+func queryRoleSources(ctx context.Context, db *sql.DB) (roleSources, error) {
+	var s roleSources
+
+	flags, err := readGlobalFlags(ctx, db, "innodb_read_only", "read_only", "super_read_only")
+	if err != nil {
+		return s, fmt.Errorf("detect reader: %w", err)
+	}
+	s.InnodbReadOnly = flags["innodb_read_only"]
+	s.ReadOnly = flags["read_only"]
+	s.SuperReadOnly = flags["super_read_only"]
+
+	const groupQuery = `SELECT MEMBER_ROLE FROM performance_schema.replication_group_members WHERE MEMBER_ID = @@server_uuid AND MEMBER_STATE = 'ONLINE'`
+	err = db.QueryRowContext(ctx, groupQuery).Scan(&s.GroupRole)
+	switch {
+	case err == nil, errors.Is(err, sql.ErrNoRows), isMissingObjectError(err):
+	default:
+		return s, fmt.Errorf("detect reader (group replication): %w", err)
+	}
+
+	return s, nil
+}
+
+// queryAuroraSessionID reads this instance's SESSION_ID from
+// information_schema.replica_host_status.
+func queryAuroraSessionID(ctx context.Context, db *sql.DB) (sql.NullString, error) {
+	var id sql.NullString
+	const query = `SELECT SESSION_ID FROM information_schema.replica_host_status WHERE SERVER_ID = @@aurora_server_id`
+	err := db.QueryRowContext(ctx, query).Scan(&id)
+	switch {
+	case err == nil, errors.Is(err, sql.ErrNoRows), isMissingObjectError(err):
+		return id, nil
+	default:
+		return id, fmt.Errorf("detect reader (aurora): %w", err)
+	}
+}
+
+// readGlobalFlags reads boolean global variables. Variables unknown to the
+// server are absent from the result.
+func readGlobalFlags(ctx context.Context, db *sql.DB, names ...string) (map[string]sql.NullInt64, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	args := make([]any, 0, len(names))
+	for _, n := range names {
+		args = append(args, n)
+	}
+
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL VARIABLES WHERE Variable_name IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	flags := make(map[string]sql.NullInt64, len(names))
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		flags[strings.ToLower(name)] = parseFlag(value)
+	}
+	return flags, rows.Err()
+}
+
+// parseFlag converts ON/OFF or 1/0 variable values.
+func parseFlag(value string) sql.NullInt64 {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "ON", "1", "TRUE":
+		return sql.NullInt64{Int64: 1, Valid: true}
+	case "OFF", "0", "FALSE":
+		return sql.NullInt64{Int64: 0, Valid: true}
+	}
+	return sql.NullInt64{}
+}
+
+// isMissingObjectError reports whether err is a MySQL unknown table, column
+// or variable error, i.e. the source is not available on this server.
+func isMissingObjectError(err error) bool {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+	switch myErr.Number {
+	case 1054, 1109, 1146, 1193:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestVerdictFromSources(t *testing.T) {
+	one := sql.NullInt64{Int64: 1, Valid: true}
+	zero := sql.NullInt64{Int64: 0, Valid: true}
+
+	cases := []struct {
+		name           string
+		sources        roleSources
+		expectedReader bool
+		expectedReason string
+	}{
+		{
+			name:           "innodb_read_only=1",
+			sources:        roleSources{InnodbReadOnly: one, ReadOnly: zero},
+			expectedReader: true,
+			expectedReason: "innodb_read_only=1",
+		},
+		{
+			name:           "read_only=1",
+			sources:        roleSources{InnodbReadOnly: zero, ReadOnly: one},
+			expectedReader: true,
+			expectedReason: "read_only=1",
+		},
+		{
+			name:           "super_read_only only",
+			sources:        roleSources{InnodbReadOnly: zero, ReadOnly: zero, SuperReadOnly: one},
+			expectedReader: true,
+			expectedReason: "super_read_only=1",
+		},
+		{
+			name:           "both_zero",
+			sources:        roleSources{InnodbReadOnly: zero, ReadOnly: zero},
+			expectedReader: false,
+			expectedReason: "no read-only setting enabled",
+		},
+		{
+			name:           "nulls",
+			sources:        roleSources{},
+			expectedReader: false,
+			expectedReason: "no read-only setting enabled",
+		},
+		{
+			name: "group replication primary",
+			sources: roleSources{
+				ReadOnly:  zero,
+				GroupRole: sql.NullString{String: "PRIMARY", Valid: true},
+			},
+			expectedReader: false,
+			expectedReason: "group replication PRIMARY",
+		},
+		{
+			name: "group replication secondary",
+			sources: roleSources{
+				ReadOnly:  zero,
+				GroupRole: sql.NullString{String: "SECONDARY", Valid: true},
+			},
+			expectedReader: true,
+			expectedReason: "group replication SECONDARY",
+		},
+		{
+			name: "aurora writer with read_only off",
+			sources: roleSources{
+				InnodbReadOnly:  zero,
+				AuroraSessionID: sql.NullString{String: auroraWriterSessionID, Valid: true},
+			},
+			expectedReader: false,
+			expectedReason: "aurora writer",
+		},
+		{
+			name: "aurora replica",
+			sources: roleSources{
+				InnodbReadOnly:  one,
+				AuroraSessionID: sql.NullString{String: "8a3c1c8e-2f5a-4b2e-9d3c-0c4d2b1e5f6a", Valid: true},
+			},
+			expectedReader: true,
+			expectedReason: "aurora replica",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := verdictFromSources(tc.sources)
+			if got.Reader != tc.expectedReader {
+				t.Fatalf("got %v want %v", got.Reader, tc.expectedReader)
+			}
+			if got.Reason != tc.expectedReason {
+				t.Fatalf("reason: got %q want %q", got.Reason, tc.expectedReason)
+			}
+		})
+	}
+}
+
+func TestRoleVerdictString(t *testing.T) {
+	v := verdictFromSources(roleSources{
+		InnodbReadOnly: sql.NullInt64{Int64: 0, Valid: true},
+		ReadOnly:       sql.NullInt64{Int64: 1, Valid: true},
+		SuperReadOnly:  sql.NullInt64{Int64: 1, Valid: true},
+	})
+	got := v.String()
+	want := "reader (super_read_only=1) [innodb_read_only=0 super_read_only=1 read_only=1]"
+	if got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestTiDBVerdict(t *testing.T) {
+	v := tidbVerdict(sql.NullInt64{Int64: 0, Valid: true}, sql.NullInt64{Int64: 1, Valid: true})
+	if !v.Reader || !strings.Contains(v.Reason, "tidb_super_read_only") {
+		t.Fatalf("unexpected verdict: %s", v)
+	}
+	v = tidbVerdict(sql.NullInt64{}, sql.NullInt64{})
+	if v.Reader {
+		t.Fatalf("expected writer, got %s", v)
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	cases := map[string]sql.NullInt64{
+		"ON":  {Int64: 1, Valid: true},
+		"off": {Int64: 0, Valid: true},
+		"1":   {Int64: 1, Valid: true},
+		"":    {},
+	}
+	for in, want := range cases {
+		if got := parseFlag(in); got != want {
+			t.Fatalf("parseFlag(%q): got %#v want %#v", in, got, want)
+		}
+	}
+}
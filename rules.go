@@ -0,0 +1,475 @@
+package mysqlkill
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Rule actions.
+const (
+	// ruleKill kills the connection of matching sessions.
+	ruleKill = "kill"
+	// ruleKillQuery kills only their running query.
+	ruleKillQuery = "kill-query"
+	// rulePrint only reports them. A print rule still claims its sessions,
+	// so one of higher priority exempts them from the other rules.
+	rulePrint = "print"
+)
+
+// Rule is a declarative kill policy, a [[rule]] entry run by watch --rules.
+type Rule struct {
+	Name string
+	// Priority orders the rules: a session matched by several is claimed by
+	// the highest, ties going to the one defined first.
+	Priority int
+	// Action is "kill", "kill-query" or "print".
+	Action string
+	Filter Filter
+	// Victims is the strategy picking the sessions to kill among the
+	// matches, e.g. "oldest" or "top-3"; empty means all.
+	Victims string
+	// AbortOver is a hard cap: when more sessions are picked, the rule kills
+	// none that cycle and reports an error. 0 means no cap.
+	AbortOver int
+	// MaxVictims caps the sessions the rule kills per cycle, the longest
+	// running first; 0 means no cap.
+	MaxVictims int
+	DryRun     bool
+	// AllowWriter overrides the allow_writer setting for the rule when set.
+	AllowWriter *bool
+	// ProtectedUsers are MySQL users whose sessions the rule never kills.
+	ProtectedUsers []string
+}
+
+// killCmd returns the kill flags of the rule's action.
+func (r Rule) killCmd(dryRun bool) *KillCmd {
+	return &KillCmd{Kill: r.Action == ruleKill, KillQuery: r.Action == ruleKillQuery, DryRun: dryRun || r.DryRun}
+}
+
+// config returns cfg with the rule's reader guard override applied.
+func (r Rule) config(cfg AppConfig) AppConfig {
+	if r.AllowWriter != nil {
+		cfg.AllowWriter = *r.AllowWriter
+	}
+	return cfg
+}
+
+// loadRules validates the [[rule]] entries of fileCfg and of its rules_file.
+func loadRules(fileCfg *fileConfig) ([]Rule, error) {
+	entries := fileCfg.Rules
+	if fileCfg.MySQLKill.RulesFile != nil {
+		more, err := loadRulesFile(expandTilde(*fileCfg.MySQLKill.RulesFile))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, more...)
+	}
+
+	rules := make([]Rule, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		r, err := ruleFromFile(e)
+		if err != nil {
+			return nil, err
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", r.Name)
+		}
+		seen[r.Name] = true
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// loadRulesFile loads the [[rule]] entries of a rules file.
+func loadRulesFile(path string) ([]fileRule, error) {
+	var f struct {
+		Rules []fileRule `toml:"rule"`
+	}
+	md, err := toml.DecodeFile(path, &f)
+	if err != nil {
+		return nil, fmt.Errorf("load rules file %s: %w", path, err)
+	}
+	if err := checkRuleKeys(md); err != nil {
+		return nil, fmt.Errorf("load rules file %s: %w", path, err)
+	}
+	return f.Rules, nil
+}
+
+// checkRuleKeys rejects unknown keys in [[rule]] entries: a misspelt filter
+// would otherwise silently widen what a rule kills.
+func checkRuleKeys(md toml.MetaData) error {
+	for _, k := range md.Undecoded() {
+		if len(k) > 1 && k[0] == "rule" {
+			return fmt.Errorf("unknown rule setting %q", k[len(k)-1])
+		}
+	}
+	return nil
+}
+
+// ruleFromFile validates a [[rule]] entry.
+func ruleFromFile(f fileRule) (Rule, error) {
+	r := Rule{
+		Name:       f.Name,
+		Priority:   f.Priority,
+		Action:     f.Action,
+		Victims:    f.Victims,
+		AbortOver:  f.AbortOver,
+		MaxVictims: f.MaxVictims,
+		DryRun:     f.DryRun,
+
+		AllowWriter:    f.AllowWriter,
+		ProtectedUsers: f.ProtectedUsers,
+		Filter: Filter{
+			Match:       f.Match,
+			Users:       f.User,
+			Hosts:       f.Host,
+			DBs:         f.DB,
+			Commands:    f.Command,
+			States:      f.State,
+			IgnoreUsers: f.IgnoreUser,
+			IgnoreInfos: f.IgnoreInfo,
+			Where:       f.Where,
+			InTrx:       f.InTrx,
+		},
+	}
+	if r.Name == "" {
+		return r, errors.New("rule: name is required")
+	}
+	switch r.Action {
+	case ruleKill, ruleKillQuery, rulePrint:
+	case "":
+		return r, fmt.Errorf("rule %s: action is required", r.Name)
+	default:
+		return r, fmt.Errorf("rule %s: unknown action %q: use %q, %q or %q", r.Name, r.Action, ruleKill, ruleKillQuery, rulePrint)
+	}
+	if err := validateVictims(r.Victims); err != nil {
+		return r, fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+	if r.MaxVictims < 0 || r.AbortOver < 0 {
+		return r, fmt.Errorf("rule %s: max_victims and abort_over must not be negative", r.Name)
+	}
+
+	for _, d := range []struct {
+		key   string
+		value string
+		dst   *time.Duration
+	}{
+		{"min_time", f.MinTime, &r.Filter.MinTime},
+		{"max_time", f.MaxTime, &r.Filter.MaxTime},
+		{"trx_age", f.TrxAge, &r.Filter.TrxAge},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return r, fmt.Errorf("rule %s: invalid %s: %w", r.Name, d.key, err)
+		}
+		if v < 0 {
+			return r, fmt.Errorf("rule %s: %s must not be negative", r.Name, d.key)
+		}
+		*d.dst = v
+	}
+
+	cmd := r.Filter.listCmd()
+	if err := cmd.validate(); err != nil {
+		return r, fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+	// Without a filter every session matches.
+	if r.Action != rulePrint && cmd.Match == "" && !cmd.hasServerFilters() && !cmd.InTrx && cmd.TrxAge <= 0 {
+		return r, fmt.Errorf("rule %s: a %s rule needs at least one filter, e.g. min_time or match", r.Name, r.Action)
+	}
+	return r, nil
+}
+
+// sortedRules returns rules by descending priority, keeping the definition
+// order among equals.
+func sortedRules(rules []Rule) []Rule {
+	sorted := slices.Clone(rules)
+	slices.SortStableFunc(sorted, func(a, b Rule) int { return cmp.Compare(b.Priority, a.Priority) })
+	return sorted
+}
+
+// ruleHit is a session matched by a rule.
+type ruleHit struct {
+	Process Process
+	// Skip tells why the rule leaves the session alone; empty for a victim.
+	Skip string
+}
+
+// rulePlan is what a rule does in one cycle.
+type rulePlan struct {
+	Rule Rule
+	Hits []ruleHit
+	// Err is set when the victims exceed the rule's abort_over, in which
+	// case it kills none.
+	Err error
+}
+
+// victims returns the IDs of the sessions the rule acts on.
+func (p rulePlan) victims() []int64 {
+	var ids []int64
+	for _, h := range p.Hits {
+		if h.Skip == "" {
+			ids = append(ids, h.ID())
+		}
+	}
+	return ids
+}
+
+// ID returns the process ID of the hit.
+func (h ruleHit) ID() int64 {
+	return h.Process.ID
+}
+
+// planRules matches rules, in priority order, against the processlist
+// without the session self. abortOver is the cap of the config.
+func planRules(ctx context.Context, db *sql.DB, f flavor, src processListSource, rules []Rule, self int64, abortOver int) ([]rulePlan, error) {
+	claimed := make(map[int64]string)
+	var plans []rulePlan
+	for _, r := range sortedRules(rules) {
+		rows, err := fetchProcessList(ctx, db, f, src, r.Filter.listCmd())
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		plans = append(plans, planRule(r, rows, self, claimed, abortOver))
+	}
+	return plans, nil
+}
+
+// planRule decides what r does with rows, the sessions matching its filter.
+// Each session is claimed by the first rule that matches it, recorded in
+// claimed. Among the unprotected sessions it claims, the rule picks its
+// victims by strategy, then checks them against abort_over and max_victims.
+// abortOver, the cap of the config, applies to the sessions it would kill.
+func planRule(r Rule, rows []Process, self int64, claimed map[int64]string, abortOver int) rulePlan {
+	slices.SortStableFunc(rows, func(a, b Process) int { return cmp.Compare(b.Time.Int64, a.Time.Int64) })
+
+	plan := rulePlan{Rule: r}
+	var candidates []Process
+	for _, p := range rows {
+		if p.ID == self {
+			continue
+		}
+		hit := ruleHit{Process: p}
+		switch by := claimed[p.ID]; {
+		case by != "":
+			hit.Skip = "claimed by rule " + by
+		case slices.Contains(r.ProtectedUsers, nullString(p.User)):
+			hit.Skip = "protected user"
+		default:
+			candidates = append(candidates, p)
+		}
+		if claimed[p.ID] == "" {
+			claimed[p.ID] = r.Name
+		}
+		plan.Hits = append(plan.Hits, hit)
+	}
+
+	picked := make(map[int64]bool)
+	for _, p := range selectVictims(candidates, r.Victims) {
+		picked[p.ID] = true
+	}
+	plan.Err = checkVictimCap(len(picked), r.AbortOver)
+	if n := len(picked); plan.Err == nil {
+		if r.MaxVictims > 0 {
+			n = min(n, r.MaxVictims)
+		}
+		plan.Err = checkVictimCap(n, abortOver)
+	}
+	victims := 0
+	for i, h := range plan.Hits {
+		if h.Skip != "" {
+			continue
+		}
+		switch {
+		case !picked[h.ID()]:
+			plan.Hits[i].Skip = "not selected by victims " + r.Victims
+		case plan.Err != nil:
+			plan.Hits[i].Skip = "over abort_over"
+		case r.MaxVictims > 0 && victims >= r.MaxVictims:
+			plan.Hits[i].Skip = "over max_victims"
+		default:
+			victims++
+		}
+	}
+	return plan
+}
+
+// runRulesTest executes the rules test command.
+func runRulesTest(ctx context.Context, cli *CLI, cmd *RulesTestCmd) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return errors.New("rules are not supported with target proxysql")
+	}
+	rules, err := selectRules(cfg.Rules, cmd.Rule)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient(ctx, cfg, "rules")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+	c.singleConn()
+
+	var self int64
+	if err := c.db.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&self); err != nil {
+		return fmt.Errorf("query connection id: %w", err)
+	}
+	plans, err := planRules(ctx, c.db, c.f, c.src, rules, self, cfg.AbortOver)
+	if err != nil {
+		return err
+	}
+	if err := guardRulePlans(ctx, c.db, c.f, cfg, plans); err != nil {
+		return err
+	}
+
+	if cmd.Format == "json" {
+		return writeRulePlansJSON(os.Stdout, plans, cfg.Redaction)
+	}
+	return writeRulePlans(os.Stdout, plans, cfg.Redaction)
+}
+
+// selectRules returns the rules named in names, all of them when empty.
+func selectRules(rules []Rule, names []string) ([]Rule, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no rules: add [[rule]] entries to the config or set rules_file")
+	}
+	if len(names) == 0 {
+		return rules, nil
+	}
+	var selected []Rule
+	for _, name := range names {
+		i := slices.IndexFunc(rules, func(r Rule) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		selected = append(selected, rules[i])
+	}
+	return selected, nil
+}
+
+// guardRulePlans marks the victims of kill rules the reader guard refuses.
+func guardRulePlans(ctx context.Context, db *sql.DB, f flavor, cfg AppConfig, plans []rulePlan) error {
+	refusals := make(map[bool]error)
+	for i, p := range plans {
+		if p.Rule.Action == rulePrint {
+			continue
+		}
+		rcfg := p.Rule.config(cfg)
+		refusal, ok := refusals[rcfg.AllowWriter]
+		if !ok {
+			verdict, err := enforceReader(ctx, db, f, rcfg)
+			// Only a detected writer is a refusal; anything else is a failure.
+			if err != nil && (verdict.Reason == "" || verdict.Reader) {
+				return err
+			}
+			refusal = err
+			refusals[rcfg.AllowWriter] = err
+		}
+		if refusal == nil {
+			continue
+		}
+		for j := range p.Hits {
+			if p.Hits[j].Skip == "" {
+				plans[i].Hits[j].Skip = "refused: writer"
+			}
+		}
+	}
+	return nil
+}
+
+// ruleHitResult describes what the rule of plan does with hit.
+func ruleHitResult(plan rulePlan, hit ruleHit) string {
+	if hit.Skip != "" {
+		return "skip: " + hit.Skip
+	}
+	if plan.Rule.DryRun && plan.Rule.Action != rulePrint {
+		return plan.Rule.Action + " (dry run)"
+	}
+	return plan.Rule.Action
+}
+
+// writeRulePlans prints the sessions each rule hits as a table, with a line
+// for rules hitting none.
+func writeRulePlans(w io.Writer, plans []rulePlan, red redactor) error {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "RULE\tPRIORITY\tID\tUSER\tHOST\tTIME\tRESULT\tINFO"); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for _, p := range plans {
+		if len(p.Hits) == 0 {
+			if _, err := fmt.Fprintf(tw, "%s\t%d\t-\t\t\t\tno sessions\t\n", p.Rule.Name, p.Rule.Priority); err != nil {
+				return fmt.Errorf("write row: %w", err)
+			}
+			continue
+		}
+		for _, h := range p.Hits {
+			r := red.Row(h.Process)
+			if _, err := fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				p.Rule.Name,
+				p.Rule.Priority,
+				r.ID,
+				nullString(r.User),
+				nullString(r.Host),
+				nullInt(r.Time),
+				ruleHitResult(p, h),
+				truncateText(flattenSpace(nullString(r.Info)), infoMaxWidth),
+			); err != nil {
+				return fmt.Errorf("write row: %w", err)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// writeRulePlansJSON prints the sessions each rule hits as a JSON array.
+func writeRulePlansJSON(w io.Writer, plans []rulePlan, red redactor) error {
+	type hitJSON struct {
+		ID     int64  `json:"id"`
+		User   string `json:"user"`
+		Host   string `json:"host"`
+		Time   string `json:"time"`
+		Result string `json:"result"`
+		Info   string `json:"info"`
+	}
+	type planJSON struct {
+		Rule     string    `json:"rule"`
+		Priority int       `json:"priority"`
+		Action   string    `json:"action"`
+		DryRun   bool      `json:"dry_run"`
+		Sessions []hitJSON `json:"sessions"`
+	}
+	out := make([]planJSON, len(plans))
+	for i, p := range plans {
+		out[i] = planJSON{Rule: p.Rule.Name, Priority: p.Rule.Priority, Action: p.Rule.Action, DryRun: p.Rule.DryRun, Sessions: []hitJSON{}}
+		for _, h := range p.Hits {
+			r := red.Row(h.Process)
+			out[i].Sessions = append(out[i].Sessions, hitJSON{
+				ID:     r.ID,
+				User:   nullString(r.User),
+				Host:   nullString(r.Host),
+				Time:   nullInt(r.Time),
+				Result: ruleHitResult(p, h),
+				Info:   nullString(r.Info),
+			})
+		}
+	}
+	return writeIndentedJSON(w, out)
+}
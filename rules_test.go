@@ -0,0 +1,252 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortedRules(t *testing.T) {
+	rules := []Rule{{Name: "a"}, {Name: "b", Priority: 5}, {Name: "c"}, {Name: "d", Priority: 5}, {Name: "e", Priority: -1}}
+	var got []string
+	for _, r := range sortedRules(rules) {
+		got = append(got, r.Name)
+	}
+	if strings.Join(got, ",") != "b,d,a,c,e" {
+		t.Fatalf("got %v", got)
+	}
+	if rules[0].Name != "a" {
+		t.Fatalf("input reordered: %v", rules)
+	}
+}
+
+func TestSelectRules(t *testing.T) {
+	rules := []Rule{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	cases := []struct {
+		name    string
+		rules   []Rule
+		names   []string
+		want    string
+		wantErr bool
+	}{
+		{name: "all", rules: rules, want: "a,b,c"},
+		{name: "named", rules: rules, names: []string{"c", "a"}, want: "c,a"},
+		{name: "unknown", rules: rules, names: []string{"x"}, wantErr: true},
+		{name: "no rules", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectRules(tc.rules, tc.names)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			var names []string
+			for _, r := range got {
+				names = append(names, r.Name)
+			}
+			if strings.Join(names, ",") != tc.want {
+				t.Fatalf("got %v, want %s", names, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuleKillCmd(t *testing.T) {
+	cases := []struct {
+		name   string
+		rule   Rule
+		dryRun bool
+		want   KillCmd
+	}{
+		{name: "kill", rule: Rule{Action: ruleKill}, want: KillCmd{Kill: true}},
+		{name: "kill-query", rule: Rule{Action: ruleKillQuery}, want: KillCmd{KillQuery: true}},
+		{name: "rule dry run", rule: Rule{Action: ruleKill, DryRun: true}, want: KillCmd{Kill: true, DryRun: true}},
+		{name: "flag dry run", rule: Rule{Action: ruleKillQuery}, dryRun: true, want: KillCmd{KillQuery: true, DryRun: true}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := *tc.rule.killCmd(tc.dryRun); got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuleConfig(t *testing.T) {
+	yes, no := true, false
+	if (Rule{}).config(AppConfig{AllowWriter: true}).AllowWriter != true {
+		t.Fatal("unset override changed allow_writer")
+	}
+	if (Rule{AllowWriter: &yes}).config(AppConfig{}).AllowWriter != true {
+		t.Fatal("allow_writer = true not applied")
+	}
+	if (Rule{AllowWriter: &no}).config(AppConfig{AllowWriter: true}).AllowWriter != false {
+		t.Fatal("allow_writer = false not applied")
+	}
+}
+
+func rulePlanFixture() []rulePlan {
+	proc := func(id int64, user string) Process {
+		return Process{
+			ID:   id,
+			User: sql.NullString{String: user, Valid: true},
+			Host: sql.NullString{String: "10.0.0.1:5000", Valid: true},
+			Time: sql.NullInt64{Int64: 400, Valid: true},
+			Info: sql.NullString{String: "SELECT * FROM t WHERE id = 1", Valid: true},
+		}
+	}
+	return []rulePlan{
+		{
+			Rule: Rule{Name: "redash-long", Priority: 10, Action: ruleKillQuery, DryRun: true},
+			Hits: []ruleHit{{Process: proc(1, "redash")}, {Process: proc(2, "redash_admin"), Skip: "protected user"}},
+		},
+		{Rule: Rule{Name: "idle", Action: ruleKill}},
+	}
+}
+
+func TestRulePlanVictims(t *testing.T) {
+	got := rulePlanFixture()[0].victims()
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("victims = %v", got)
+	}
+}
+
+func TestWriteRulePlans(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRulePlans(&buf, rulePlanFixture(), redactor{Enabled: true}); err != nil {
+		t.Fatalf("writeRulePlans: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{"RESULT", "kill-query (dry run)", "skip: protected user", "no sessions"} {
+		if !strings.Contains(lines[i], want) {
+			t.Fatalf("line %d = %q, want %q", i, lines[i], want)
+		}
+	}
+	if strings.Contains(buf.String(), "id = 1") {
+		t.Fatalf("SQL not redacted:\n%s", buf.String())
+	}
+}
+
+func TestWriteRulePlansJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRulePlansJSON(&buf, rulePlanFixture(), redactor{}); err != nil {
+		t.Fatalf("writeRulePlansJSON: %v", err)
+	}
+	var got []struct {
+		Rule     string `json:"rule"`
+		DryRun   bool   `json:"dry_run"`
+		Sessions []struct {
+			ID     int64  `json:"id"`
+			Result string `json:"result"`
+			Info   string `json:"info"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+	}
+	if len(got) != 2 || got[0].Rule != "redash-long" || !got[0].DryRun || len(got[0].Sessions) != 2 ||
+		got[0].Sessions[1].Result != "skip: protected user" || got[0].Sessions[0].Info != "SELECT * FROM t WHERE id = 1" ||
+		got[1].Sessions == nil || len(got[1].Sessions) != 0 {
+		t.Fatalf("unexpected json:\n%s", buf.String())
+	}
+}
+
+func TestPlanRule(t *testing.T) {
+	proc := func(id int64, user string, secs int64) Process {
+		return Process{
+			ID:   id,
+			User: sql.NullString{String: user, Valid: true},
+			Time: sql.NullInt64{Int64: secs, Valid: true},
+		}
+	}
+	rows := func() []Process {
+		return []Process{proc(1, "app", 10), proc(2, "app", 50), proc(3, "admin", 40), proc(4, "etl", 30), proc(9, "me", 99)}
+	}
+	cases := []struct {
+		name      string
+		rule      Rule
+		claimed   map[int64]string
+		abortOver int
+		want      map[int64]string
+		wantErr   bool
+	}{
+		{
+			name: "all",
+			rule: Rule{Name: "r"},
+			want: map[int64]string{1: "", 2: "", 3: "", 4: ""},
+		},
+		{
+			name:    "claimed and protected",
+			rule:    Rule{Name: "r", ProtectedUsers: []string{"admin"}},
+			claimed: map[int64]string{4: "first"},
+			want:    map[int64]string{1: "", 2: "", 3: "protected user", 4: "claimed by rule first"},
+		},
+		{
+			name: "oldest",
+			rule: Rule{Name: "r", Victims: "oldest"},
+			want: map[int64]string{1: "not selected by victims oldest", 2: "", 3: "not selected by victims oldest", 4: "not selected by victims oldest"},
+		},
+		{
+			name: "max victims",
+			rule: Rule{Name: "r", Victims: "all-but-oldest", MaxVictims: 1},
+			want: map[int64]string{1: "over max_victims", 2: "not selected by victims all-but-oldest", 3: "", 4: "over max_victims"},
+		},
+		{
+			name:    "abort over",
+			rule:    Rule{Name: "r", AbortOver: 3, MaxVictims: 1},
+			want:    map[int64]string{1: "over abort_over", 2: "over abort_over", 3: "over abort_over", 4: "over abort_over"},
+			wantErr: true,
+		},
+		{
+			name: "within abort over",
+			rule: Rule{Name: "r", Victims: "per-user", AbortOver: 3},
+			want: map[int64]string{1: "not selected by victims per-user", 2: "", 3: "", 4: ""},
+		},
+		{
+			name:      "over the config cap",
+			rule:      Rule{Name: "r", AbortOver: 10},
+			abortOver: 3,
+			want:      map[int64]string{1: "over abort_over", 2: "over abort_over", 3: "over abort_over", 4: "over abort_over"},
+			wantErr:   true,
+		},
+		{
+			name:      "config cap after max victims",
+			rule:      Rule{Name: "r", MaxVictims: 2},
+			abortOver: 3,
+			want:      map[int64]string{1: "over max_victims", 2: "", 3: "", 4: "over max_victims"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claimed := map[int64]string{}
+			for id, by := range tc.claimed {
+				claimed[id] = by
+			}
+			plan := planRule(tc.rule, rows(), 9, claimed, tc.abortOver)
+			if (plan.Err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", plan.Err, tc.wantErr)
+			}
+			got := map[int64]string{}
+			for _, h := range plan.Hits {
+				got[h.ID()] = h.Skip
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			if plan.Hits[0].ID() != 2 {
+				t.Fatalf("hits not longest running first: %+v", plan.Hits)
+			}
+			for _, h := range plan.Hits {
+				if tc.claimed[h.ID()] == "" && claimed[h.ID()] != "r" {
+					t.Fatalf("process %d not claimed by the rule", h.ID())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package mysqlkill
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// caller identifies who asks for a kill: an OS user on the command line, or
+// a token through serve.
+type caller struct {
+	osUser string
+	token  string
+}
+
+func (c caller) String() string {
+	if c.token != "" {
+		return "token " + c.token
+	}
+	return "OS user " + c.osUser
+}
+
+// name returns the OS user or token name, as listed in admins.
+func (c caller) name() string {
+	return firstNonEmpty(c.token, c.osUser)
+}
+
+// selfServicePolicy returns the victim check of c under cfg, or nil when
+// the policy is off or c is an admin. A session belongs to c when its MySQL
+// user or one of the tags in its SQL comments is granted to c.
+func selfServicePolicy(cfg SelfServiceConfig, c caller) func(Process) error {
+	if !cfg.Enabled || slices.Contains(cfg.Admins, c.name()) {
+		return nil
+	}
+	var users, tags []string
+	if cfg.MatchOSUser && c.osUser != "" {
+		users = append(users, c.osUser)
+	}
+	for _, id := range cfg.Identities {
+		if (c.token != "" && id.Token == c.token) || (c.token == "" && id.OSUser == c.osUser) {
+			users = append(users, id.Users...)
+			tags = append(tags, id.Tags...)
+		}
+	}
+
+	return func(r Process) error {
+		if slices.Contains(users, nullString(r.User)) {
+			return nil
+		}
+		for _, tag := range tags {
+			if hasCommentTag(nullString(r.Info), tag) {
+				return nil
+			}
+		}
+		return fmt.Errorf("self-service: process %d (user %q) does not belong to %s", r.ID, nullString(r.User), c)
+	}
+}
+
+// hasCommentTag reports whether a /* ... */ comment of query contains tag as
+// whole words, whitespace-insensitively: "user_id=42" does not match
+// "user_id=420". String literals and line comments are skipped, so a tag
+// inside them does not count.
+func hasCommentTag(query, tag string) bool {
+	tag = flattenSpace(tag)
+	if tag == "" {
+		return false
+	}
+	for i := 0; i < len(query); {
+		switch {
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			i = skipQuoted(query, i)
+		case query[i] == '#' || strings.HasPrefix(query[i:], "-- "):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "/*"):
+			rest := query[i+2:]
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				end = len(rest)
+			}
+			if commentHasTag(rest[:end], tag) {
+				return true
+			}
+			i += 2 + end + 2
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// commentHasTag reports whether the text of a comment contains tag, already
+// flattened, as whole words.
+func commentHasTag(text, tag string) bool {
+	comment := " " + flattenSpace(text) + " "
+	for i := 0; ; {
+		j := strings.Index(comment[i:], tag)
+		if j < 0 {
+			return false
+		}
+		j += i
+		left := !isWordByte(tag[0]) || !isWordByte(comment[j-1])
+		right := !isWordByte(tag[len(tag)-1]) || !isWordByte(comment[j+len(tag)])
+		if left && right {
+			return true
+		}
+		i = j + 1
+	}
+}
+
+// isWordByte reports whether b is a letter, a digit or an underscore.
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// allowAll combines victim checks, ignoring nil ones; it returns nil when
+// none is left.
+func allowAll(checks ...func(Process) error) func(Process) error {
+	checks = slices.DeleteFunc(checks, func(f func(Process) error) bool { return f == nil })
+	if len(checks) == 0 {
+		return nil
+	}
+	return func(r Process) error {
+		for _, check := range checks {
+			if err := check(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
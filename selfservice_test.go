@@ -0,0 +1,86 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestHasCommentTag(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		tag   string
+		want  bool
+	}{
+		{name: "tagged", query: "/* redash user_id=42 */ SELECT 1", tag: "redash user_id=42", want: true},
+		{name: "trailing comment", query: "SELECT 1 /* job=etl   user_id=42 */", tag: "user_id=42", want: true},
+		{name: "extra spaces in comment", query: "/*redash\n  user_id=42*/ SELECT 1", tag: "redash user_id=42", want: true},
+		{name: "longer id", query: "/* redash user_id=420 */ SELECT 1", tag: "user_id=42", want: false},
+		{name: "prefixed word", query: "/* myredash */ SELECT 1", tag: "redash", want: false},
+		{name: "tag in SQL not comment", query: "SELECT 'redash user_id=42'", tag: "redash user_id=42", want: false},
+		{name: "second comment", query: "/* a */ SELECT /* user_id=42 */ 1", tag: "user_id=42", want: true},
+		{name: "unterminated comment", query: "SELECT 1 /* user_id=42", tag: "user_id=42", want: true},
+		{name: "punctuation edge", query: "/* Username: bob@example.com, Query ID: 7 */", tag: "Username: bob@example.com,", want: true},
+		{name: "empty tag", query: "/* x */", tag: " ", want: false},
+		{name: "comment in a literal", query: "SELECT '/* owner=alice */'", tag: "owner=alice", want: false},
+		{name: "comment in a double-quoted literal", query: `SELECT "it's /* owner=alice */"`, tag: "owner=alice", want: false},
+		{name: "escaped quote in literal", query: `SELECT 'a\' /* owner=alice */' /* owner=bob */`, tag: "owner=alice", want: false},
+		{name: "comment after a literal", query: "SELECT 'x' /* owner=alice */", tag: "owner=alice", want: true},
+		{name: "quote in a line comment", query: "SELECT 1 -- it's\n/* owner=alice */", tag: "owner=alice", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasCommentTag(tt.query, tt.tag); got != tt.want {
+				t.Fatalf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelfServicePolicy(t *testing.T) {
+	cfg := SelfServiceConfig{
+		Enabled:     true,
+		MatchOSUser: true,
+		Admins:      []string{"dba"},
+		Identities: []SelfServiceIdentity{
+			{OSUser: "alice", Users: []string{"alice_ro"}},
+			{Token: "redash-portal", Tags: []string{"redash user_id=42"}},
+		},
+	}
+	row := func(user, info string) Process {
+		return Process{
+			ID:   7,
+			User: sql.NullString{String: user, Valid: true},
+			Info: sql.NullString{String: info, Valid: info != ""},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		caller caller
+		row    Process
+		want   bool
+	}{
+		{name: "same name", caller: caller{osUser: "alice"}, row: row("alice", ""), want: true},
+		{name: "mapped user", caller: caller{osUser: "alice"}, row: row("alice_ro", ""), want: true},
+		{name: "other user", caller: caller{osUser: "alice"}, row: row("bob", ""), want: false},
+		{name: "token tag", caller: caller{token: "redash-portal"}, row: row("redash", "/* redash user_id=42 */ SELECT 1"), want: true},
+		{name: "token other tag", caller: caller{token: "redash-portal"}, row: row("redash", "/* redash user_id=43 */ SELECT 1"), want: false},
+		{name: "token ignores OS user identities", caller: caller{token: "alice"}, row: row("alice_ro", ""), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allow := selfServicePolicy(cfg, tt.caller)
+			if err := allow(tt.row); (err == nil) != tt.want {
+				t.Fatalf("got %v, want allowed=%v", err, tt.want)
+			}
+		})
+	}
+
+	if selfServicePolicy(cfg, caller{osUser: "dba"}) != nil {
+		t.Fatal("expected admins to be exempt")
+	}
+	if selfServicePolicy(SelfServiceConfig{}, caller{osUser: "alice"}) != nil {
+		t.Fatal("expected no policy when disabled")
+	}
+}
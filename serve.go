@@ -0,0 +1,531 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// apiTimeout bounds the database work of an API request.
+const apiTimeout = 30 * time.Second
+
+// defaultServeListen is the address serve listens on by default; the API is
+// meant to sit behind a TLS-terminating proxy.
+const defaultServeListen = "127.0.0.1:8080"
+
+// listQueryParams are the query parameters of GET /processlist.
+var listQueryParams = []string{
+	"profile", "match", "user", "host", "db", "command", "state", "min_time", "max_time",
+	"ignore_user", "ignore_info", "where", "trx", "in_trx", "trx_age", "group_by", "sort",
+	"columns", "limit", "full",
+}
+
+// runServe executes the serve command.
+func runServe(ctx context.Context, cli *CLI, cmd *ServeCmd) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	s, err := newAPIServer(ctx, cli, cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	addr := firstNonEmpty(cmd.Listen, cfg.Serve.Listen, defaultServeListen)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", addr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hs := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+		defer cancel()
+		_ = hs.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving on http://%s\n", ln.Addr())
+	if err := hs.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// apiServer serves the HTTP/JSON API.
+type apiServer struct {
+	tokens         []ServeToken
+	targets        map[string]*apiTarget
+	defaultProfile string
+}
+
+// apiTarget is the lazily opened connection of a profile, shared by requests.
+type apiTarget struct {
+	cfg AppConfig
+
+	mu sync.Mutex
+	c  *Client
+}
+
+// apiError is an API error with its HTTP status.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+func (e *apiError) Unwrap() error { return e.err }
+
+func apiErrorf(status int, format string, args ...any) error {
+	return &apiError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// killRequest is the body of POST /kill.
+type killRequest struct {
+	ID int64 `json:"id"`
+	// Mode is "query" or "connection".
+	Mode    string `json:"mode"`
+	DryRun  bool   `json:"dry_run"`
+	Profile string `json:"profile"`
+}
+
+// killResponse is the result of POST /kill.
+type killResponse struct {
+	ID      int64  `json:"id"`
+	SQL     string `json:"sql"`
+	DryRun  bool   `json:"dry_run"`
+	Outcome string `json:"outcome"`
+}
+
+// newAPIServer validates the tokens and resolves the served profiles: the
+// config serve runs with, under its profile name, and the [serve.profiles].
+func newAPIServer(ctx context.Context, cli *CLI, cfg AppConfig) (*apiServer, error) {
+	if len(cfg.Serve.Tokens) == 0 {
+		return nil, errors.New("serve requires at least one [[serve.tokens]] entry")
+	}
+	names := make(map[string]bool)
+	for _, t := range cfg.Serve.Tokens {
+		if t.Name == "" || t.Token == "" {
+			return nil, errors.New("every [[serve.tokens]] entry needs a name and a token")
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate serve token name %q", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	s := &apiServer{
+		tokens:         cfg.Serve.Tokens,
+		targets:        make(map[string]*apiTarget),
+		defaultProfile: firstNonEmpty(cfg.Profile, "default"),
+	}
+	cfg.Profile = s.defaultProfile
+	s.targets[s.defaultProfile] = &apiTarget{cfg: cfg}
+	for name, path := range cfg.Serve.Profiles {
+		if _, ok := s.targets[name]; ok {
+			return nil, fmt.Errorf("profile %s is already served", name)
+		}
+		pcfg, err := resolveConfig(ctx, &CLI{Config: path, Redact: cli.Redact, Verbose: cli.Verbose})
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		pcfg.Profile = name
+		s.targets[name] = &apiTarget{cfg: pcfg}
+	}
+	for name, t := range s.targets {
+		if t.cfg.Target == targetProxySQL {
+			return nil, fmt.Errorf("profile %s: serve is not supported with target proxysql", name)
+		}
+	}
+	return s, nil
+}
+
+// Close closes the profile connections.
+func (s *apiServer) Close() {
+	for _, t := range s.targets {
+		t.close()
+	}
+}
+
+// handler routes the API endpoints.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /processlist", s.handleProcessList)
+	mux.HandleFunc("POST /kill", s.handleKill)
+	return mux
+}
+
+// authenticate returns the token of the request's bearer credentials.
+func (s *apiServer) authenticate(r *http.Request) (ServeToken, bool) {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || got == "" {
+		return ServeToken{}, false
+	}
+	var match ServeToken
+	found := false
+	// Every token is compared, in constant time, so timing reveals nothing.
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(t.Token)) == 1 {
+			match, found = t, true
+		}
+	}
+	return match, found
+}
+
+// target returns the target of profile if tok may use it.
+func (s *apiServer) target(tok ServeToken, profile string) (*apiTarget, error) {
+	t, ok := s.targets[profile]
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, "unknown profile %q", profile)
+	}
+	if len(tok.Profiles) > 0 && !slices.Contains(tok.Profiles, profile) {
+		return nil, apiErrorf(http.StatusForbidden, "token %s may not use profile %q", tok.Name, profile)
+	}
+	return t, nil
+}
+
+// requestAuditor returns the auditor of a request against profile.
+func (s *apiServer) requestAuditor(profile string, tok ServeToken, r *http.Request) (*auditor, error) {
+	t, ok := s.targets[profile]
+	if !ok {
+		t = s.targets[s.defaultProfile]
+	}
+	au, err := newAuditor(t.cfg, "serve")
+	if err != nil {
+		return nil, err
+	}
+	au.setCaller(tok.Name, r.Method+" "+r.URL.Path)
+	return au, nil
+}
+
+// handleProcessList serves GET /processlist, the list command as JSON.
+func (s *apiServer) handleProcessList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	profile := firstNonEmpty(q.Get("profile"), s.defaultProfile)
+	tok, authed := s.authenticate(r)
+	au, err := s.requestAuditor(profile, tok, r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer au.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+	body, err := s.processList(ctx, au, tok, authed, profile, q)
+	if err != nil {
+		au.RecordRequest(auditRecord{Outcome: apiOutcome(err), Error: err.Error()})
+		writeAPIError(w, err)
+		return
+	}
+	au.RecordRequest(auditRecord{Outcome: auditOK})
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// processList returns the JSON processlist of a request.
+func (s *apiServer) processList(ctx context.Context, au *auditor, tok ServeToken, authed bool, profile string, q url.Values) ([]byte, error) {
+	if !authed {
+		return nil, apiErrorf(http.StatusUnauthorized, "missing or invalid token")
+	}
+	t, err := s.target(tok, profile)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := listCmdFromQuery(q)
+	if err != nil {
+		return nil, &apiError{status: http.StatusBadRequest, err: err}
+	}
+	if err := restrictUsers(cmd, tok); err != nil {
+		return nil, err
+	}
+	if err := cmd.validate(); err != nil {
+		return nil, &apiError{status: http.StatusBadRequest, err: err}
+	}
+	if _, _, err := cmd.filterConditions(processListSource{}); err != nil {
+		return nil, &apiError{status: http.StatusBadRequest, err: err}
+	}
+
+	c, err := t.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err := c.checkReader(ctx)
+	au.setServer(c.f.Name(), verdict)
+	if err != nil {
+		return nil, guardError(verdict, err)
+	}
+	privs, err := c.f.CheckPrivileges(ctx, c.db, ModeConnection)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := listProcess(ctx, &b, c.db, c.f, c.src, privs, t.cfg.Redaction, cmd); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// handleKill serves POST /kill through the same reader guard, privilege
+// check and audit as the kill command.
+func (s *apiServer) handleKill(w http.ResponseWriter, r *http.Request) {
+	tok, authed := s.authenticate(r)
+	var req killRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	decodeErr := dec.Decode(&req)
+
+	profile := firstNonEmpty(req.Profile, s.defaultProfile)
+	au, err := s.requestAuditor(profile, tok, r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer au.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+	resp, err := s.kill(ctx, au, tok, authed, profile, req, decodeErr)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// kill runs a kill request. Failures before the kill itself are recorded
+// here; killProcesses records the attempt.
+func (s *apiServer) kill(ctx context.Context, au *auditor, tok ServeToken, authed bool, profile string, req killRequest, decodeErr error) (killResponse, error) {
+	refuse := func(err error) (killResponse, error) {
+		au.Record(auditRecord{ProcessID: req.ID, DryRun: req.DryRun, Outcome: apiOutcome(err), Error: err.Error()}, Process{})
+		return killResponse{}, err
+	}
+
+	if !authed {
+		return refuse(apiErrorf(http.StatusUnauthorized, "missing or invalid token"))
+	}
+	if decodeErr != nil {
+		return refuse(apiErrorf(http.StatusBadRequest, "invalid request body: %v", decodeErr))
+	}
+	if req.ID <= 0 {
+		return refuse(apiErrorf(http.StatusBadRequest, "id is required"))
+	}
+	var mode Mode
+	switch req.Mode {
+	case "query":
+		mode = ModeQuery
+	case "connection":
+		mode = ModeConnection
+	default:
+		return refuse(apiErrorf(http.StatusBadRequest, `mode must be "query" or "connection"`))
+	}
+	t, err := s.target(tok, profile)
+	if err != nil {
+		return refuse(err)
+	}
+
+	c, err := t.conn(ctx)
+	if err != nil {
+		return refuse(err)
+	}
+	verdict, err := c.checkReader(ctx)
+	au.setServer(c.f.Name(), verdict)
+	if err != nil {
+		return refuse(guardError(verdict, err))
+	}
+
+	cmd := &KillCmd{Kill: mode == ModeConnection, KillQuery: mode == ModeQuery, DryRun: req.DryRun}
+	results, err := killProcesses(ctx, io.Discard, c, cmd, []int64{req.ID}, au,
+		allowAll(tokenPolicy(tok), selfServicePolicy(t.cfg.SelfService, caller{token: tok.Name})))
+	if err != nil {
+		return killResponse{}, err
+	}
+	resp := killResponse{ID: req.ID, SQL: results[0].SQL, DryRun: req.DryRun, Outcome: auditOK}
+	if req.DryRun {
+		resp.Outcome = auditDryRun
+	}
+	return resp, nil
+}
+
+// conn returns the profile's client, opening it, or reopening it when the
+// server or tunnel went away. ctx bounds the setup only; the client outlives
+// the request. Requests share it, so they only use its connection and
+// flavor, with their own auditor and policy.
+func (t *apiTarget) conn(ctx context.Context) (*Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.c != nil {
+		if err := t.c.db.PingContext(ctx); err == nil {
+			return t.c, nil
+		}
+		_ = t.c.Close()
+		t.c = nil
+	}
+
+	c, err := newClient(ctx, t.cfg, "serve")
+	if err != nil {
+		return nil, err
+	}
+	t.c = c
+	return c, nil
+}
+
+func (t *apiTarget) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.c != nil {
+		_ = t.c.Close()
+		t.c = nil
+	}
+}
+
+// listCmdFromQuery builds list filters from GET /processlist parameters,
+// named like the list flags with underscores.
+func listCmdFromQuery(q url.Values) (*ListCmd, error) {
+	for name := range q {
+		if !slices.Contains(listQueryParams, name) {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	cmd := &ListCmd{
+		Match:      q.Get("match"),
+		User:       q["user"],
+		Host:       q["host"],
+		DB:         q["db"],
+		Command:    q["command"],
+		State:      q["state"],
+		IgnoreUser: q["ignore_user"],
+		IgnoreInfo: q["ignore_info"],
+		Where:      q.Get("where"),
+		GroupBy:    q.Get("group_by"),
+		Sort:       q.Get("sort"),
+		Format:     "json",
+	}
+	if v := q.Get("columns"); v != "" {
+		cmd.Columns = strings.Split(v, ",")
+	}
+	for name, d := range map[string]*time.Duration{"min_time": &cmd.MinTime, "max_time": &cmd.MaxTime, "trx_age": &cmd.TrxAge} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*d = parsed
+		}
+	}
+	for name, b := range map[string]*bool{"trx": &cmd.Trx, "in_trx": &cmd.InTrx, "full": &cmd.Full} {
+		if v := q.Get(name); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*b = parsed
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %w", err)
+		}
+		cmd.Limit = n
+	}
+	return cmd, nil
+}
+
+// restrictUsers limits cmd to the MySQL users tok may see.
+func restrictUsers(cmd *ListCmd, tok ServeToken) error {
+	if len(tok.Users) == 0 {
+		return nil
+	}
+	if len(cmd.User) == 0 {
+		cmd.User = slices.Clone(tok.Users)
+		return nil
+	}
+	for _, u := range cmd.User {
+		if !slices.Contains(tok.Users, u) {
+			return apiErrorf(http.StatusForbidden, "token %s may not list sessions of %q", tok.Name, u)
+		}
+	}
+	return nil
+}
+
+// tokenPolicy returns the victim check of tok, or nil when it may kill the
+// sessions of any user.
+func tokenPolicy(tok ServeToken) func(Process) error {
+	if len(tok.Users) == 0 {
+		return nil
+	}
+	return func(r Process) error {
+		if user := nullString(r.User); !slices.Contains(tok.Users, user) {
+			return fmt.Errorf("token %s may not kill process %d owned by %q", tok.Name, r.ID, user)
+		}
+		return nil
+	}
+}
+
+// guardError classifies a reader guard failure: a detected writer is a
+// refusal, anything else a server error.
+func guardError(verdict roleVerdict, err error) error {
+	if verdict.Reason != "" && !verdict.Reader {
+		return &apiError{status: http.StatusForbidden, err: err}
+	}
+	return err
+}
+
+// apiStatus returns the HTTP status of err.
+func apiStatus(err error) int {
+	var ae *apiError
+	var refused refusedError
+	switch {
+	case errors.As(err, &ae):
+		return ae.status
+	case errors.As(err, &refused):
+		return http.StatusForbidden
+	case errors.Is(err, errProcessNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// apiOutcome returns the audit outcome of a failed request.
+func apiOutcome(err error) string {
+	switch apiStatus(err) {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusBadRequest:
+		return auditRefused
+	default:
+		return auditError
+	}
+}
+
+// writeAPIError writes err as {"error": "..."} with its status.
+func writeAPIError(w http.ResponseWriter, err error) {
+	writeJSON(w, apiStatus(err), map[string]string{"error": err.Error()})
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,214 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAPIServer returns an API server with two profiles and the path of
+// their audit log. Requests that reach the database fail, so the tests stop
+// short of it.
+func newTestAPIServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := AuditConfig{Enabled: true, File: path}
+	s := &apiServer{
+		tokens: []ServeToken{
+			{Name: "oncall", Token: "secret-oncall"},
+			{Name: "redash", Token: "secret-redash", Users: []string{"redash"}, Profiles: []string{"prod"}},
+		},
+		targets: map[string]*apiTarget{
+			"prod":    {cfg: AppConfig{Profile: "prod", Audit: audit}},
+			"staging": {cfg: AppConfig{Profile: "staging", Audit: audit}},
+		},
+		defaultProfile: "prod",
+	}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return ts, path
+}
+
+func doAPI(t *testing.T, method, url, token, body string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var got map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	return resp.StatusCode, got
+}
+
+func TestServeErrors(t *testing.T) {
+	ts, path := newTestAPIServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{name: "list without token", method: "GET", path: "/processlist", status: http.StatusUnauthorized},
+		{name: "list with wrong token", method: "GET", path: "/processlist", token: "nope", status: http.StatusUnauthorized},
+		{name: "kill without token", method: "POST", path: "/kill", body: `{"id":1,"mode":"query"}`, status: http.StatusUnauthorized},
+		{name: "unknown profile", method: "GET", path: "/processlist?profile=dev", token: "secret-oncall", status: http.StatusNotFound},
+		{name: "profile not allowed", method: "GET", path: "/processlist?profile=staging", token: "secret-redash", status: http.StatusForbidden},
+		{name: "user not allowed", method: "GET", path: "/processlist?user=app", token: "secret-redash", status: http.StatusForbidden},
+		{name: "unknown parameter", method: "GET", path: "/processlist?min-time=1s", token: "secret-oncall", status: http.StatusBadRequest},
+		{name: "invalid duration", method: "GET", path: "/processlist?min_time=soon", token: "secret-oncall", status: http.StatusBadRequest},
+		{name: "invalid filter", method: "GET", path: "/processlist?where=time%3E%3E1", token: "secret-oncall", status: http.StatusBadRequest},
+		{name: "kill without mode", method: "POST", path: "/kill", token: "secret-oncall", body: `{"id":1}`, status: http.StatusBadRequest},
+		{name: "kill without id", method: "POST", path: "/kill", token: "secret-oncall", body: `{"mode":"query"}`, status: http.StatusBadRequest},
+		{name: "kill unknown field", method: "POST", path: "/kill", token: "secret-oncall", body: `{"id":1,"mode":"query","force":true}`, status: http.StatusBadRequest},
+		{name: "kill profile not allowed", method: "POST", path: "/kill", token: "secret-redash", body: `{"id":1,"mode":"query","profile":"staging"}`, status: http.StatusForbidden},
+		{name: "wrong method", method: "GET", path: "/kill", token: "secret-oncall", status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doAPI(t, tt.method, ts.URL+tt.path, tt.token, tt.body)
+			if status != tt.status {
+				t.Fatalf("status: got %d want %d (%v)", status, tt.status, body)
+			}
+			if status != http.StatusMethodNotAllowed && body["error"] == "" {
+				t.Fatalf("missing error: %v", body)
+			}
+		})
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	records, err := readAuditLog(f)
+	if err != nil {
+		t.Fatalf("readAuditLog: %v", err)
+	}
+	// Every request but the unrouted one is audited.
+	if len(records) != len(tests)-1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	if got := records[0]; got.Command != "serve" || got.Request != "GET /processlist" || got.Outcome != auditRefused {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if got := records[5]; got.Caller != "redash" || got.Profile != "prod" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if got := records[12]; got.Caller != "redash" || got.Profile != "staging" || got.ProcessID != 1 || got.Outcome != auditRefused {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+}
+
+func TestListCmdFromQuery(t *testing.T) {
+	q, err := url.ParseQuery("user=app&user=batch&min_time=30s&trx=true&columns=id,user,time&limit=5&sort=-time&match=SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := listCmdFromQuery(q)
+	if err != nil {
+		t.Fatalf("listCmdFromQuery: %v", err)
+	}
+	if !slices.Equal(cmd.User, []string{"app", "batch"}) || cmd.MinTime != 30*time.Second || !cmd.Trx ||
+		!slices.Equal(cmd.Columns, []string{"id", "user", "time"}) || cmd.Limit != 5 || cmd.Sort != "-time" ||
+		cmd.Match != "SELECT" || cmd.Format != "json" {
+		t.Fatalf("unexpected cmd: %+v", cmd)
+	}
+
+	for _, raw := range []string{"trx=maybe", "limit=ten", "kill=1"} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := listCmdFromQuery(q); err == nil {
+			t.Fatalf("%s: expected error", raw)
+		}
+	}
+}
+
+func TestRestrictUsers(t *testing.T) {
+	tok := ServeToken{Name: "redash", Users: []string{"redash", "redash_ro"}}
+	tests := []struct {
+		name    string
+		users   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filter", want: []string{"redash", "redash_ro"}},
+		{name: "allowed", users: []string{"redash_ro"}, want: []string{"redash_ro"}},
+		{name: "not allowed", users: []string{"redash", "app"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &ListCmd{User: tt.users}
+			err := restrictUsers(cmd, tok)
+			if tt.wantErr {
+				if apiStatus(err) != http.StatusForbidden {
+					t.Fatalf("expected 403, got %v", err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(cmd.User, tt.want) {
+				t.Fatalf("got %v, %v", cmd.User, err)
+			}
+		})
+	}
+
+	cmd := &ListCmd{User: []string{"app"}}
+	if err := restrictUsers(cmd, ServeToken{Name: "oncall"}); err != nil || !slices.Equal(cmd.User, []string{"app"}) {
+		t.Fatalf("unrestricted token: %v, %v", cmd.User, err)
+	}
+}
+
+func TestTokenPolicy(t *testing.T) {
+	if tokenPolicy(ServeToken{Name: "oncall"}) != nil {
+		t.Fatal("expected no policy for an unrestricted token")
+	}
+	allow := tokenPolicy(ServeToken{Name: "redash", Users: []string{"redash"}})
+	if err := allow(Process{ID: 1, User: sql.NullString{String: "redash", Valid: true}}); err != nil {
+		t.Fatalf("allowed user: %v", err)
+	}
+	if err := allow(Process{ID: 2, User: sql.NullString{String: "app", Valid: true}}); err == nil {
+		t.Fatal("expected refusal")
+	}
+}
+
+func TestNewAPIServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []ServeToken
+	}{
+		{name: "no tokens"},
+		{name: "empty token", tokens: []ServeToken{{Name: "a"}}},
+		{name: "duplicate name", tokens: []ServeToken{{Name: "a", Token: "x"}, {Name: "a", Token: "y"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AppConfig{Serve: ServeConfig{Tokens: tt.tokens}}
+			if _, err := newAPIServer(context.Background(), &CLI{}, cfg); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	cfg := AppConfig{Target: targetProxySQL, Serve: ServeConfig{Tokens: []ServeToken{{Name: "a", Token: "x"}}}}
+	if _, err := newAPIServer(context.Background(), &CLI{}, cfg); err == nil {
+		t.Fatal("expected error for proxysql")
+	}
+}
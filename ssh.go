@@ -19,13 +19,18 @@ import (
 type sshTunnel struct {
 	LocalHost string
 	LocalPort int
+	// SSHAddr is the bastion the tunnel goes through.
+	SSHAddr string
+	// TargetAddr is the remote host:port connections are forwarded to.
+	TargetAddr string
 
 	listener net.Listener
 	client   *ssh.Client
 	once     sync.Once
 }
 
-// startSSHTunnel opens an SSH tunnel to the target host:port.
+// startSSHTunnel opens an SSH tunnel to the target host:port. ctx bounds
+// the SSH dial only: the tunnel serves until Close.
 func startSSHTunnel(ctx context.Context, cfg SSHConfig, targetHost string, targetPort int) (*sshTunnel, error) {
 	if targetHost == "" || targetPort == 0 {
 		return nil, errors.New("db host/port required for ssh tunneling")
@@ -56,30 +61,38 @@ func startSSHTunnel(ctx context.Context, cfg SSHConfig, targetHost string, targe
 	}
 
 	tunnel := &sshTunnel{
-		LocalHost: host,
-		LocalPort: port,
-		listener:  listener,
-		client:    client,
+		LocalHost:  host,
+		LocalPort:  port,
+		SSHAddr:    cfg.User + "@" + net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		TargetAddr: net.JoinHostPort(targetHost, strconv.Itoa(targetPort)),
+		listener:   listener,
+		client:     client,
 	}
 
-	go tunnel.acceptLoop(ctx, fmt.Sprintf("%s:%d", targetHost, targetPort))
+	go tunnel.acceptLoop(tunnel.TargetAddr)
 
 	return tunnel, nil
 }
 
+// String describes the tunnel path.
+func (t *sshTunnel) String() string {
+	local := net.JoinHostPort(t.LocalHost, strconv.Itoa(t.LocalPort))
+	return fmt.Sprintf("%s -> ssh %s -> %s", local, t.SSHAddr, t.TargetAddr)
+}
+
 // acceptLoop accepts local connections and forwards them.
-func (t *sshTunnel) acceptLoop(ctx context.Context, targetAddr string) {
+func (t *sshTunnel) acceptLoop(targetAddr string) {
 	for {
 		conn, err := t.listener.Accept()
 		if err != nil {
 			return
 		}
-		go t.forwardConn(ctx, conn, targetAddr)
+		go t.forwardConn(conn, targetAddr)
 	}
 }
 
 // forwardConn forwards a single connection through SSH.
-func (t *sshTunnel) forwardConn(ctx context.Context, localConn net.Conn, targetAddr string) {
+func (t *sshTunnel) forwardConn(localConn net.Conn, targetAddr string) {
 	remoteConn, err := t.client.Dial("tcp", targetAddr)
 	if err != nil {
 		_ = localConn.Close()
@@ -178,9 +191,15 @@ func dialSSH(ctx context.Context, cfg SSHConfig) (*ssh.Client, error) {
 
 	select {
 	case <-ctx.Done():
-		if agentConn != nil {
-			_ = agentConn.Close()
-		}
+		// Close the client of a dial that completes after all.
+		go func() {
+			if res := <-ch; res.client != nil {
+				_ = res.client.Close()
+			}
+			if agentConn != nil {
+				_ = agentConn.Close()
+			}
+		}()
 		return nil, ctx.Err()
 	case res := <-ch:
 		if agentConn != nil {
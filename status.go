@@ -0,0 +1,169 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"text/tabwriter"
+)
+
+// statusReport describes the resolved target and the session on it.
+type statusReport struct {
+	Target         string
+	Tunnel         string
+	Version        string
+	VersionComment string
+	Flavor         string
+	ProcessList    string
+	Role           roleVerdict
+	Hostname       string
+	ServerID       string
+	ConnectionID   int64
+	CurrentUser    string
+	User           string
+	KillPrivileges killPrivileges
+	Grants         []string
+}
+
+// runStatus executes the status command.
+func runStatus(ctx context.Context, cli *CLI) error {
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	db, tunnel, err := connectTarget(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer closeTarget(db, tunnel)
+
+	report := statusReport{Target: cfg.Target, Tunnel: "direct"}
+	if tunnel != nil {
+		report.Tunnel = tunnel.String()
+	}
+
+	if cfg.Target == targetProxySQL {
+		if err := db.QueryRowContext(ctx, "SELECT variable_value FROM global_variables WHERE variable_name = 'admin-version'").Scan(&report.Version); err != nil {
+			return fmt.Errorf("query proxysql version: %w", err)
+		}
+		return writeStatus(os.Stdout, report)
+	}
+
+	if err := collectStatus(ctx, db, cfg, &report); err != nil {
+		return err
+	}
+	return writeStatus(os.Stdout, report)
+}
+
+// collectStatus fills report with server and session details.
+func collectStatus(ctx context.Context, db *sql.DB, cfg AppConfig, report *statusReport) error {
+	var hostname, serverID sql.NullString
+	const query = `SELECT @@version, @@version_comment, @@hostname, @@server_id, CONNECTION_ID(), CURRENT_USER(), USER()`
+	if err := db.QueryRowContext(ctx, query).Scan(
+		&report.Version, &report.VersionComment, &hostname, &serverID,
+		&report.ConnectionID, &report.CurrentUser, &report.User,
+	); err != nil {
+		return fmt.Errorf("query server status: %w", err)
+	}
+	report.Hostname = nullString(hostname)
+	report.ServerID = nullString(serverID)
+
+	f, err := detectFlavor(ctx, db, cfg.Flavor)
+	if err != nil {
+		return err
+	}
+	report.Flavor = f.Name()
+
+	src, err := f.ProcessListSource(ctx, db, cfg.ProcessListSource)
+	if err != nil {
+		return err
+	}
+	report.ProcessList = src.String()
+
+	report.Role, err = f.DetectReader(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	report.KillPrivileges, err = f.CheckPrivileges(ctx, db, ModeConnection)
+	if err != nil {
+		return err
+	}
+
+	grants, err := showGrants(ctx, db)
+	if err != nil {
+		return err
+	}
+	report.Grants = killRelevantGrants(grants)
+
+	return nil
+}
+
+// writeStatus prints a status report.
+func writeStatus(w io.Writer, r statusReport) error {
+	// Write errors are sticky in tabwriter and reported by Flush.
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	line := func(key, value string) {
+		if value != "" {
+			_, _ = fmt.Fprintf(tw, "%s:\t%s\n", key, value)
+		}
+	}
+
+	line("target", r.Target)
+	line("tunnel", r.Tunnel)
+	version := r.Version
+	if r.VersionComment != "" {
+		version += " (" + r.VersionComment + ")"
+	}
+	line("version", version)
+	line("flavor", r.Flavor)
+	line("processlist", r.ProcessList)
+	if r.Role.Reason != "" {
+		line("role", r.Role.String())
+	}
+	line("hostname", r.Hostname)
+	line("server_id", r.ServerID)
+	if r.ConnectionID != 0 {
+		line("connection_id", fmt.Sprint(r.ConnectionID))
+	}
+	line("user", r.User)
+	line("current_user", r.CurrentUser)
+	if r.Flavor != "" {
+		if r.KillPrivileges.Any {
+			line("kill", "any session (via "+r.KillPrivileges.Grant+")")
+		} else {
+			line("kill", "own sessions only (needs "+r.KillPrivileges.Required+" for others)")
+		}
+	}
+	for i, g := range r.Grants {
+		key := ""
+		if i == 0 {
+			key = "grants:"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", key, g)
+	}
+
+	return tw.Flush()
+}
+
+var killGrantPattern = regexp.MustCompile(`(?i)\b(ALL|SUPER|CONNECTION_ADMIN|CONNECTION ADMIN|PROCESS|EXECUTE)\b`)
+
+// killRelevantGrants filters grants to those that affect listing or killing
+// other sessions.
+func killRelevantGrants(grants []string) []string {
+	var relevant []string
+	for _, g := range grants {
+		m := grantPattern.FindStringSubmatch(g)
+		if m == nil {
+			continue
+		}
+		if killGrantPattern.MatchString(m[1]) {
+			relevant = append(relevant, g)
+		}
+	}
+	return relevant
+}
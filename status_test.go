@@ -0,0 +1,86 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+func TestWriteStatus(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeStatus(&buf, statusReport{
+		Target:         targetMySQL,
+		Tunnel:         "direct",
+		Version:        "8.0.36",
+		VersionComment: "Source distribution",
+		Flavor:         "aurora",
+		Role: roleVerdict{
+			Reader: true,
+			Reason: "aurora replica",
+			Values: []roleValue{{Name: "aurora_session_id", Value: "abc"}},
+		},
+		Hostname:     "ip-10-0-0-1",
+		ServerID:     "1234",
+		ConnectionID: 42,
+		User:         "ops@10.0.0.5",
+		CurrentUser:  "ops@%",
+		KillPrivileges: killPrivileges{
+			User:     "ops",
+			Required: "EXECUTE on mysql.rds_kill",
+		},
+		Grants: []string{"GRANT PROCESS ON *.* TO `ops`@`%`"},
+	})
+	if err != nil {
+		t.Fatalf("writeStatus: %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"version:        8.0.36 (Source distribution)",
+		"flavor:         aurora",
+		"role:           reader (aurora replica) [aurora_session_id=abc]",
+		"connection_id:  42",
+		"kill:           own sessions only (needs EXECUTE on mysql.rds_kill for others)",
+		"grants:         GRANT PROCESS ON *.* TO `ops`@`%`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestKillRelevantGrants(t *testing.T) {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `ops`@`%`",
+		"GRANT SELECT, PROCESS ON *.* TO `ops`@`%`",
+		"GRANT SELECT ON `app`.* TO `ops`@`%`",
+		"GRANT EXECUTE ON PROCEDURE `mysql`.`rds_kill` TO `ops`@`%`",
+		"GRANT `reader`@`%` TO `ops`@`%`",
+	}
+	got := killRelevantGrants(grants)
+	want := []string{
+		"GRANT SELECT, PROCESS ON *.* TO `ops`@`%`",
+		"GRANT EXECUTE ON PROCEDURE `mysql`.`rds_kill` TO `ops`@`%`",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v want %#v", got, want)
+	}
+}
+
+func TestStatusAlias(t *testing.T) {
+	var cli CLI
+	parser, err := kong.New(&cli)
+	if err != nil {
+		t.Fatalf("kong.New: %v", err)
+	}
+	kctx, err := parser.Parse([]string{"whoami"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if kctx.Command() != "status" {
+		t.Fatalf("got %q want %q", kctx.Command(), "status")
+	}
+}
@@ -0,0 +1,873 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/kong"
+	"golang.org/x/term"
+)
+
+// topAction tells the event loop what to do after a key press.
+type topAction int
+
+const (
+	topNone topAction = iota
+	topQuit
+	topRefresh
+	topKill
+	topDetail
+	// topFilter refreshes with a new filter, restoring the previous one
+	// when the server rejects it.
+	topFilter
+)
+
+// topView is the screen the top UI is showing.
+type topView int
+
+const (
+	viewList topView = iota
+	viewFilter
+	viewConfirm
+	viewDetail
+)
+
+// topMaxColumnWidth caps every column but the last one.
+const topMaxColumnWidth = 40
+
+// topHelp is the key help shown in the footer of the list view.
+const topHelp = "↑↓ move  space select  enter details  / filter  t in-trx  < > sort  r reverse  k kill query  K kill  q quit"
+
+// topFilterPrompt is the prompt of the filter view.
+const topFilterPrompt = "filter (list flags, or a regex on INFO): "
+
+// runTop executes the top command.
+func runTop(ctx context.Context, cli *CLI, cmd *TopCmd) error {
+	if cmd.GroupBy != "" {
+		return errors.New("--group-by is not supported by top")
+	}
+	if cmd.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return errors.New("top is not supported with target proxysql")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("top requires an interactive terminal")
+	}
+
+	c, err := newClient(ctx, cfg, "top")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if _, err := c.checkReader(ctx); err != nil {
+		return err
+	}
+
+	au, err := c.auditor()
+	if err != nil {
+		return err
+	}
+	au.holdWarns()
+
+	privs, err := c.f.CheckPrivileges(ctx, c.db, ModeConnection)
+	if err != nil {
+		return err
+	}
+
+	// Nothing may write to stderr while the screen is in raw mode.
+	c.cfg.Verbose = false
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("terminal raw mode: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	out := os.Stdout
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	m := newTopModel(c.src, privs, cmd.ListCmd)
+	m.title = fmt.Sprintf("mysql-kill top  flavor=%s  processlist=%s  every %s", c.f.Name(), c.src, cmd.Interval)
+
+	// The detail view explains the unredacted statement.
+	raw := make(map[int64]Process)
+	refresh := func() error {
+		rows, err := fetchProcessList(ctx, c.db, c.f, c.src, &m.filter)
+		if err != nil {
+			return err
+		}
+		clear(raw)
+		for _, r := range rows {
+			raw[r.ID] = r
+		}
+		m.setRows(cfg.Redaction.Rows(rows), time.Now())
+		return nil
+	}
+	show := func(err error) {
+		if err != nil {
+			m.message = err.Error()
+		}
+	}
+
+	keys := readKeys(os.Stdin)
+	ticker := time.NewTicker(cmd.Interval)
+	defer ticker.Stop()
+
+	show(refresh())
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			width, height = 120, 40
+		}
+		if err := m.draw(out, width, height); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			show(refresh())
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch m.handleKey(key) {
+			case topQuit:
+				return nil
+			case topRefresh:
+				show(refresh())
+			case topFilter:
+				if err := refresh(); err != nil {
+					m.rejectFilter(err)
+				}
+			case topKill:
+				m.message = killFromTop(ctx, c, m.targets(), m.killMode, au)
+				m.selected = make(map[int64]bool)
+				show(refresh())
+			case topDetail:
+				if r, ok := m.current(); ok {
+					m.detail = sessionDetail(ctx, c.db, raw[r.ID], cfg.Redaction)
+				}
+			}
+		}
+	}
+}
+
+// killFromTop kills ids through the same reader guard and flavor logic as
+// the kill command, recording them to au, and returns a one-line result for
+// the footer.
+func killFromTop(ctx context.Context, c *Client, ids []int64, mode Mode, au *auditor) string {
+	if len(ids) == 0 {
+		return "nothing to kill"
+	}
+	verdict, err := c.checkReader(ctx)
+	au.setServer(c.f.Name(), verdict)
+	if err != nil {
+		au.Record(auditRecord{Outcome: auditRefused, Error: err.Error()}, Process{})
+		return err.Error()
+	}
+	cmd := &KillCmd{Kill: mode == ModeConnection, KillQuery: mode == ModeQuery}
+	var buf bytes.Buffer
+	if _, err := killProcesses(ctx, &buf, c, cmd, ids, au, c.allow); err != nil {
+		return err.Error()
+	}
+	return strings.ReplaceAll(strings.TrimSpace(buf.String()), "\n", "; ")
+}
+
+// sessionDetail returns the lines of the detail view of r: its full INFO and
+// the plan of its running statement, redacted by red.
+func sessionDetail(ctx context.Context, db *sql.DB, r Process, red redactor) []string {
+	res, explainErr := explainSession(ctx, db, r, explainFormatJSON)
+	r = red.Row(r)
+
+	lines := []string{
+		fmt.Sprintf("ID %d  USER %s  HOST %s  DB %s  COMMAND %s  TIME %s  STATE %s",
+			r.ID, nullString(r.User), nullString(r.Host), nullString(r.DB),
+			nullString(r.Command), nullInt(r.Time), nullString(r.State)),
+		"",
+		"INFO:",
+	}
+	info := nullString(r.Info)
+	if info == "" {
+		return append(lines, "  (no running statement)")
+	}
+	for _, l := range strings.Split(info, "\n") {
+		lines = append(lines, "  "+l)
+	}
+
+	lines = append(lines, "", "EXPLAIN:")
+	if explainErr != nil {
+		return append(lines, "  unavailable: "+red.Plan(explainErr.Error()))
+	}
+	var buf bytes.Buffer
+	if err := writePlan(&buf, red.Explain(res), false); err != nil {
+		return append(lines, "  unavailable: "+err.Error())
+	}
+	for _, l := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		lines = append(lines, "  "+l)
+	}
+	return lines
+}
+
+// topModel is the state of the top UI, independent of the terminal.
+type topModel struct {
+	src      processListSource
+	privs    killPrivileges
+	filter   ListCmd
+	cols     []listColumn
+	rows     []Process
+	sortCol  string
+	sortAsc  bool
+	cursor   int
+	offset   int
+	pageSize int
+	selected map[int64]bool
+	view     topView
+	input    string
+	killMode Mode
+	detail   []string
+	// detailOffset is the first visible line of the detail view.
+	detailOffset int
+	message      string
+	title        string
+	refreshed    time.Time
+	// prevFilter is the filter in use before the last one entered.
+	prevFilter ListCmd
+}
+
+// newTopModel returns a model sorted by TIME, longest first.
+func newTopModel(src processListSource, privs killPrivileges, filter ListCmd) *topModel {
+	m := &topModel{
+		src:      src,
+		privs:    privs,
+		filter:   filter,
+		sortCol:  "TIME",
+		pageSize: 1,
+		selected: make(map[int64]bool),
+	}
+	if col, desc, ok := filter.sortColumn(); ok {
+		m.sortCol, m.sortAsc = col.Name, !desc
+	}
+	m.setColumns()
+	return m
+}
+
+// setColumns resolves the columns for the current filter. runTop has
+// validated --columns, so an error cannot occur.
+func (m *topModel) setColumns() {
+	cols, err := listColumns(&m.filter, m.src, m.privs)
+	if err != nil {
+		cols, _ = listColumns(&ListCmd{InTrx: m.filter.InTrx}, m.src, m.privs)
+	}
+	m.cols = cols
+	if _, ok := m.column(m.sortCol); !ok {
+		m.sortCol = "TIME"
+	}
+}
+
+// setRows replaces the rows, keeping the cursor on the same session and
+// dropping selections of sessions that are gone.
+func (m *topModel) setRows(rows []Process, now time.Time) {
+	var currentID int64 = -1
+	if r, ok := m.current(); ok {
+		currentID = r.ID
+	}
+
+	m.rows = rows
+	m.refreshed = now
+	m.sortRows()
+
+	present := make(map[int64]bool, len(rows))
+	for i, r := range m.rows {
+		present[r.ID] = true
+		if r.ID == currentID {
+			m.cursor = i
+		}
+	}
+	for id := range m.selected {
+		if !present[id] {
+			delete(m.selected, id)
+		}
+	}
+	m.clampCursor()
+}
+
+// sortRows orders rows by the sort column, numerically when possible.
+func (m *topModel) sortRows() {
+	col, ok := m.column(m.sortCol)
+	if !ok {
+		return
+	}
+	slices.SortStableFunc(m.rows, func(a, b Process) int {
+		c := compareValues(col.Value(a), col.Value(b))
+		if !m.sortAsc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+}
+
+// column returns the column named name.
+func (m *topModel) column(name string) (listColumn, bool) {
+	for _, c := range m.cols {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return listColumn{}, false
+}
+
+// current returns the row under the cursor.
+func (m *topModel) current() (Process, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return Process{}, false
+	}
+	return m.rows[m.cursor], true
+}
+
+// targets returns the selected sessions among the rows shown, or the one
+// under the cursor.
+func (m *topModel) targets() []int64 {
+	if len(m.selected) > 0 {
+		var ids []int64
+		for _, r := range m.rows {
+			if m.selected[r.ID] {
+				ids = append(ids, r.ID)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if r, ok := m.current(); ok {
+		return []int64{r.ID}
+	}
+	return nil
+}
+
+// clampCursor keeps the cursor on a row.
+func (m *topModel) clampCursor() {
+	m.cursor = max(0, min(m.cursor, len(m.rows)-1))
+}
+
+// moveSort selects the next or previous column as the sort column.
+func (m *topModel) moveSort(delta int) {
+	i := slices.IndexFunc(m.cols, func(c listColumn) bool { return c.Name == m.sortCol })
+	i = (i + delta + len(m.cols)) % len(m.cols)
+	m.sortCol = m.cols[i].Name
+	m.sortRows()
+}
+
+// handleKey applies a key press and returns the resulting action.
+func (m *topModel) handleKey(key string) topAction {
+	if key == "ctrl-c" {
+		return topQuit
+	}
+	switch m.view {
+	case viewFilter:
+		return m.handleFilterKey(key)
+	case viewConfirm:
+		m.view = viewList
+		if key == "y" || key == "Y" {
+			return topKill
+		}
+		m.message = "kill cancelled"
+		return topNone
+	case viewDetail:
+		switch key {
+		case "up":
+			m.detailOffset = max(0, m.detailOffset-1)
+		case "down":
+			m.detailOffset = min(max(0, len(m.detail)-1), m.detailOffset+1)
+		case "esc", "q", "enter":
+			m.view = viewList
+			m.detail = nil
+		}
+		return topNone
+	}
+
+	m.message = ""
+	switch key {
+	case "q":
+		return topQuit
+	case "up":
+		m.cursor--
+	case "down":
+		m.cursor++
+	case "pgup":
+		m.cursor -= m.pageSize
+	case "pgdn":
+		m.cursor += m.pageSize
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case " ":
+		if r, ok := m.current(); ok {
+			if m.selected[r.ID] {
+				delete(m.selected, r.ID)
+			} else {
+				m.selected[r.ID] = true
+			}
+			m.cursor++
+		}
+	case "esc":
+		m.selected = make(map[int64]bool)
+	case "enter":
+		if _, ok := m.current(); ok {
+			m.view = viewDetail
+			m.detailOffset = 0
+			return topDetail
+		}
+	case "/":
+		m.view = viewFilter
+		m.input = formatTopFilter(m.filter)
+	case "t":
+		m.filter.InTrx = !m.filter.InTrx
+		m.setColumns()
+		return topRefresh
+	case "<":
+		m.moveSort(-1)
+	case ">":
+		m.moveSort(1)
+	case "r":
+		m.sortAsc = !m.sortAsc
+		m.sortRows()
+	case "k", "K":
+		if len(m.targets()) == 0 {
+			return topNone
+		}
+		m.killMode = ModeQuery
+		if key == "K" {
+			m.killMode = ModeConnection
+		}
+		m.view = viewConfirm
+	}
+	m.clampCursor()
+	return topNone
+}
+
+// handleFilterKey edits the filter. The server checks the regular
+// expressions when the filter is applied.
+func (m *topModel) handleFilterKey(key string) topAction {
+	switch key {
+	case "esc":
+		m.view = viewList
+		m.message = ""
+	case "enter":
+		filter, err := parseTopFilter(m.input, m.filter)
+		if err != nil {
+			m.message = err.Error()
+			return topNone
+		}
+		m.view = viewList
+		m.message = ""
+		m.prevFilter, m.filter = m.filter, filter
+		m.setColumns()
+		return topFilter
+	case "backspace":
+		if _, size := utf8.DecodeLastRuneInString(m.input); size > 0 {
+			m.input = m.input[:len(m.input)-size]
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			m.input += key
+		}
+	}
+	return topNone
+}
+
+// rejectFilter restores the previous filter after the new one failed with
+// err, and reopens the prompt to fix it.
+func (m *topModel) rejectFilter(err error) {
+	m.filter = m.prevFilter
+	m.setColumns()
+	m.view = viewFilter
+	m.message = err.Error()
+}
+
+// draw renders the current view to w for a width x height terminal.
+func (m *topModel) draw(w io.Writer, width, height int) error {
+	lines := []string{m.title}
+	if m.view == viewDetail {
+		lines = append(lines, "esc back  ↑↓ scroll", "")
+		end := min(len(m.detail), m.detailOffset+max(1, height-len(lines)))
+		for _, l := range m.detail[min(m.detailOffset, end):end] {
+			lines = append(lines, strings.ReplaceAll(l, "\t", "    "))
+		}
+		return writeScreen(w, lines, width)
+	}
+
+	lines = append(lines, m.statusLine())
+
+	m.pageSize = max(1, height-4)
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+m.pageSize {
+		m.offset = m.cursor - m.pageSize + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.rows)-m.pageSize))
+	visible := m.rows[m.offset:min(len(m.rows), m.offset+m.pageSize)]
+
+	names := make([]string, len(m.cols))
+	for i, c := range m.cols {
+		names[i] = c.Name
+		if c.Name == m.sortCol && m.sortAsc {
+			names[i] += "↑"
+		} else if c.Name == m.sortCol {
+			names[i] += "↓"
+		}
+	}
+
+	cells := make([][]string, len(visible))
+	widths := make([]int, len(m.cols))
+	for i, name := range names {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for ri, r := range visible {
+		cells[ri] = make([]string, len(m.cols))
+		for i, c := range m.cols {
+			v := flattenSpace(c.Value(r))
+			cells[ri][i] = v
+			widths[i] = max(widths[i], min(utf8.RuneCountInString(v), topMaxColumnWidth))
+		}
+	}
+
+	lines = append(lines, "\x1b[1m"+fitWidth("  "+joinCells(names, widths), width)+"\x1b[0m")
+
+	for ri, r := range visible {
+		mark := "  "
+		if m.selected[r.ID] {
+			mark = "* "
+		}
+		line := fitWidth(mark+joinCells(cells[ri], widths), width)
+		if m.offset+ri == m.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.footer())
+	return writeScreen(w, lines, width)
+}
+
+// statusLine describes the filter, sort order and selection.
+func (m *topModel) statusLine() string {
+	parts := []string{fmt.Sprintf("%d sessions", len(m.rows))}
+	if !m.refreshed.IsZero() {
+		parts = append(parts, "refreshed "+m.refreshed.Format("15:04:05"))
+	}
+	if f := formatTopFilter(m.filter); f != "" {
+		parts = append(parts, "filter: "+f)
+	}
+	order := "desc"
+	if m.sortAsc {
+		order = "asc"
+	}
+	parts = append(parts, fmt.Sprintf("sort=%s %s", m.sortCol, order))
+	if len(m.selected) > 0 {
+		parts = append(parts, fmt.Sprintf("selected=%d", len(m.selected)))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// footer returns the prompt or message shown on the last line.
+func (m *topModel) footer() string {
+	switch m.view {
+	case viewFilter:
+		footer := topFilterPrompt + m.input + "_"
+		if m.message != "" {
+			footer += "  " + m.message
+		}
+		return footer
+	case viewConfirm:
+		verb := "KILL"
+		if m.killMode == ModeQuery {
+			verb = "KILL QUERY"
+		}
+		return fmt.Sprintf("%s %s? [y/N]", verb, formatIDs(m.targets()))
+	}
+	if m.message != "" {
+		return m.message
+	}
+	return topHelp
+}
+
+// parseTopFilter returns base with its filters replaced by those of input:
+// list filter flags, or a regex on INFO as with --match when input does not
+// start with a dash.
+func parseTopFilter(input string, base ListCmd) (ListCmd, error) {
+	input = strings.TrimSpace(input)
+	var flags ListCmd
+	if input != "" && !strings.HasPrefix(input, "-") {
+		flags.Match = input
+	} else {
+		args, err := splitFilterArgs(input)
+		if err != nil {
+			return base, err
+		}
+		parser, err := kong.New(&flags, kong.Name("filter"), kong.NoDefaultHelp(),
+			kong.Exit(func(int) {}), kong.Writers(io.Discard, io.Discard))
+		if err != nil {
+			return base, err
+		}
+		if _, err := parser.Parse(args); err != nil {
+			return base, err
+		}
+		if flags.Trx || flags.GroupBy != "" || flags.Sort != "" || len(flags.Columns) > 0 || flags.Limit != 0 || flags.Full {
+			return base, errors.New("only the filter flags can be changed in top")
+		}
+	}
+
+	f := base
+	f.Match, f.User, f.Host, f.DB = flags.Match, flags.User, flags.Host, flags.DB
+	f.Command, f.State, f.MinTime, f.MaxTime = flags.Command, flags.State, flags.MinTime, flags.MaxTime
+	f.IgnoreUser, f.IgnoreInfo, f.Where = flags.IgnoreUser, flags.IgnoreInfo, flags.Where
+	f.InTrx, f.TrxAge = flags.InTrx, flags.TrxAge
+	if err := f.validate(); err != nil {
+		return base, err
+	}
+	return f, nil
+}
+
+// formatTopFilter returns the filters of f as list flags that
+// parseTopFilter reads back.
+func formatTopFilter(f ListCmd) string {
+	var args []string
+	add := func(flag string, values ...string) {
+		for _, v := range values {
+			args = append(args, flag+"="+quoteFilterArg(v))
+		}
+	}
+	duration := func(flag string, d time.Duration) {
+		if d > 0 {
+			add(flag, d.String())
+		}
+	}
+	if f.Match != "" {
+		add("--match", f.Match)
+	}
+	add("--user", f.User...)
+	add("--host", f.Host...)
+	add("--db", f.DB...)
+	add("--command", f.Command...)
+	add("--state", f.State...)
+	duration("--min-time", f.MinTime)
+	duration("--max-time", f.MaxTime)
+	add("--ignore-user", f.IgnoreUser...)
+	add("--ignore-info", f.IgnoreInfo...)
+	if f.Where != "" {
+		add("--where", f.Where)
+	}
+	if f.InTrx {
+		args = append(args, "--in-trx")
+	}
+	duration("--trx-age", f.TrxAge)
+	return strings.Join(args, " ")
+}
+
+// quoteFilterArg single-quotes v for splitFilterArgs when needed.
+func quoteFilterArg(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n'\"\\") {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// splitFilterArgs splits s into words like a POSIX shell: quotes keep
+// spaces, and a backslash escapes the next character outside quotes, or a
+// quote or backslash inside double quotes.
+func splitFilterArgs(s string) ([]string, error) {
+	var args []string
+	var b strings.Builder
+	var quote rune
+	word, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, word = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, word = r, true
+		case unicode.IsSpace(r):
+			if word {
+				args = append(args, b.String())
+				b.Reset()
+				word = false
+			}
+		default:
+			b.WriteRune(r)
+			word = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if word {
+		args = append(args, b.String())
+	}
+	return args, nil
+}
+
+// joinCells pads cells to widths; the last cell is not padded.
+func joinCells(cells []string, widths []int) string {
+	var b strings.Builder
+	for i, c := range cells {
+		if i == len(cells)-1 {
+			b.WriteString(c)
+			break
+		}
+		c = fitWidth(c, widths[i])
+		b.WriteString(c)
+		b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)+2))
+	}
+	return b.String()
+}
+
+// fitWidth truncates s to width runes.
+func fitWidth(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(0, width)])
+}
+
+// writeScreen clears the screen and writes lines, each cut to width.
+func writeScreen(w io.Writer, lines []string, width int) error {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		if !strings.Contains(l, "\x1b[") {
+			l = fitWidth(l, width)
+		}
+		b.WriteString(l)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// topEscapeKeys maps terminal escape sequences to key names.
+var topEscapeKeys = []struct {
+	seq  string
+	name string
+}{
+	{"\x1b[A", "up"},
+	{"\x1b[B", "down"},
+	{"\x1b[C", "right"},
+	{"\x1b[D", "left"},
+	{"\x1bOA", "up"},
+	{"\x1bOB", "down"},
+	{"\x1b[5~", "pgup"},
+	{"\x1b[6~", "pgdn"},
+	{"\x1b[H", "home"},
+	{"\x1b[F", "end"},
+	{"\x1b[1~", "home"},
+	{"\x1b[4~", "end"},
+}
+
+// parseKeys splits raw terminal input into key names.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			name, n := "esc", 1
+			for _, k := range topEscapeKeys {
+				if bytes.HasPrefix(b, []byte(k.seq)) {
+					name, n = k.name, len(k.seq)
+					break
+				}
+			}
+			keys = append(keys, name)
+			b = b[n:]
+			continue
+		}
+		switch b[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// readKeys reads key presses from r until it fails.
+func readKeys(r io.Reader) <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			for _, k := range parseKeys(buf[:n]) {
+				keys <- k
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
@@ -0,0 +1,260 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("\x1b[Aq\x1b[6~ \r\x7f\x1bé\x03"))
+	want := []string{"up", "q", "pgdn", " ", "enter", "backspace", "esc", "é", "ctrl-c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func topTestRows() []Process {
+	row := func(id, time int64, user, info string) Process {
+		return Process{
+			ID:   id,
+			User: sql.NullString{String: user, Valid: true},
+			Time: sql.NullInt64{Int64: time, Valid: true},
+			Info: sql.NullString{String: info, Valid: info != ""},
+		}
+	}
+	return []Process{
+		row(1, 5, "app", "SELECT 1"),
+		row(2, 300, "batch", "UPDATE t\n  SET x = 1"),
+		row(3, 40, "app", ""),
+	}
+}
+
+func TestTopModelSortAndCursor(t *testing.T) {
+	m := newTopModel(processListSource{}, killPrivileges{Any: true}, ListCmd{})
+	m.setRows(topTestRows(), time.Now())
+
+	if ids := rowIDs(m.rows); !reflect.DeepEqual(ids, []int64{2, 3, 1}) {
+		t.Fatalf("default sort: got %v", ids)
+	}
+
+	m.handleKey("down")
+	if r, _ := m.current(); r.ID != 3 {
+		t.Fatalf("cursor: got %d", r.ID)
+	}
+
+	m.handleKey("r")
+	if ids := rowIDs(m.rows); !reflect.DeepEqual(ids, []int64{1, 3, 2}) {
+		t.Fatalf("reversed: got %v", ids)
+	}
+
+	// A refresh keeps the cursor on the same session.
+	m.setRows(topTestRows(), time.Now())
+	if r, _ := m.current(); r.ID != 3 {
+		t.Fatalf("cursor after refresh: got %d", r.ID)
+	}
+
+	m.handleKey("<")
+	if m.sortCol != "COMMAND" {
+		t.Fatalf("sort column: got %s", m.sortCol)
+	}
+}
+
+func TestTopModelSelectAndKill(t *testing.T) {
+	m := newTopModel(processListSource{}, killPrivileges{Any: true}, ListCmd{})
+	m.setRows(topTestRows(), time.Now())
+
+	if got := m.targets(); !reflect.DeepEqual(got, []int64{2}) {
+		t.Fatalf("cursor target: got %v", got)
+	}
+
+	m.handleKey(" ")
+	m.handleKey("down")
+	m.handleKey(" ")
+	if got := m.targets(); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Fatalf("selected targets: got %v", got)
+	}
+
+	if action := m.handleKey("K"); action != topNone || m.view != viewConfirm || m.killMode != ModeConnection {
+		t.Fatalf("expected confirm view, got action=%v view=%v", action, m.view)
+	}
+	if !strings.Contains(m.footer(), "KILL 1, 2? [y/N]") {
+		t.Fatalf("footer: %q", m.footer())
+	}
+	if action := m.handleKey("y"); action != topKill {
+		t.Fatalf("expected kill action, got %v", action)
+	}
+
+	m.handleKey("k")
+	if action := m.handleKey("n"); action != topNone || m.message != "kill cancelled" {
+		t.Fatalf("expected cancel, got action=%v message=%q", action, m.message)
+	}
+
+	// Sessions that disappear are deselected.
+	m.setRows(topTestRows()[:1], time.Now())
+	if got := m.targets(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("targets after refresh: got %v", got)
+	}
+}
+
+func TestTopModelFilter(t *testing.T) {
+	m := newTopModel(processListSource{}, killPrivileges{Any: true}, ListCmd{})
+
+	m.handleKey("/")
+	for _, k := range []string{"S", "E", "L", "x", "backspace"} {
+		m.handleKey(k)
+	}
+	if action := m.handleKey("enter"); action != topFilter || m.filter.Match != "SEL" {
+		t.Fatalf("got action=%v match=%q", action, m.filter.Match)
+	}
+
+	// The server checks the regex; a rejected filter is rolled back.
+	m.handleKey("/")
+	m.input = "--user=app --match=("
+	if action := m.handleKey("enter"); action != topFilter || m.filter.Match != "(" {
+		t.Fatalf("got action=%v match=%q", action, m.filter.Match)
+	}
+	m.rejectFilter(errors.New("Error 3692: Incorrect regular expression"))
+	if m.view != viewFilter || m.filter.Match != "SEL" || len(m.filter.User) != 0 || m.input != "--user=app --match=(" {
+		t.Fatalf("expected the previous filter and the prompt, got view=%v filter=%+v input=%q", m.view, m.filter, m.input)
+	}
+
+	m.input = "--min-time 1m --where 'time>30'"
+	if action := m.handleKey("enter"); action != topFilter || m.filter.MinTime != time.Minute || m.filter.Where != "time>30" {
+		t.Fatalf("got action=%v filter=%+v", action, m.filter)
+	}
+
+	m.handleKey("/")
+	m.input = "--sort=-id"
+	if action := m.handleKey("enter"); action != topNone || m.view != viewFilter {
+		t.Fatalf("expected --sort to be refused")
+	}
+	m.handleKey("esc")
+
+	if action := m.handleKey("t"); action != topRefresh || !m.filter.InTrx {
+		t.Fatalf("expected in-trx toggle")
+	}
+	if _, ok := m.column("TRX_AGE"); !ok {
+		t.Fatalf("expected transaction columns")
+	}
+}
+
+func TestTopModelTargetsShownRows(t *testing.T) {
+	m := newTopModel(processListSource{}, killPrivileges{Any: true}, ListCmd{})
+	m.setRows(topTestRows(), time.Now())
+	m.selected = map[int64]bool{1: true, 3: true, 9: true}
+	if got := m.targets(); !reflect.DeepEqual(got, []int64{1, 3}) {
+		t.Fatalf("got %v", got)
+	}
+
+	m.setRows(topTestRows()[1:], time.Now())
+	if got := m.targets(); !reflect.DeepEqual(got, []int64{3}) || len(m.selected) != 1 {
+		t.Fatalf("got %v selected %v", got, m.selected)
+	}
+}
+
+func TestParseTopFilter(t *testing.T) {
+	base := ListCmd{Trx: true, Sort: "-id", Match: "old"}
+	tests := []struct {
+		input   string
+		want    ListCmd
+		wantErr string
+	}{
+		{input: "", want: ListCmd{Trx: true, Sort: "-id"}},
+		{input: "SELECT .* FROM", want: ListCmd{Trx: true, Sort: "-id", Match: "SELECT .* FROM"}},
+		{
+			input: `--user app --user=batch --host 10.0.* --db shop --command Query --state "Sending data" --max-time 5m`,
+			want: ListCmd{Trx: true, Sort: "-id", User: []string{"app", "batch"}, Host: []string{"10.0.*"},
+				DB: []string{"shop"}, Command: []string{"Query"}, State: []string{"Sending data"}, MaxTime: 5 * time.Minute},
+		},
+		{
+			input: `--where 'user=~"^redash" && time>30' --ignore-info '^/\*' --trx-age 30s`,
+			want:  ListCmd{Trx: true, Sort: "-id", Where: `user=~"^redash" && time>30`, IgnoreInfo: []string{`^/\*`}, TrxAge: 30 * time.Second},
+		},
+		{input: "--limit 3", wantErr: "only the filter flags"},
+		{input: "--bogus", wantErr: "unknown flag --bogus"},
+		{input: "--where 'time >'", wantErr: "invalid --where"},
+		{input: "--host 10.0.0.0/33", wantErr: "invalid --host"},
+		{input: "--match 'x", wantErr: "unterminated ' quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseTopFilter(tt.input, base)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got err %v, want %q", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, base) {
+					t.Fatalf("filter changed on error: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v want %+v", got, tt.want)
+			}
+
+			// The prompt starts with the filter, which must read back.
+			again, err := parseTopFilter(formatTopFilter(got), base)
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Fatalf("round trip of %q: got %+v, %v", formatTopFilter(got), again, err)
+			}
+		})
+	}
+}
+
+func TestSplitFilterArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "  a  b ", want: []string{"a", "b"}},
+		{in: `--match='it''s' x`, want: []string{"--match=its", "x"}},
+		{in: `'it'\''s'`, want: []string{"it's"}},
+		{in: `"a \"b\" \d"`, want: []string{`a "b" \d`}},
+		{in: `a\ b ''`, want: []string{"a b", ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitFilterArgs(tt.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%q: got %q want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTopModelDraw(t *testing.T) {
+	m := newTopModel(processListSource{}, killPrivileges{Any: true}, ListCmd{})
+	m.title = "mysql-kill top"
+	m.setRows(topTestRows(), time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	var buf bytes.Buffer
+	if err := m.draw(&buf, 200, 10); err != nil {
+		t.Fatalf("draw: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"3 sessions", "refreshed 12:00:00", "sort=TIME desc", "TIME↓", "UPDATE t SET x = 1", topHelp} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in\n%s", want, out)
+		}
+	}
+	if lines := strings.Split(out, "\r\n"); len(lines) != 10 {
+		t.Fatalf("expected 10 lines, got %d", len(lines))
+	}
+}
+
+func rowIDs(rows []Process) []int64 {
+	ids := make([]int64, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	return ids
+}
@@ -0,0 +1,91 @@
+package mysqlkill
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Victim selection strategies, choosing the sessions to kill among the
+// matches. "top-N" picks the N longest running.
+const (
+	victimsAll            = "all"
+	victimsOldest         = "oldest"
+	victimsNewest         = "newest"
+	victimsAllButOldest   = "all-but-oldest"
+	victimsPerUser        = "per-user"
+	victimsPerFingerprint = "per-fingerprint"
+	victimsTopPrefix      = "top-"
+)
+
+// validateVictims checks a victim selection strategy; empty means all.
+func validateVictims(strategy string) error {
+	switch strategy {
+	case "", victimsAll, victimsOldest, victimsNewest, victimsAllButOldest, victimsPerUser, victimsPerFingerprint:
+		return nil
+	}
+	if n, ok := strings.CutPrefix(strategy, victimsTopPrefix); ok {
+		if v, err := strconv.Atoi(n); err == nil && v > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown victims %q: use all, oldest, newest, all-but-oldest, top-N, per-user or per-fingerprint", strategy)
+}
+
+// selectVictims returns the sessions strategy picks from rows, which are
+// ordered longest running first. The strategy must be valid.
+func selectVictims(rows []Process, strategy string) []Process {
+	if len(rows) == 0 {
+		return nil
+	}
+	switch strategy {
+	case victimsOldest:
+		return rows[:1]
+	case victimsNewest:
+		return rows[len(rows)-1:]
+	case victimsAllButOldest:
+		return rows[1:]
+	case victimsPerUser:
+		return firstPerKey(rows, func(r Process) string { return nullString(r.User) })
+	case victimsPerFingerprint:
+		return firstPerKey(rows, func(r Process) string { return r.FingerprintID() })
+	}
+	if n, ok := strings.CutPrefix(strategy, victimsTopPrefix); ok {
+		v, _ := strconv.Atoi(n)
+		return rows[:min(v, len(rows))]
+	}
+	return rows
+}
+
+// firstPerKey returns the first row of each key, in order.
+func firstPerKey(rows []Process, key func(Process) string) []Process {
+	seen := make(map[string]bool)
+	var picked []Process
+	for _, r := range rows {
+		k := key(r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		picked = append(picked, r)
+	}
+	return picked
+}
+
+// victimCap returns the hard cap of limit, lowered by override when set;
+// 0 means no cap.
+func victimCap(limit, override int) int {
+	if override > 0 && (limit == 0 || override < limit) {
+		return override
+	}
+	return limit
+}
+
+// checkVictimCap fails when n victims exceed the hard cap max; 0 means no
+// cap. Nothing is killed then, rather than a part of a runaway batch.
+func checkVictimCap(n, max int) error {
+	if max > 0 && n > max {
+		return fmt.Errorf("%d sessions would be killed, over the cap of %d: killing none", n, max)
+	}
+	return nil
+}
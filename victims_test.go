@@ -0,0 +1,95 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestValidateVictims(t *testing.T) {
+	for _, s := range []string{"", "all", "oldest", "newest", "all-but-oldest", "top-1", "top-10", "per-user", "per-fingerprint"} {
+		if err := validateVictims(s); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+	for _, s := range []string{"first", "top", "top-0", "top--1", "top-x", "top-"} {
+		if err := validateVictims(s); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+}
+
+func TestSelectVictims(t *testing.T) {
+	row := func(id int64, user, info string) Process {
+		return Process{
+			ID:   id,
+			User: sql.NullString{String: user, Valid: true},
+			Info: sql.NullString{String: info, Valid: true},
+		}
+	}
+	// Longest running first.
+	rows := []Process{
+		row(1, "app", "SELECT * FROM t WHERE id = 1"),
+		row(2, "app", "SELECT * FROM t WHERE id = 2"),
+		row(3, "etl", "SELECT * FROM t WHERE id = 3"),
+		row(4, "app", "UPDATE t SET a = 1"),
+	}
+	cases := []struct {
+		strategy string
+		want     []int64
+	}{
+		{strategy: "", want: []int64{1, 2, 3, 4}},
+		{strategy: "all", want: []int64{1, 2, 3, 4}},
+		{strategy: "oldest", want: []int64{1}},
+		{strategy: "newest", want: []int64{4}},
+		{strategy: "all-but-oldest", want: []int64{2, 3, 4}},
+		{strategy: "top-2", want: []int64{1, 2}},
+		{strategy: "top-9", want: []int64{1, 2, 3, 4}},
+		{strategy: "per-user", want: []int64{1, 3}},
+		{strategy: "per-fingerprint", want: []int64{1, 4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.strategy, func(t *testing.T) {
+			got := processIDs(selectVictims(rows, tc.strategy))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if got := selectVictims(nil, "oldest"); len(got) != 0 {
+		t.Fatalf("got %v from no rows", got)
+	}
+}
+
+func TestVictimCap(t *testing.T) {
+	cases := []struct {
+		limit, override, want int
+	}{
+		{limit: 50, override: 0, want: 50},
+		{limit: 50, override: 10, want: 10},
+		{limit: 50, override: 100, want: 50},
+		{limit: 0, override: 100, want: 100},
+		{limit: 0, override: 0, want: 0},
+	}
+	for _, tc := range cases {
+		if got := victimCap(tc.limit, tc.override); got != tc.want {
+			t.Fatalf("victimCap(%d, %d) = %d, want %d", tc.limit, tc.override, got, tc.want)
+		}
+	}
+}
+
+func TestCheckVictimCap(t *testing.T) {
+	cases := []struct {
+		n, max  int
+		wantErr bool
+	}{
+		{n: 100, max: 0},
+		{n: 3, max: 3},
+		{n: 4, max: 3, wantErr: true},
+	}
+	for _, tc := range cases {
+		if err := checkVictimCap(tc.n, tc.max); (err != nil) != tc.wantErr {
+			t.Fatalf("checkVictimCap(%d, %d) = %v, wantErr %v", tc.n, tc.max, err, tc.wantErr)
+		}
+	}
+}
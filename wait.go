@@ -0,0 +1,228 @@
+package mysqlkill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// waitInterval is how often --wait polls the killed threads.
+const waitInterval = time.Second
+
+// statementSlack is how far apart two start times of a statement, derived
+// from the whole seconds of TIME, may be for the same statement.
+const statementSlack = 2 * time.Second
+
+// threadState is a killed thread as seen by a --wait poll.
+type threadState struct {
+	// Gone reports that the thread left the processlist.
+	Gone         bool
+	Command      sql.NullString
+	State        sql.NullString
+	Info         sql.NullString
+	Time         sql.NullInt64
+	TrxState     sql.NullString
+	RowsModified sql.NullInt64
+}
+
+// idle reports whether the thread runs no statement.
+func (s threadState) idle() bool {
+	return nullString(s.Command) == "Sleep"
+}
+
+// rollingBack reports whether the thread's transaction is rolling back.
+func (s threadState) rollingBack() bool {
+	return nullString(s.TrxState) == "ROLLING BACK"
+}
+
+// settled reports whether a thread killed in mode is done with: gone, or
+// idle after a KILL QUERY.
+func (s threadState) settled(mode Mode) bool {
+	return s.Gone || (mode == ModeQuery && s.idle() && !s.rollingBack())
+}
+
+// probeThread reads the command, state and statement of process id with its
+// InnoDB transaction, if any.
+func probeThread(ctx context.Context, db *sql.DB, src processListSource, id int64) (threadState, error) {
+	var s threadState
+	err := db.QueryRowContext(ctx, "SELECT COMMAND, STATE, INFO, TIME, trx_state, trx_rows_modified FROM "+src.table()+
+		" LEFT JOIN information_schema.innodb_trx ON trx_mysql_thread_id = ID WHERE ID = ?", id).
+		Scan(&s.Command, &s.State, &s.Info, &s.Time, &s.TrxState, &s.RowsModified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return threadState{Gone: true}, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("poll process %d: %w", id, err)
+	}
+	return s, nil
+}
+
+// killWait tracks a killed thread until it settles.
+type killWait struct {
+	id   int64
+	mode Mode
+	last threadState
+	// info and started identify the statement that was killed; info is
+	// empty when the thread ran none.
+	info    string
+	started time.Time
+	// movedOn reports that the thread ran another statement after a KILL
+	// QUERY, so the killed one ended.
+	movedOn bool
+	// rollbackRows and rollbackAt are the rows to undo and the time when
+	// the rollback was first seen.
+	rollbackRows int64
+	rollbackAt   time.Time
+}
+
+// newKillWait tracks the thread of r, killed in mode shortly before now.
+func newKillWait(r Result, mode Mode, now time.Time) *killWait {
+	k := &killWait{id: r.ID, mode: mode, info: nullString(r.Process.Info)}
+	if r.Process.Time.Valid {
+		k.started = now.Add(-time.Duration(r.Process.Time.Int64) * time.Second)
+	}
+	return k
+}
+
+// runsKilled reports whether s, seen at now, still runs the statement that
+// was killed: the same text, started at the same time.
+func (k *killWait) runsKilled(s threadState, now time.Time) bool {
+	if k.info == "" || s.Gone || nullString(s.Info) != k.info || !s.Time.Valid {
+		return false
+	}
+	started := now.Add(-time.Duration(s.Time.Int64) * time.Second)
+	return started.Sub(k.started).Abs() <= statementSlack
+}
+
+// escalates reports whether the connection may be killed after the KILL
+// QUERY, as seen at now: the killed statement still runs and is not rolling
+// back.
+func (k *killWait) escalates(now time.Time) bool {
+	return k.mode == ModeQuery && !k.last.rollingBack() && k.runsKilled(k.last, now)
+}
+
+// settled reports whether the thread is done with.
+func (k *killWait) settled() bool {
+	return k.movedOn || k.last.settled(k.mode)
+}
+
+// observe records the state s seen at now and returns a progress line, or
+// "" when nothing changed worth reporting.
+func (k *killWait) observe(s threadState, now time.Time) string {
+	prev := k.last
+	k.last = s
+	switch {
+	case s.Gone:
+		return fmt.Sprintf("process %d is gone", k.id)
+	case s.settled(k.mode):
+		return fmt.Sprintf("process %d is idle", k.id)
+	case k.mode == ModeQuery && k.info != "" && !k.runsKilled(s, now):
+		k.movedOn = true
+		return fmt.Sprintf("process %d ended the killed statement and runs another", k.id)
+	case s.rollingBack() && s.RowsModified.Valid:
+		if !prev.rollingBack() {
+			k.rollbackRows, k.rollbackAt = s.RowsModified.Int64, now
+			return fmt.Sprintf("process %d is rolling back %d rows", k.id, s.RowsModified.Int64)
+		}
+		if s.RowsModified == prev.RowsModified {
+			return ""
+		}
+		return fmt.Sprintf("process %d is rolling back: %s", k.id,
+			rollbackProgress(k.rollbackRows, s.RowsModified.Int64, now.Sub(k.rollbackAt)))
+	case s.Command != prev.Command || s.State != prev.State:
+		return fmt.Sprintf("process %d is still running (%s)", k.id, threadActivity(s))
+	}
+	return ""
+}
+
+// rollbackProgress describes a rollback from total rows down to left after
+// elapsed, with the time left at the rate so far.
+func rollbackProgress(total, left int64, elapsed time.Duration) string {
+	s := fmt.Sprintf("%d of %d rows left", left, total)
+	done := total - left
+	if done <= 0 || elapsed <= 0 {
+		return s
+	}
+	eta := time.Duration(float64(elapsed) * float64(left) / float64(done))
+	return s + fmt.Sprintf(", about %s to go", eta.Round(time.Second))
+}
+
+// threadActivity formats the command and state of a thread.
+func threadActivity(s threadState) string {
+	if state := nullString(s.State); state != "" {
+		return nullString(s.Command) + ": " + state
+	}
+	return nullString(s.Command)
+}
+
+// waitResults waits for the threads of results with --wait, unless nothing
+// was killed in a dry run.
+func (c *Client) waitResults(ctx context.Context, w io.Writer, cmd *KillCmd, results []Result, au *auditor) error {
+	if !cmd.Wait || cmd.DryRun {
+		return nil
+	}
+	return c.waitKilled(ctx, w, cmd, results, au)
+}
+
+// waitKilled polls the threads of results, just killed in cmd's mode, until
+// each is gone or, after a KILL QUERY, idle or on to another statement,
+// reporting to w. With --escalate-after, the connection of a killed query
+// still running after that long is killed, unless it is rolling back, which
+// a connection kill would only make longer. It fails when a thread has not
+// settled within --wait-timeout.
+func (c *Client) waitKilled(ctx context.Context, w io.Writer, cmd *KillCmd, results []Result, au *auditor) error {
+	start := time.Now()
+	pending := make([]*killWait, len(results))
+	for i, r := range results {
+		pending[i] = newKillWait(r, cmd.mode(), start)
+	}
+
+	for {
+		now := time.Now()
+		for _, k := range pending {
+			s, err := probeThread(ctx, c.db, c.src, k.id)
+			if err != nil {
+				return err
+			}
+			if line := k.observe(s, now); line != "" {
+				fmt.Fprintln(w, line)
+			}
+		}
+		pending = slices.DeleteFunc(pending, (*killWait).settled)
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if cmd.EscalateAfter > 0 && now.Sub(start) >= cmd.EscalateAfter {
+			for _, k := range pending {
+				if !k.escalates(now) {
+					continue
+				}
+				fmt.Fprintf(w, "process %d is still running after %s, killing the connection\n", k.id, cmd.EscalateAfter)
+				_, err := killProcesses(ctx, w, c, &KillCmd{Kill: true}, []int64{k.id}, au, c.allow)
+				if err != nil && !errors.Is(err, errProcessNotFound) {
+					return err
+				}
+				k.mode = ModeConnection
+			}
+		}
+
+		if now.Sub(start) >= cmd.WaitTimeout {
+			left := make([]int64, len(pending))
+			for i, k := range pending {
+				left[i] = k.id
+			}
+			return fmt.Errorf("process %s still running after %s", formatIDs(left), cmd.WaitTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitInterval):
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package mysqlkill
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestThreadStateSettled(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+	cases := []struct {
+		name  string
+		state threadState
+		mode  Mode
+		want  bool
+	}{
+		{name: "gone after kill", state: threadState{Gone: true}, mode: ModeConnection, want: true},
+		{name: "gone after kill query", state: threadState{Gone: true}, mode: ModeQuery, want: true},
+		{name: "idle after kill query", state: threadState{Command: str("Sleep")}, mode: ModeQuery, want: true},
+		{name: "idle after kill", state: threadState{Command: str("Sleep")}, mode: ModeConnection},
+		{name: "still querying", state: threadState{Command: str("Query"), State: str("Sending data")}, mode: ModeQuery},
+		{name: "rolling back", state: threadState{Command: str("Sleep"), TrxState: str("ROLLING BACK")}, mode: ModeQuery},
+		{name: "killed connection", state: threadState{Command: str("Killed")}, mode: ModeConnection},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.state.settled(tc.mode); got != tc.want {
+				t.Fatalf("settled = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKillWaitObserve(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	rows := func(n int64) sql.NullInt64 { return sql.NullInt64{Int64: n, Valid: true} }
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	k := &killWait{id: 42, mode: ModeQuery}
+
+	steps := []struct {
+		state threadState
+		after time.Duration
+		want  string
+	}{
+		{state: threadState{Command: str("Query"), State: str("updating")}, want: "process 42 is still running (Query: updating)"},
+		{state: threadState{Command: str("Query"), State: str("updating")}, after: time.Second, want: ""},
+		{state: threadState{Command: str("Query"), State: str("query end"), TrxState: str("ROLLING BACK"), RowsModified: rows(1000)}, after: 2 * time.Second, want: "process 42 is rolling back 1000 rows"},
+		{state: threadState{Command: str("Query"), State: str("query end"), TrxState: str("ROLLING BACK"), RowsModified: rows(1000)}, after: 3 * time.Second, want: ""},
+		{state: threadState{Command: str("Query"), State: str("query end"), TrxState: str("ROLLING BACK"), RowsModified: rows(750)}, after: 7 * time.Second, want: "process 42 is rolling back: 750 of 1000 rows left, about 15s to go"},
+		{state: threadState{Command: str("Sleep")}, after: 8 * time.Second, want: "process 42 is idle"},
+	}
+	for i, s := range steps {
+		if got := k.observe(s.state, start.Add(s.after)); got != s.want {
+			t.Fatalf("step %d: got %q, want %q", i, got, s.want)
+		}
+	}
+
+	k = &killWait{id: 7, mode: ModeConnection}
+	if got := k.observe(threadState{Gone: true}, start); got != "process 7 is gone" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestKillWaitMovedOn(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	secs := func(n int64) sql.NullInt64 { return sql.NullInt64{Int64: n, Valid: true} }
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	killed := Result{ID: 42, Process: Process{ID: 42, Info: str("UPDATE t SET x = 1"), Time: secs(30)}}
+	running := threadState{Command: str("Query"), State: str("updating"), Info: str("UPDATE t SET x = 1"), Time: secs(35)}
+
+	cases := []struct {
+		name  string
+		state threadState
+		after time.Duration
+	}{
+		{name: "another statement", state: threadState{Command: str("Query"), State: str("executing"), Info: str("SELECT 1"), Time: secs(0)}, after: 6 * time.Second},
+		{name: "same text rerun", state: threadState{Command: str("Query"), State: str("updating"), Info: str("UPDATE t SET x = 1"), Time: secs(1)}, after: 6 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newKillWait(killed, ModeQuery, start)
+			k.observe(running, start.Add(5*time.Second))
+			if !k.escalates(start.Add(5*time.Second)) || k.settled() {
+				t.Fatalf("the killed statement should still be running")
+			}
+
+			now := start.Add(tc.after)
+			if got := k.observe(tc.state, now); got != "process 42 ended the killed statement and runs another" {
+				t.Fatalf("got %q", got)
+			}
+			if !k.settled() || k.escalates(now) {
+				t.Fatalf("settled = %v, escalates = %v", k.settled(), k.escalates(now))
+			}
+		})
+	}
+}
+
+func TestRollbackProgress(t *testing.T) {
+	cases := []struct {
+		total, left int64
+		elapsed     time.Duration
+		want        string
+	}{
+		{total: 100, left: 100, elapsed: time.Second, want: "100 of 100 rows left"},
+		{total: 100, left: 50, elapsed: 0, want: "50 of 100 rows left"},
+		{total: 100, left: 25, elapsed: 30 * time.Second, want: "25 of 100 rows left, about 10s to go"},
+	}
+	for _, tc := range cases {
+		if got := rollbackProgress(tc.total, tc.left, tc.elapsed); got != tc.want {
+			t.Fatalf("rollbackProgress(%d, %d, %s) = %q, want %q", tc.total, tc.left, tc.elapsed, got, tc.want)
+		}
+	}
+}
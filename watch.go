@@ -0,0 +1,376 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runWatch executes the watch command.
+func runWatch(ctx context.Context, cli *CLI, cmd *WatchCmd) error {
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	cfg, err := resolveConfig(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if cfg.Target == targetProxySQL {
+		return errors.New("watch is not supported with target proxysql")
+	}
+	rules := []Rule{cmd.flagRule()}
+	if cmd.Rules {
+		if rules, err = selectRules(cfg.Rules, nil); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := newMetrics(rules)
+	if cmd.MetricsAddr != "" {
+		shutdown, err := serveMetrics(cmd.MetricsAddr, m)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+
+	au, err := newAuditor(cfg, "watch")
+	if err != nil {
+		return err
+	}
+	defer au.Close()
+	au.listen(m.observeKill)
+
+	w := &watcher{cfg: cfg, cmd: cmd, rules: rules, metrics: m, au: au, out: os.Stdout,
+		allow: selfServicePolicy(cfg.SelfService, caller{osUser: currentOSUser()})}
+	defer w.disconnect()
+
+	if cmd.Once {
+		return w.cycle(ctx)
+	}
+
+	ticker := time.NewTicker(cmd.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.cycle(ctx); err != nil {
+			w.logf("%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// validate checks the flags before connecting.
+func (c *WatchCmd) validate() error {
+	if c.Kill && c.KillQuery {
+		return errors.New("--kill and --kill-query are mutually exclusive")
+	}
+	if c.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if c.GroupBy != "" {
+		return errors.New("--group-by is not supported by watch")
+	}
+	if err := validateVictims(c.Victims); err != nil {
+		return err
+	}
+	if c.AbortOver < 0 {
+		return errors.New("--abort-over must not be negative")
+	}
+	if c.Rules {
+		if c.Kill || c.KillQuery || c.Match != "" || c.hasServerFilters() || c.InTrx || c.TrxAge > 0 {
+			return errors.New("--rules cannot be combined with --kill, --kill-query or filters")
+		}
+		if (c.Victims != "" && c.Victims != victimsAll) || c.AbortOver > 0 {
+			return errors.New("--victims and --abort-over are set per rule with --rules")
+		}
+		return nil
+	}
+	// Without a filter every session matches, the watcher's own included.
+	if (c.Kill || c.KillQuery) && c.Match == "" && !c.hasServerFilters() && !c.InTrx && c.TrxAge <= 0 {
+		return errors.New("watch --kill needs at least one filter, e.g. --min-time or --match")
+	}
+	return c.ListCmd.validate()
+}
+
+// flagRule returns the rule the flags describe: the filters select the
+// sessions, --kill or --kill-query the action, --victims and --abort-over
+// pick the victims and --limit caps them.
+func (c *WatchCmd) flagRule() Rule {
+	action := rulePrint
+	switch {
+	case c.Kill:
+		action = ruleKill
+	case c.KillQuery:
+		action = ruleKillQuery
+	}
+	return Rule{
+		Name:       c.Rule,
+		Action:     action,
+		Victims:    c.Victims,
+		AbortOver:  c.AbortOver,
+		MaxVictims: c.Limit,
+		Filter: Filter{
+			Match:       c.Match,
+			Users:       c.User,
+			Hosts:       c.Host,
+			DBs:         c.DB,
+			Commands:    c.Command,
+			States:      c.State,
+			MinTime:     c.MinTime,
+			MaxTime:     c.MaxTime,
+			IgnoreUsers: c.IgnoreUser,
+			IgnoreInfos: c.IgnoreInfo,
+			Where:       c.Where,
+			Trx:         c.Trx,
+			InTrx:       c.InTrx,
+			TrxAge:      c.TrxAge,
+		},
+	}
+}
+
+// serveMetrics serves m on addr until the returned function is called.
+func serveMetrics(addr string, m *metrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	fmt.Fprintf(os.Stderr, "metrics: http://%s/metrics\n", ln.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
+
+// watcher polls the processlist and applies its rules, keeping its
+// connection across cycles and reconnecting after a failed poll.
+type watcher struct {
+	cfg   AppConfig
+	cmd   *WatchCmd
+	rules []Rule
+	// allow is the self-service policy of the OS user running watch.
+	allow   func(Process) error
+	metrics *metrics
+	au      *auditor
+	out     io.Writer
+
+	c         *Client
+	connected bool
+}
+
+// cycle runs one poll and applies each rule to the sessions it claimed.
+func (w *watcher) cycle(ctx context.Context) error {
+	if err := w.connect(ctx); err != nil {
+		w.metrics.observePoll(0, err, time.Now())
+		return err
+	}
+
+	start := time.Now()
+	plans, err := w.poll(ctx)
+	w.metrics.observePoll(time.Since(start), err, start)
+	if err != nil {
+		// The connection or tunnel may be gone; reconnect next cycle.
+		w.disconnect()
+		return err
+	}
+
+	var errs []error
+	for _, p := range plans {
+		if err := w.apply(ctx, p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply prints or kills the victims of a rule.
+func (w *watcher) apply(ctx context.Context, p rulePlan) error {
+	prefix := w.logPrefix(p.Rule)
+	if p.Err != nil {
+		return fmt.Errorf("%s%w", prefix, p.Err)
+	}
+	ids := p.victims()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if p.Rule.Action == rulePrint {
+		for _, h := range p.Hits {
+			if h.Skip != "" {
+				continue
+			}
+			r := w.cfg.Redaction.Row(h.Process)
+			w.logf("%smatch %d %s@%s time=%ss: %s", prefix, r.ID, nullString(r.User), nullString(r.Host),
+				nullInt(r.Time), truncateText(flattenSpace(nullString(r.Info)), infoMaxWidth))
+		}
+		return nil
+	}
+
+	kill := p.Rule.killCmd(w.cmd.DryRun)
+	w.au.setRule(p.Rule.Name)
+	ids, refused := w.vet(p, kill, prefix)
+	if len(ids) == 0 {
+		return refused
+	}
+
+	verdict, err := enforceReader(ctx, w.c.db, w.c.f, p.Rule.config(w.cfg))
+	w.au.setServer(w.c.f.Name(), verdict)
+	if err != nil {
+		w.metrics.observeWriterRefusal()
+		w.au.Record(auditRecord{DryRun: kill.DryRun, Outcome: auditRefused, Error: err.Error()}, Process{})
+		return fmt.Errorf("%sskipped %d matching sessions: %w", prefix, len(ids), err)
+	}
+
+	// Sessions are killed one by one, so one that ended since the poll does
+	// not hold back the others.
+	for _, id := range ids {
+		var buf bytes.Buffer
+		_, err := killProcesses(ctx, &buf, w.c, kill, []int64{id}, w.au, w.allow)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line != "" {
+				w.logf("%s%s", prefix, line)
+			}
+		}
+		if err != nil {
+			w.logf("%skill %d: %v", prefix, id, err)
+		}
+	}
+	return refused
+}
+
+// vet returns the victims of p the self-service policy allows, recording
+// and logging the others, and an error when it refused any.
+func (w *watcher) vet(p rulePlan, kill *KillCmd, prefix string) ([]int64, error) {
+	var ids []int64
+	refused := 0
+	for _, h := range p.Hits {
+		if h.Skip != "" {
+			continue
+		}
+		if w.allow != nil {
+			if err := w.allow(h.Process); err != nil {
+				w.au.Record(auditRecord{ProcessID: h.ID(), DryRun: kill.DryRun, Outcome: auditRefused, Error: err.Error()}, h.Process)
+				w.logf("%skill %d: %v", prefix, h.ID(), err)
+				refused++
+				continue
+			}
+		}
+		ids = append(ids, h.ID())
+	}
+	if refused > 0 {
+		return ids, fmt.Errorf("%srefused %d matching sessions: not the caller's", prefix, refused)
+	}
+	return ids, nil
+}
+
+// logPrefix returns the log line prefix naming r with --rules.
+func (w *watcher) logPrefix(r Rule) string {
+	if !w.cmd.Rules {
+		return ""
+	}
+	return "rule " + r.Name + ": "
+}
+
+// connect opens the target connection unless it is open.
+func (w *watcher) connect(ctx context.Context) error {
+	if w.c != nil {
+		return nil
+	}
+	c, err := newClient(ctx, w.cfg, "watch")
+	if err != nil {
+		return err
+	}
+	// A single connection keeps CONNECTION_ID() stable between the
+	// processlist query and the exclusion of the watcher's own session.
+	c.singleConn()
+
+	if w.connected {
+		w.metrics.observeReconnect(c.tunnel != nil)
+		w.logf("reconnected to %s", targetAddr(w.cfg.MySQL))
+	}
+	w.c, w.connected = c, true
+	return nil
+}
+
+// disconnect closes the target connection.
+func (w *watcher) disconnect() {
+	if w.c != nil {
+		_ = w.c.Close()
+		w.c = nil
+	}
+}
+
+// poll matches the rules against the sessions other than the watcher's own
+// and updates the long-running sessions metric.
+func (w *watcher) poll(ctx context.Context) ([]rulePlan, error) {
+	var self int64
+	if err := w.c.db.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&self); err != nil {
+		return nil, fmt.Errorf("query connection id: %w", err)
+	}
+
+	plans, err := planRules(ctx, w.c.db, w.c.f, w.c.src, w.rules, self, w.cfg.AbortOver)
+	if err != nil {
+		return nil, err
+	}
+
+	byState, err := countLongRunning(ctx, w.c.db, w.c.src, w.cmd.LongTime, self)
+	if err != nil {
+		return nil, err
+	}
+	w.metrics.setLongRunning(byState)
+	return plans, nil
+}
+
+// countLongRunning counts the non-sleeping sessions other than self running
+// for at least d, by state.
+func countLongRunning(ctx context.Context, db *sql.DB, src processListSource, d time.Duration, self int64) (map[string]int, error) {
+	query := "SELECT COALESCE(STATE, ''), COUNT(*) FROM " + src.table() +
+		" WHERE COMMAND NOT IN ('Sleep', 'Daemon', 'Binlog Dump', 'Binlog Dump GTID') AND TIME >= ? AND ID <> ? GROUP BY 1"
+	rows, err := db.QueryContext(ctx, query, int64(d/time.Second), self)
+	if err != nil {
+		return nil, fmt.Errorf("count long-running sessions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	byState := make(map[string]int)
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return nil, fmt.Errorf("scan long-running sessions: %w", err)
+		}
+		byState[state] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return byState, nil
+}
+
+// logf prints a timestamped line.
+func (w *watcher) logf(format string, args ...any) {
+	fmt.Fprintf(w.out, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,107 @@
+package mysqlkill
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		cmd     WatchCmd
+		wantErr bool
+	}{
+		{name: "monitor without filters", cmd: WatchCmd{Interval: time.Second}},
+		{name: "kill with min-time", cmd: WatchCmd{Interval: time.Second, Kill: true, ListCmd: ListCmd{MinTime: time.Minute}}},
+		{name: "kill-query with match", cmd: WatchCmd{Interval: time.Second, KillQuery: true, ListCmd: ListCmd{Match: "^SELECT"}}},
+		{name: "kill idle transactions", cmd: WatchCmd{Interval: time.Second, Kill: true, ListCmd: ListCmd{TrxAge: time.Minute}}},
+		{name: "kill without filters", cmd: WatchCmd{Interval: time.Second, Kill: true}, wantErr: true},
+		{name: "both kill modes", cmd: WatchCmd{Interval: time.Second, Kill: true, KillQuery: true, ListCmd: ListCmd{MinTime: time.Minute}}, wantErr: true},
+		{name: "zero interval", cmd: WatchCmd{}, wantErr: true},
+		{name: "group-by", cmd: WatchCmd{Interval: time.Second, ListCmd: ListCmd{GroupBy: "user"}}, wantErr: true},
+		{name: "invalid where", cmd: WatchCmd{Interval: time.Second, Kill: true, ListCmd: ListCmd{Where: "time >"}}, wantErr: true},
+		{name: "rules", cmd: WatchCmd{Interval: time.Second, Rules: true}},
+		{name: "rules with kill", cmd: WatchCmd{Interval: time.Second, Rules: true, Kill: true}, wantErr: true},
+		{name: "rules with filter", cmd: WatchCmd{Interval: time.Second, Rules: true, ListCmd: ListCmd{MinTime: time.Minute}}, wantErr: true},
+		{name: "rules with victims", cmd: WatchCmd{Interval: time.Second, Rules: true, Victims: "oldest"}, wantErr: true},
+		{name: "rules with abort-over", cmd: WatchCmd{Interval: time.Second, Rules: true, AbortOver: 5}, wantErr: true},
+		{name: "victims", cmd: WatchCmd{Interval: time.Second, Kill: true, Victims: "top-3", AbortOver: 10, ListCmd: ListCmd{MinTime: time.Minute}}},
+		{name: "unknown victims", cmd: WatchCmd{Interval: time.Second, Victims: "youngest"}, wantErr: true},
+		{name: "negative abort-over", cmd: WatchCmd{Interval: time.Second, AbortOver: -1}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cmd.validate()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatchFlagRule(t *testing.T) {
+	cases := []struct {
+		name string
+		cmd  WatchCmd
+		want string
+	}{
+		{name: "monitor", cmd: WatchCmd{Rule: "watch"}, want: rulePrint},
+		{name: "kill", cmd: WatchCmd{Rule: "watch", Kill: true}, want: ruleKill},
+		{name: "kill-query", cmd: WatchCmd{Rule: "watch", KillQuery: true}, want: ruleKillQuery},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cmd.ListCmd = ListCmd{User: []string{"redash"}, MinTime: time.Minute, Limit: 2, TrxAge: time.Hour}
+			tc.cmd.Victims, tc.cmd.AbortOver = "per-user", 5
+			r := tc.cmd.flagRule()
+			if r.Name != "watch" || r.Action != tc.want || r.MaxVictims != 2 || r.Victims != "per-user" || r.AbortOver != 5 ||
+				r.Filter.Users[0] != "redash" || r.Filter.MinTime != time.Minute || r.Filter.TrxAge != time.Hour {
+				t.Fatalf("unexpected rule: %+v", r)
+			}
+		})
+	}
+}
+
+func TestWatcherApplySelfService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := AppConfig{
+		Audit:       AuditConfig{Enabled: true, File: path},
+		SelfService: SelfServiceConfig{Enabled: true, MatchOSUser: true},
+	}
+	au, err := newAuditor(cfg, "watch")
+	if err != nil {
+		t.Fatalf("newAuditor: %v", err)
+	}
+	var out bytes.Buffer
+	w := &watcher{cfg: cfg, cmd: &WatchCmd{}, au: au, out: &out,
+		allow: selfServicePolicy(cfg.SelfService, caller{osUser: "alice"})}
+
+	// The session of another user is refused before the server is touched:
+	// the watcher has no connection.
+	plan := rulePlan{
+		Rule: Rule{Name: "watch", Action: ruleKill},
+		Hits: []ruleHit{{Process: Process{ID: 7, User: sql.NullString{String: "bob", Valid: true}}}},
+	}
+	if err := w.apply(context.Background(), plan); err == nil || !strings.Contains(err.Error(), "refused 1") {
+		t.Fatalf("err = %v, want a refusal", err)
+	}
+	au.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if !strings.Contains(string(data), `"process_id":7`) || !strings.Contains(string(data), `"outcome":"refused"`) ||
+		!strings.Contains(string(data), `"rule":"watch"`) {
+		t.Fatalf("unexpected audit log: %s", data)
+	}
+	if !strings.Contains(out.String(), "does not belong to OS user alice") {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+}